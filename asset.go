@@ -0,0 +1,188 @@
+package gochroma
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxAssetDecimals is the most decimal places an asset can have and
+// still show every ColorValue.
+const MaxAssetDecimals = 18
+
+// Asset is what a color stands for, and how its color values are shown to
+// people. A color value of 1250 with 2 decimals and ticker GLD is shown
+// as "12.50 GLD".
+type Asset struct {
+	Name     string `json:"name,omitempty"`
+	Ticker   string `json:"ticker,omitempty"`
+	Decimals int    `json:"decimals"`
+	// name of one whole unit, like "ounce", used when there's no ticker
+	Unit string `json:"unit,omitempty"`
+}
+
+// NewAsset checks the metadata and returns the asset.
+func NewAsset(name, ticker string, decimals int, unit string) (*Asset, error) {
+	a := &Asset{
+		Name:     name,
+		Ticker:   ticker,
+		Decimals: decimals,
+		Unit:     unit,
+	}
+	err := a.validate()
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Asset) validate() error {
+	if a.Decimals < 0 || a.Decimals > MaxAssetDecimals {
+		str := fmt.Sprintf("decimals should be between 0 and %d, got %d",
+			MaxAssetDecimals, a.Decimals)
+		return MakeError(ErrBadAsset, str, nil)
+	}
+	if strings.IndexFunc(a.Ticker, unicode.IsSpace) != -1 ||
+		strings.IndexFunc(a.Unit, unicode.IsSpace) != -1 {
+		return MakeError(ErrBadAsset, "ticker and unit can't have spaces", nil)
+	}
+	return nil
+}
+
+// symbol is what goes after the amount
+func (a *Asset) symbol() string {
+	if a.Ticker != "" {
+		return a.Ticker
+	}
+	return a.Unit
+}
+
+// Format shows the color value in whole units with every decimal place,
+// followed by the ticker or unit if there is one.
+func (a *Asset) Format(cv ColorValue) string {
+	digits := strconv.FormatUint(uint64(cv), 10)
+	if a.Decimals > 0 {
+		if len(digits) <= a.Decimals {
+			digits = strings.Repeat("0", a.Decimals-len(digits)+1) + digits
+		}
+		point := len(digits) - a.Decimals
+		digits = digits[:point] + "." + digits[point:]
+	}
+	symbol := a.symbol()
+	if symbol == "" {
+		return digits
+	}
+	return digits + " " + symbol
+}
+
+// Parse turns an amount like "12.5 GLD" or "12.50" back into a color
+// value. The ticker or unit is optional but has to be this asset's if
+// given, and there can't be more decimal places than the asset has.
+func (a *Asset) Parse(s string) (ColorValue, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		str := fmt.Sprintf("amount should be a number and a ticker: %q", s)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	if len(fields) == 2 && fields[1] != a.Ticker && fields[1] != a.Unit {
+		str := fmt.Sprintf("amount is in %v, not %v", fields[1], a.symbol())
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+
+	whole, fraction := fields[0], ""
+	point := strings.Index(whole, ".")
+	if point != -1 {
+		whole, fraction = whole[:point], whole[point+1:]
+	}
+	if whole == "" && fraction == "" {
+		str := fmt.Sprintf("amount has no digits: %q", s)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	if len(fraction) > a.Decimals {
+		str := fmt.Sprintf("amount has more than %d decimal places: %q",
+			a.Decimals, s)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	digits := whole + fraction + strings.Repeat("0", a.Decimals-len(fraction))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			str := fmt.Sprintf("amount is not a number: %q", s)
+			return 0, MakeError(ErrInvalidColorValue, str, nil)
+		}
+	}
+	cv, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		str := fmt.Sprintf("amount is too big: %q", s)
+		return 0, MakeError(ErrInvalidColorValue, str, err)
+	}
+	return ColorValue(cv), nil
+}
+
+// asset returns the asset of the definition, or one showing raw color
+// values if it has none.
+func (c *ColorDefinition) asset() *Asset {
+	if c.Asset == nil {
+		return &Asset{}
+	}
+	return c.Asset
+}
+
+// FormatColorValue shows the color value with the asset of the definition.
+func (c *ColorDefinition) FormatColorValue(cv ColorValue) string {
+	return c.asset().Format(cv)
+}
+
+// ParseColorValue turns an amount in the asset of the definition into a
+// color value.
+func (c *ColorDefinition) ParseColorValue(s string) (ColorValue, error) {
+	return c.asset().Parse(s)
+}
+
+type jsonColorDefinition struct {
+	Definition string `json:"definition"`
+	Asset      *Asset `json:"asset,omitempty"`
+}
+
+// MarshalJSON encodes the definition in its string form along with its
+// asset.
+func (c *ColorDefinition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonColorDefinition{
+		Definition: c.String(),
+		Asset:      c.Asset,
+	})
+}
+
+// UnmarshalJSON decodes a definition, looking up the kernel in
+// DefaultKernelRegistry.
+func (c *ColorDefinition) UnmarshalJSON(data []byte) error {
+	cd, err := DefaultKernelRegistry.UnmarshalColorDefinition(data)
+	if err != nil {
+		return err
+	}
+	*c = *cd
+	return nil
+}
+
+// UnmarshalColorDefinition decodes a definition encoded with MarshalJSON,
+// looking up the kernel in this registry.
+func (r *KernelRegistry) UnmarshalColorDefinition(data []byte) (*ColorDefinition, error) {
+	var j jsonColorDefinition
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return nil, MakeError(ErrBadColorDefinition, "color definition is unparseable", err)
+	}
+	cd, err := r.NewColorDefinitionFromStr(j.Definition)
+	if err != nil {
+		return nil, err
+	}
+	if j.Asset != nil {
+		err = j.Asset.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	cd.Asset = j.Asset
+	return cd, nil
+}
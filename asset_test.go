@@ -0,0 +1,216 @@
+package gochroma_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+func TestAssetFormatParse(t *testing.T) {
+	gold := &gochroma.Asset{Name: "Gold", Ticker: "GLD", Decimals: 2}
+	shares := &gochroma.Asset{Name: "Shares", Decimals: 0, Unit: "share"}
+	tiny := &gochroma.Asset{Decimals: 8}
+
+	tests := []struct {
+		desc   string
+		asset  *gochroma.Asset
+		cv     gochroma.ColorValue
+		str    string
+		inputs []string
+	}{
+		{
+			desc:   "decimals",
+			asset:  gold,
+			cv:     1250,
+			str:    "12.50 GLD",
+			inputs: []string{"12.50 GLD", "12.5 GLD", "12.5", " 12.50  GLD "},
+		},
+		{
+			desc:   "less than one",
+			asset:  gold,
+			cv:     5,
+			str:    "0.05 GLD",
+			inputs: []string{"0.05 GLD", ".05"},
+		},
+		{
+			desc:   "whole",
+			asset:  gold,
+			cv:     300,
+			str:    "3.00 GLD",
+			inputs: []string{"3", "3.", "3 GLD"},
+		},
+		{
+			desc:   "unit",
+			asset:  shares,
+			cv:     42,
+			str:    "42 share",
+			inputs: []string{"42 share", "42"},
+		},
+		{
+			desc:   "no symbol",
+			asset:  tiny,
+			cv:     1,
+			str:    "0.00000001",
+			inputs: []string{"0.00000001"},
+		},
+		{
+			desc:   "largest",
+			asset:  tiny,
+			cv:     18446744073709551615,
+			str:    "184467440737.09551615",
+			inputs: []string{"184467440737.09551615"},
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		str := test.asset.Format(test.cv)
+
+		// Verify
+		if str != test.str {
+			t.Errorf("%v: wrong format: got %q, want %q", test.desc, str, test.str)
+		}
+		for _, input := range test.inputs {
+			cv, err := test.asset.Parse(input)
+			if err != nil {
+				t.Errorf("%v: failed to parse %q: %v", test.desc, input, err)
+				continue
+			}
+			if cv != test.cv {
+				t.Errorf("%v: wrong color value for %q: got %d, want %d",
+					test.desc, input, cv, test.cv)
+			}
+		}
+	}
+}
+
+func TestAssetParseError(t *testing.T) {
+	gold := &gochroma.Asset{Name: "Gold", Ticker: "GLD", Decimals: 2}
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"empty", ""},
+		{"too many fields", "12 GLD GLD"},
+		{"wrong ticker", "12 SLV"},
+		{"no digits", ". GLD"},
+		{"too precise", "12.505 GLD"},
+		{"negative", "-12 GLD"},
+		{"not a number", "12a GLD"},
+		{"two points", "1.2.3"},
+		{"overflow", "184467440737095516.16"},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := gold.Parse(test.input)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(gochroma.ErrInvalidColorValue)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
+func TestNewAssetError(t *testing.T) {
+	tests := []struct {
+		desc     string
+		ticker   string
+		decimals int
+		unit     string
+	}{
+		{"negative decimals", "GLD", -1, ""},
+		{"too many decimals", "GLD", gochroma.MaxAssetDecimals + 1, ""},
+		{"space in ticker", "G LD", 2, ""},
+		{"space in unit", "GLD", 2, "troy ounce"},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := gochroma.NewAsset("Gold", test.ticker, test.decimals, test.unit)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(gochroma.ErrBadAsset)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
+func TestColorDefinitionJSON(t *testing.T) {
+	// Setup
+	kernel, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	shaHash, err := btcwire.NewShaHashFromStr(
+		"0f9d0b4a1a8e2e5b9b1d6ac0d2a05fb43cfa2bd4c3a8d1b0a3e8e74ee3c8aa4e")
+	if err != nil {
+		t.Fatalf("err on shahash creation: %v", err)
+	}
+	asset, err := gochroma.NewAsset("Gold", "GLD", 2, "ounce")
+	if err != nil {
+		t.Fatalf("failed to make asset: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(kernel, btcwire.NewOutPoint(shaHash, 1), 300000)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	cd.Asset = asset
+
+	// Execute
+	data, err := json.Marshal(cd)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	decoded := new(gochroma.ColorDefinition)
+	err = json.Unmarshal(data, decoded)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", data, err)
+	}
+
+	// Verify
+	if decoded.String() != cd.String() {
+		t.Errorf("wrong definition: got %v, want %v", decoded, cd)
+	}
+	if decoded.Asset == nil || *decoded.Asset != *asset {
+		t.Fatalf("wrong asset: got %v, want %v", decoded.Asset, asset)
+	}
+	str := decoded.FormatColorValue(1250)
+	if str != "12.50 GLD" {
+		t.Errorf("wrong format: got %q, want %q", str, "12.50 GLD")
+	}
+	cv, err := decoded.ParseColorValue("12.5 ounce")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if cv != 1250 {
+		t.Errorf("wrong color value: got %d, want 1250", cv)
+	}
+
+	// without an asset the color value shows as is
+	decoded.Asset = nil
+	str = decoded.FormatColorValue(1250)
+	if str != "1250" {
+		t.Errorf("wrong raw format: got %q, want %q", str, "1250")
+	}
+	err = json.Unmarshal([]byte(`{"definition":"`+cd.String()+`","asset":{"decimals":30}}`), decoded)
+	if err == nil {
+		t.Fatalf("expected error for bad asset, got nil")
+	}
+}
@@ -2,6 +2,7 @@ package gochroma
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcwire"
@@ -121,6 +122,19 @@ func (b *BlockExplorer) OutPointValue(outpoint *btcwire.OutPoint) (int64, error)
 	return tx.MsgTx().TxOut[outpoint.Index].Value, nil
 }
 
+// OutPointTxOut returns the output the outpoint points to
+func (b *BlockExplorer) OutPointTxOut(outpoint *btcwire.OutPoint) (*btcwire.TxOut, error) {
+	tx, err := b.OutPointTx(outpoint)
+	if err != nil {
+		return nil, err
+	}
+	if int(outpoint.Index) >= len(tx.MsgTx().TxOut) {
+		str := fmt.Sprintf("tx %v has no output %d", outpoint.Hash, outpoint.Index)
+		return nil, MakeError(ErrBadOutputIndex, str, nil)
+	}
+	return tx.MsgTx().TxOut[outpoint.Index], nil
+}
+
 // OutPointTx returns the transaction the outpoint points to
 func (b *BlockExplorer) OutPointTx(outpoint *btcwire.OutPoint) (*btcutil.Tx, error) {
 	// outpoint is a shaHash, which means we have to change it to convert
@@ -3,7 +3,9 @@ package gochroma
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/btcsuite/btcnet"
 	"github.com/btcsuite/btcrpcclient"
@@ -166,3 +168,26 @@ func (b *btcdBlockReaderWriter) PublishRawTx(hash []byte) ([]byte, error) {
 	// convert bytes to big-endian
 	return BigEndianBytes(shaHash), nil
 }
+
+// EstimateFeeRate returns the fee rate the node estimates for a tx to be
+// mined within the number of blocks. btcd and bitcoind both answer
+// estimatefee in BTC per kB, with -1 when they don't have enough data.
+func (b *btcdBlockReaderWriter) EstimateFeeRate(blocks int) (FeeRate, error) {
+	param := json.RawMessage(strconv.Itoa(blocks))
+	result, err := b.Client.RawRequest("estimatefee", []json.RawMessage{param})
+	if err != nil {
+		str := fmt.Sprintf("failed to estimate fee for %d blocks", blocks)
+		return 0, MakeError(ErrBlockRead, str, err)
+	}
+	var btcPerKB float64
+	err = json.Unmarshal(result, &btcPerKB)
+	if err != nil {
+		str := fmt.Sprintf("fee estimate %s looks bad", result)
+		return 0, MakeError(ErrBlockRead, str, err)
+	}
+	if btcPerKB < 0 {
+		str := fmt.Sprintf("node has no fee estimate for %d blocks", blocks)
+		return 0, MakeError(ErrNoFeeEstimate, str, nil)
+	}
+	return FeeRate(btcPerKB*1e8 + 0.5), nil
+}
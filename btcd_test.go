@@ -609,3 +609,58 @@ func TestPublishRawTxError1(t *testing.T) {
 		}
 	}
 }
+
+func TestEstimateFeeRate(t *testing.T) {
+	tests := []struct {
+		result string
+		want   gochroma.FeeRate
+		err    int
+	}{
+		{"0.00012345", 12345, -1},
+		{"0.0001", 10000, -1},
+		{"-1", 0, gochroma.ErrNoFeeEstimate},
+		{"\"high\"", 0, gochroma.ErrBlockRead},
+	}
+
+	for _, test := range tests {
+		// Setup
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response := fmt.Sprintf("{\"result\":%s,\"error\":null,\"id\":1}", test.result)
+			fmt.Fprintln(w, response)
+		}))
+		connConfig := &btcrpcclient.ConnConfig{
+			Host:         ts.URL[7:],
+			HttpPostMode: true,
+			DisableTLS:   true,
+		}
+		b, err := gochroma.NewBtcdBlockExplorer(&btcnet.TestNet3Params, connConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Execute
+		got, err := b.EstimateFeeRate(6)
+		ts.Close()
+
+		// Verify
+		if test.err != -1 {
+			if err == nil {
+				t.Errorf("%v: expected error, got nil", test.result)
+				continue
+			}
+			rerr := err.(gochroma.ChromaError)
+			want := gochroma.ErrorCode(test.err)
+			if rerr.ErrorCode != want {
+				t.Errorf("%v: wrong error, want %v, got %v", test.result, want, rerr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: got error %v", test.result, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%v: got rate %d, want %d", test.result, got, test.want)
+		}
+	}
+}
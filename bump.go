@@ -0,0 +1,206 @@
+package gochroma
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// MaxRBFSequence is the highest nSequence of an input that signals the tx
+// can be replaced by one paying a higher fee, as in BIP 125.
+const MaxRBFSequence = uint32(0xfffffffd)
+
+// SignalsRBF returns whether any input of the tx signals that it can be
+// replaced. The markers of EPOBC, REPOBC and an SPOBC genesis are all below
+// MaxRBFSequence, so the txs they tag always signal.
+func SignalsRBF(tx *btcwire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence <= MaxRBFSequence {
+			return true
+		}
+	}
+	return false
+}
+
+// SignalRBF makes the unsigned tx signal replaceability with the kernels
+// in DefaultKernelRegistry.
+func SignalRBF(tx *btcwire.MsgTx) error {
+	return DefaultKernelRegistry.SignalRBF(tx)
+}
+
+// SignalRBF makes the unsigned tx signal that it can be replaced. The
+// first input carries the color marker, so the signal goes in the last
+// input when there's more than one. A tx with only the first input is an
+// ErrRBFConflict error if a kernel in the registry would read the signal
+// as its marker.
+func (r *KernelRegistry) SignalRBF(tx *btcwire.MsgTx) error {
+	if len(tx.TxIn) == 0 {
+		return MakeError(ErrInvalidTx, "transaction has no inputs", nil)
+	}
+	if SignalsRBF(tx) {
+		return nil
+	}
+	last := tx.TxIn[len(tx.TxIn)-1]
+	if len(tx.TxIn) > 1 {
+		last.Sequence = MaxRBFSequence
+		return nil
+	}
+
+	before, err := r.ClassifyTx(tx)
+	if err != nil {
+		return err
+	}
+	sequence := last.Sequence
+	last.Sequence = MaxRBFSequence
+	after, err := r.ClassifyTx(tx)
+	if err != nil {
+		return err
+	}
+	if after.Kind != before.Kind || after.Code != before.Code {
+		last.Sequence = sequence
+		str := fmt.Sprintf("nSequence %x of the only input would tag the tx as a %v %v",
+			MaxRBFSequence, after.Code, after.Kind)
+		return MakeError(ErrRBFConflict, str, nil)
+	}
+	return nil
+}
+
+// colorFlows returns the flow of every color through the tx.
+func colorFlows(b *BlockExplorer, defs []*ColorDefinition, tx *btcwire.MsgTx) ([]*ColorFlow, error) {
+	flows := make([]*ColorFlow, len(defs))
+	for i, cd := range defs {
+		var err error
+		flows[i], err = colorFlow(b, cd, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return flows, nil
+}
+
+// checkUncolored returns an ErrDestroyColorValue error if the output of
+// the tx has color value in any of the flows.
+func checkUncolored(flows []*ColorFlow, index int) error {
+	for _, flow := range flows {
+		if flow.Outputs[index] > 0 {
+			str := fmt.Sprintf("output %d has %d color value of %v",
+				index, flow.Outputs[index], flow.Definition)
+			return MakeError(ErrDestroyColorValue, str, nil)
+		}
+	}
+	return nil
+}
+
+// BumpFee returns the unsigned replacement of the tx, paying fee more
+// out of the uncolored change output at changeIndex. Inputs and outputs
+// keep their order and the first input its nSequence, so the colors of
+// the definitions move just as in the tx, which is checked. Change left
+// as dust under the policy goes to the fee when it's the last output.
+// The tx has to signal replaceability, see SignalRBF, or it's an
+// ErrRBFConflict error.
+func BumpFee(b *BlockExplorer, defs []*ColorDefinition, tx *btcwire.MsgTx,
+	changeIndex int, fee int64, dust *DustPolicy) (*btcwire.MsgTx, error) {
+
+	if !SignalsRBF(tx) {
+		return nil, MakeError(ErrRBFConflict, "tx does not signal that it can be replaced", nil)
+	}
+	if changeIndex < 0 || changeIndex >= len(tx.TxOut) {
+		str := fmt.Sprintf("tx has no output %d", changeIndex)
+		return nil, MakeError(ErrBadOutputIndex, str, nil)
+	}
+	if fee <= 0 {
+		str := fmt.Sprintf("fee has to go up, not by %d", fee)
+		return nil, MakeError(ErrNegativeValue, str, nil)
+	}
+	flows, err := colorFlows(b, defs, tx)
+	if err != nil {
+		return nil, err
+	}
+	err = checkUncolored(flows, changeIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement := tx.Copy()
+	for _, txIn := range replacement.TxIn {
+		txIn.SignatureScript = nil
+	}
+	change := replacement.TxOut[changeIndex]
+	if change.Value < fee {
+		str := fmt.Sprintf("change has %d satoshi, need %d satoshi more fee",
+			change.Value, fee)
+		return nil, MakeError(ErrInsufficientFunds, str, nil)
+	}
+	change.Value -= fee
+	if dust.IsDust(change) {
+		// dropping any other output would shift the ones after it
+		if changeIndex != len(replacement.TxOut)-1 {
+			str := fmt.Sprintf("change of %d satoshi is dust and not the last output",
+				change.Value)
+			return nil, MakeError(ErrDust, str, nil)
+		}
+		replacement.TxOut = replacement.TxOut[:changeIndex]
+	}
+
+	bumped, err := colorFlows(b, defs, replacement)
+	if err != nil {
+		return nil, err
+	}
+	for i, flow := range bumped {
+		for j, cv := range flow.Outputs {
+			if cv != flows[i].Outputs[j] {
+				str := fmt.Sprintf("output %d of the replacement has %d color value of %v, not %d",
+					j, cv, flow.Definition, flows[i].Outputs[j])
+				return nil, MakeError(ErrRBFConflict, str, nil)
+			}
+		}
+	}
+	return replacement, nil
+}
+
+// ChildPaysForParent returns the unsigned tx spending the output of the
+// parent at index to the change script with the fee given, so that
+// miners take the parent to get the fee of the child. The child isn't
+// tagged, so the output can't have color value of any of the definitions
+// or it would be destroyed, and what's left after the fee can't be dust
+// under the policy.
+func ChildPaysForParent(b *BlockExplorer, defs []*ColorDefinition,
+	parent *btcwire.MsgTx, index int, changeScript []byte,
+	fee int64, dust *DustPolicy) (*btcwire.MsgTx, error) {
+
+	if index < 0 || index >= len(parent.TxOut) {
+		str := fmt.Sprintf("parent has no output %d", index)
+		return nil, MakeError(ErrBadOutputIndex, str, nil)
+	}
+	if fee < 0 {
+		str := fmt.Sprintf("fee is negative: %d", fee)
+		return nil, MakeError(ErrNegativeValue, str, nil)
+	}
+	flows, err := colorFlows(b, defs, parent)
+	if err != nil {
+		return nil, err
+	}
+	err = checkUncolored(flows, index)
+	if err != nil {
+		return nil, err
+	}
+
+	shaHash, err := parent.TxSha()
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	value := parent.TxOut[index].Value
+	if value < fee {
+		str := fmt.Sprintf("have %d satoshi, need %d satoshi for the fee", value, fee)
+		return nil, MakeError(ErrInsufficientFunds, str, nil)
+	}
+	child := btcwire.NewMsgTx()
+	child.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(&shaHash, uint32(index)), nil))
+	txOut := btcwire.NewTxOut(value-fee, changeScript)
+	if dust.IsDust(txOut) {
+		str := fmt.Sprintf("output of %d satoshi left after the fee is dust", txOut.Value)
+		return nil, MakeError(ErrDust, str, nil)
+	}
+	child.AddTxOut(txOut)
+	return child, nil
+}
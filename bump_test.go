@@ -0,0 +1,290 @@
+package gochroma_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+// tstRBFKernel takes the nSequence signalling RBF for its marker
+type tstRBFKernel struct {
+	gochroma.SPOBC
+}
+
+func (k tstRBFKernel) Code() string {
+	return "RBF"
+}
+
+func (k tstRBFKernel) DetectMarker(sequence gochroma.BitList) *gochroma.TxMarker {
+	if sequence.Uint32() != gochroma.MaxRBFSequence {
+		return nil
+	}
+	return &gochroma.TxMarker{Code: k.Code(), Kind: gochroma.TxKindTransfer}
+}
+
+// tstBumpable sets up an EPOBC transfer of 100 color value funded by the
+// change of the genesis, with its own change last
+func tstBumpable(t *testing.T) (*kerneltest.MemChain, *gochroma.ColorDefinition, *btcwire.MsgTx) {
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	group := &gochroma.ColorGroup{
+		Definition: cd,
+		Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}},
+		Outputs:    []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 100}},
+	}
+	funding := btcwire.NewOutPoint(&cd.Genesis.Hash, 1)
+	tx, err := epobc.(gochroma.MultiColorKernel).MultiColorTx(b,
+		[]*gochroma.ColorGroup{group}, []*btcwire.OutPoint{funding}, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	return chain, cd, tx
+}
+
+func TestBumpFee(t *testing.T) {
+	// Setup
+	chain, cd, tx := tstBumpable(t)
+	b := chain.NewBlockExplorer()
+	defs := []*gochroma.ColorDefinition{cd}
+
+	// Execute
+	replacement, err := gochroma.BumpFee(b, defs, tx, 1, 5000, gochroma.DefaultDustPolicy)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to bump fee: %v", err)
+	}
+	if replacement.TxIn[0].Sequence != tx.TxIn[0].Sequence {
+		t.Errorf("marker changed: got %x, want %x",
+			replacement.TxIn[0].Sequence, tx.TxIn[0].Sequence)
+	}
+	if replacement.TxOut[1].Value != tx.TxOut[1].Value-5000 {
+		t.Errorf("change is %d, want %d", replacement.TxOut[1].Value, tx.TxOut[1].Value-5000)
+	}
+	if !reflect.DeepEqual(replacement.TxOut[0], tx.TxOut[0]) {
+		t.Errorf("colored output changed: got %v, want %v", replacement.TxOut[0], tx.TxOut[0])
+	}
+	report, err := gochroma.ValidateColorTx(b, defs, replacement, gochroma.DefaultDustPolicy)
+	if err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("replacement is invalid: %v", report.Err())
+	}
+}
+
+func TestBumpFeeError(t *testing.T) {
+	// Setup
+	chain, cd, tx := tstBumpable(t)
+	b := chain.NewBlockExplorer()
+	defs := []*gochroma.ColorDefinition{cd}
+	final := tx.Copy()
+	final.TxIn[0].Sequence = btcwire.MaxTxInSequenceNum
+	final.TxIn[1].Sequence = btcwire.MaxTxInSequenceNum
+
+	tests := []struct {
+		desc        string
+		tx          *btcwire.MsgTx
+		changeIndex int
+		fee         int64
+		err         int
+	}{
+		{"not signalling", final, 1, 5000, gochroma.ErrRBFConflict},
+		{"colored change", tx, 0, 5000, gochroma.ErrDestroyColorValue},
+		{"no output", tx, 2, 5000, gochroma.ErrBadOutputIndex},
+		{"too much fee", tx, 1, tx.TxOut[1].Value + 1, gochroma.ErrInsufficientFunds},
+		{"no bump", tx, 1, 0, gochroma.ErrNegativeValue},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := gochroma.BumpFee(b, defs, test.tx, test.changeIndex, test.fee, gochroma.DefaultDustPolicy)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
+
+func TestSignalRBF(t *testing.T) {
+	// Setup
+	conflicting := gochroma.NewKernelRegistry()
+	err := conflicting.Register(&tstRBFKernel{})
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	single := func() *btcwire.MsgTx {
+		tx := btcwire.NewMsgTx()
+		tx.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(&btcwire.ShaHash{}, 0), nil))
+		tx.AddTxOut(btcwire.NewTxOut(1000, tstScript(0)))
+		return tx
+	}
+	double := single()
+	double.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(&btcwire.ShaHash{}, 1), nil))
+
+	tests := []struct {
+		desc     string
+		registry *gochroma.KernelRegistry
+		tx       *btcwire.MsgTx
+		// input that should signal, -1 for none
+		signal int
+		err    int
+	}{
+		{"single input", gochroma.DefaultKernelRegistry, single(), 0, -1},
+		{"leaves the marker", gochroma.DefaultKernelRegistry, double, 1, -1},
+		{"conflict", conflicting, single(), -1, gochroma.ErrRBFConflict},
+	}
+
+	for _, test := range tests {
+		// Execute
+		err := test.registry.SignalRBF(test.tx)
+
+		// Verify
+		if test.err != -1 {
+			if err == nil {
+				t.Errorf("%v: expected error, got nil", test.desc)
+				continue
+			}
+			rerr := err.(gochroma.ChromaError)
+			want := gochroma.ErrorCode(test.err)
+			if rerr.ErrorCode != want {
+				t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+			}
+			if gochroma.SignalsRBF(test.tx) {
+				t.Errorf("%v: signals after a conflict", test.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: failed to signal: %v", test.desc, err)
+			continue
+		}
+		for i, txIn := range test.tx.TxIn {
+			signals := txIn.Sequence <= gochroma.MaxRBFSequence
+			if signals != (i == test.signal) {
+				t.Errorf("%v: input %d has nSequence %x", test.desc, i, txIn.Sequence)
+			}
+		}
+	}
+}
+
+func TestChildPaysForParent(t *testing.T) {
+	// Setup
+	chain, cd, parent := tstBumpable(t)
+	b := chain.NewBlockExplorer()
+	defs := []*gochroma.ColorDefinition{cd}
+	shaHash, err := parent.TxSha()
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+
+	tests := []struct {
+		desc  string
+		index int
+		fee   int64
+		dust  *gochroma.DustPolicy
+		err   int
+	}{
+		{"change", 1, 5000, gochroma.DefaultDustPolicy, -1},
+		{"colored", 0, 5000, gochroma.DefaultDustPolicy, gochroma.ErrDestroyColorValue},
+		{"dust", 1, parent.TxOut[1].Value - 100, gochroma.DefaultDustPolicy, gochroma.ErrDust},
+		{"dust without a policy", 1, parent.TxOut[1].Value - 100, nil, -1},
+	}
+
+	for _, test := range tests {
+		// Execute
+		child, err := gochroma.ChildPaysForParent(b, defs, parent, test.index, tstScript(0), test.fee, test.dust)
+
+		// Verify
+		if test.err != -1 {
+			if err == nil {
+				t.Errorf("%v: expected error, got nil", test.desc)
+				continue
+			}
+			rerr := err.(gochroma.ChromaError)
+			want := gochroma.ErrorCode(test.err)
+			if rerr.ErrorCode != want {
+				t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: failed to make child: %v", test.desc, err)
+			continue
+		}
+		want := btcwire.NewOutPoint(&shaHash, uint32(test.index))
+		if !reflect.DeepEqual(&child.TxIn[0].PreviousOutPoint, want) {
+			t.Errorf("%v: child spends %v, want %v", test.desc, child.TxIn[0].PreviousOutPoint, want)
+		}
+		if child.TxOut[0].Value != parent.TxOut[test.index].Value-test.fee {
+			t.Errorf("%v: child pays %d, want %d", test.desc,
+				parent.TxOut[test.index].Value-child.TxOut[0].Value, test.fee)
+		}
+	}
+}
+
+func TestChildPaysForParentUnconfirmed(t *testing.T) {
+	// Setup
+	chain, cd, grandparent := tstBumpable(t)
+	b := chain.NewBlockExplorer()
+	defs := []*gochroma.ColorDefinition{cd}
+	// neither the parent nor the tx it spends from is mined
+	grandHash, err := b.PublishTx(grandparent)
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	group := &gochroma.ColorGroup{
+		Definition: cd,
+		Inputs: []*gochroma.ColorIn{
+			&gochroma.ColorIn{btcwire.NewOutPoint(grandHash, 0), 100}},
+		Outputs: []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(3), 100}},
+	}
+	funding := btcwire.NewOutPoint(grandHash, 1)
+	parent, err := cd.ColorKernel.(gochroma.MultiColorKernel).MultiColorTx(b,
+		[]*gochroma.ColorGroup{group}, []*btcwire.OutPoint{funding}, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	_, err = b.PublishTx(parent)
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	// Execute
+	child, err := gochroma.ChildPaysForParent(b, defs, parent, 1, tstScript(0), 5000,
+		gochroma.DefaultDustPolicy)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to make child: %v", err)
+	}
+	_, err = b.PublishTx(child)
+	if err != nil {
+		t.Fatalf("failed to publish child: %v", err)
+	}
+	_, err = gochroma.ChildPaysForParent(b, defs, parent, 0, tstScript(0), 5000,
+		gochroma.DefaultDustPolicy)
+	if err == nil {
+		t.Fatalf("spent the colored output of the parent")
+	}
+	rerr := err.(gochroma.ChromaError)
+	want := gochroma.ErrorCode(gochroma.ErrDestroyColorValue)
+	if rerr.ErrorCode != want {
+		t.Errorf("wrong error, want %v, got %v", want, rerr)
+	}
+}
@@ -0,0 +1,193 @@
+package gochroma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// BurnTag starts the data of the OP_RETURN output that marks a burn. The
+// first 20 bytes of the hash of the color definition and the color value
+// burned follow it, so that the data stays within the 40 bytes nodes
+// relay OP_RETURN outputs with.
+var BurnTag = []byte("BURN")
+
+const (
+	opReturn = 0x6a
+	// bytes of the definition hash a burn script has
+	burnHashLen = 20
+	// tag, definition hash and 8 bytes of color value
+	burnDataLen = 4 + burnHashLen + 8
+)
+
+// Burn is color value provably destroyed by a tx.
+type Burn struct {
+	Hash       btcwire.ShaHash
+	Definition *ColorDefinition
+	ColorValue ColorValue
+}
+
+// BurnScript returns the OP_RETURN script claiming that the color value
+// of the color is burned.
+func BurnScript(c *ColorDefinition, cv ColorValue) []byte {
+	script := []byte{opReturn, burnDataLen}
+	script = append(script, BurnTag...)
+	script = append(script, c.Hash()[:burnHashLen]...)
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(cv))
+	return append(script, buf...)
+}
+
+// parseBurnScript returns the start of the definition hash and the color
+// value of a burn script, or nil if the script isn't one.
+func parseBurnScript(script []byte) ([]byte, ColorValue) {
+	if len(script) != 2+burnDataLen || script[0] != opReturn ||
+		script[1] != burnDataLen || !bytes.HasPrefix(script[2:], BurnTag) {
+		return nil, 0
+	}
+	data := script[2+len(BurnTag):]
+	return data[:burnHashLen], ColorValue(binary.LittleEndian.Uint64(data[burnHashLen:]))
+}
+
+// burnOutputs returns the indexes of the outputs of the tx with burn
+// scripts. A tx can only burn once, so more than one is an error.
+func burnOutputs(tx *btcwire.MsgTx) []int {
+	var indexes []int
+	for i, txOut := range tx.TxOut {
+		hash, _ := parseBurnScript(txOut.PkScript)
+		if hash != nil {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// BurningTx returns the unsigned tx destroying whatever color value of
+// the inputs the outputs don't get, with a burn script saying how much
+// in its last output. The kernel is checked to really destroy that much.
+func (c *ColorDefinition) BurningTx(b *BlockExplorer, inputs []*ColorIn,
+	outputs []*ColorOut, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
+
+	inSum, outSum := ColorValue(0), ColorValue(0)
+	for _, in := range inputs {
+		var err error
+		inSum, err = inSum.Add(in.ColorValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range outputs {
+		var err error
+		outSum, err = outSum.Add(out.ColorValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if inSum <= outSum {
+		str := fmt.Sprintf("inputs have %d color value, outputs get %d", inSum, outSum)
+		return nil, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	burned := inSum - outSum
+
+	tx, err := c.TransferringTx(b, inputs, outputs, changeScript, fee, true)
+	if err != nil {
+		return nil, err
+	}
+	tx.AddTxOut(btcwire.NewTxOut(0, BurnScript(c, burned)))
+
+	destroyed, err := c.destroyed(b, tx)
+	if err != nil {
+		return nil, err
+	}
+	if destroyed != burned {
+		str := fmt.Sprintf("%v destroys %d color value, not %d", c.Code(),
+			destroyed, burned)
+		return nil, MakeError(ErrBadBurn, str, nil)
+	}
+	return tx, nil
+}
+
+// destroyed returns the color value of the inputs of the tx which none
+// of its outputs get.
+func (c *ColorDefinition) destroyed(b *BlockExplorer, tx *btcwire.MsgTx) (ColorValue, error) {
+	inputs := make([]ColorValue, len(tx.TxIn))
+	inSum := ColorValue(0)
+	for i, txIn := range tx.TxIn {
+		// the inputs may be spent already, so go by the provenance
+		p, err := c.Provenance(b, &txIn.PreviousOutPoint)
+		if err != nil {
+			return 0, err
+		}
+		inputs[i] = p.ColorValue
+		inSum, err = inSum.Add(p.ColorValue)
+		if err != nil {
+			return 0, err
+		}
+	}
+	outputs, err := c.RunKernelOnChain(b, tx, inputs)
+	if err != nil {
+		return 0, err
+	}
+	outSum := ColorValue(0)
+	for _, cv := range outputs {
+		outSum, err = outSum.Add(cv)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if outSum > inSum {
+		return 0, nil
+	}
+	return inSum - outSum, nil
+}
+
+// VerifyBurn looks up the tx and checks that it destroys the color value
+// its burn script claims, of whichever of the definitions it names. A tx
+// with more than one burn script is an ErrBadBurn error.
+func VerifyBurn(b *BlockExplorer, defs []*ColorDefinition, shaHash *btcwire.ShaHash) (*Burn, error) {
+	utilTx, err := b.Tx(BigEndianBytes(shaHash))
+	if err != nil {
+		return nil, err
+	}
+	tx := utilTx.MsgTx()
+
+	indexes := burnOutputs(tx)
+	if len(indexes) == 0 {
+		str := fmt.Sprintf("tx %v has no burn script", shaHash)
+		return nil, MakeError(ErrBadBurn, str, nil)
+	}
+	if len(indexes) > 1 {
+		str := fmt.Sprintf("tx %v has %d burn scripts", shaHash, len(indexes))
+		return nil, MakeError(ErrBadBurn, str, nil)
+	}
+	hash, claimed := parseBurnScript(tx.TxOut[indexes[0]].PkScript)
+	var cd *ColorDefinition
+	for _, def := range defs {
+		if bytes.HasPrefix(def.Hash(), hash) {
+			cd = def
+			break
+		}
+	}
+	if cd == nil {
+		str := fmt.Sprintf("tx %v burns a color none of the definitions have", shaHash)
+		return nil, MakeError(ErrBadBurn, str, nil)
+	}
+
+	destroyed, err := cd.destroyed(b, tx)
+	if err != nil {
+		return nil, err
+	}
+	if destroyed != claimed {
+		str := fmt.Sprintf("tx %v destroys %d color value of %v, claims %d",
+			shaHash, destroyed, cd, claimed)
+		return nil, MakeError(ErrBadBurn, str, nil)
+	}
+	return &Burn{
+		Hash:       *shaHash,
+		Definition: cd,
+		ColorValue: destroyed,
+	}, nil
+}
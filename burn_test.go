@@ -0,0 +1,253 @@
+package gochroma_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestBurn(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	// enough that neither what's kept nor what's burned is padded, and the
+	// change is more than dust
+	cd := tstIssue(t, chain, epobc, 20000)
+	other := tstIssue(t, chain, epobc, 100)
+	spobcCd := tstIssue(t, chain, spobc, 1)
+	defs := []*gochroma.ColorDefinition{other, cd, spobcCd}
+
+	// Execute
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 20000}}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 10000}}
+	partTx, err := cd.BurningTx(b, inputs, outputs, tstScript(0), 0)
+	if err != nil {
+		t.Fatalf("failed to make burning tx: %v", err)
+	}
+	partHash := tstPublish(t, chain, partTx)
+	kept := btcwire.NewOutPoint(partHash, 0)
+	inputs = []*gochroma.ColorIn{&gochroma.ColorIn{kept, 10000}}
+	allTx, err := cd.BurningTx(b, inputs, nil, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make burning tx: %v", err)
+	}
+	allHash := tstPublish(t, chain, allTx)
+	inputs = []*gochroma.ColorIn{&gochroma.ColorIn{spobcCd.Genesis, 1}}
+	spobcTx, err := spobcCd.BurningTx(b, inputs, nil, tstScript(0), 0)
+	if err != nil {
+		t.Fatalf("failed to make burning tx: %v", err)
+	}
+	spobcHash := tstPublish(t, chain, spobcTx)
+
+	// Verify
+	tests := []struct {
+		desc    string
+		tx      *btcwire.MsgTx
+		shaHash *btcwire.ShaHash
+		cd      *gochroma.ColorDefinition
+		cv      gochroma.ColorValue
+	}{
+		{"part", partTx, partHash, cd, 10000},
+		{"all", allTx, allHash, cd, 10000},
+		{"spobc", spobcTx, spobcHash, spobcCd, 1},
+	}
+	for _, test := range tests {
+		burn, err := gochroma.VerifyBurn(b, defs, test.shaHash)
+		if err != nil {
+			t.Errorf("%v: failed to verify burn: %v", test.desc, err)
+			continue
+		}
+		if burn.Definition != test.cd {
+			t.Errorf("%v: wrong definition: got %v, want %v", test.desc, burn.Definition, test.cd)
+		}
+		if burn.ColorValue != test.cv {
+			t.Errorf("%v: wrong color value: got %d, want %d", test.desc, burn.ColorValue, test.cv)
+		}
+		if !burn.Hash.IsEqual(test.shaHash) {
+			t.Errorf("%v: wrong hash: got %v, want %v", test.desc, burn.Hash, test.shaHash)
+		}
+		// the change is kept, and none of the color value with it
+		change := -1
+		for i, txOut := range test.tx.TxOut {
+			if bytes.Equal(txOut.PkScript, tstScript(0)) {
+				change = i
+			}
+		}
+		if change == -1 {
+			t.Errorf("%v: no change output", test.desc)
+			continue
+		}
+		cv, err := test.cd.ColorValue(b, btcwire.NewOutPoint(test.shaHash, uint32(change)))
+		if err != nil {
+			t.Errorf("%v: failed to get color value: %v", test.desc, err)
+			continue
+		}
+		if *cv != 0 {
+			t.Errorf("%v: change has color value %d", test.desc, *cv)
+		}
+	}
+	cv, err := cd.ColorValue(b, kept)
+	if err != nil {
+		t.Fatalf("failed to get color value: %v", err)
+	}
+	if *cv != 0 {
+		t.Errorf("burned output still has color value %d", *cv)
+	}
+}
+
+func TestBurnScript(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(&btcwire.ShaHash{1}, 0), 0)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+
+	// Execute
+	script := gochroma.BurnScript(cd, 0x0102)
+
+	// Verify
+	// OP_RETURN and one push of at most the 40 bytes nodes relay
+	if len(script) > 2+40 || int(script[1]) != len(script)-2 {
+		t.Fatalf("script too long to relay: %x", script)
+	}
+	want := append([]byte{0x6a, 32}, gochroma.BurnTag...)
+	want = append(want, cd.Hash()[:20]...)
+	want = append(want, 0x02, 0x01, 0, 0, 0, 0, 0, 0)
+	if !bytes.Equal(script, want) {
+		t.Fatalf("wrong script: got %x, want %x", script, want)
+	}
+}
+
+func TestBurningTxError(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+
+	tests := []struct {
+		desc    string
+		cd      *gochroma.ColorDefinition
+		inputs  []*gochroma.ColorIn
+		outputs []*gochroma.ColorOut
+		err     int
+	}{
+		{
+			desc:    "nothing burned",
+			cd:      cd,
+			inputs:  []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}},
+			outputs: []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 100}},
+			err:     gochroma.ErrInvalidColorValue,
+		},
+		{
+			desc:   "no inputs",
+			cd:     cd,
+			inputs: nil,
+			err:    gochroma.ErrInvalidColorValue,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := test.cd.BurningTx(b, test.inputs, test.outputs, tstScript(0), 0)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
+func TestVerifyBurnError(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	other := tstIssue(t, chain, epobc, 100)
+
+	// a transfer claiming to burn what it sends on
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 100}}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, false)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	tx.AddTxOut(btcwire.NewTxOut(0, gochroma.BurnScript(cd, 100)))
+	forged := tstPublish(t, chain, tx)
+
+	// a real burn
+	inputs = []*gochroma.ColorIn{&gochroma.ColorIn{other.Genesis, 100}}
+	tx, err = other.BurningTx(b, inputs, nil, tstScript(0), 0)
+	if err != nil {
+		t.Fatalf("failed to make burning tx: %v", err)
+	}
+	burn := tstPublish(t, chain, tx)
+
+	// a real burn with a second burn script claiming more
+	third := tstIssue(t, chain, epobc, 100)
+	inputs = []*gochroma.ColorIn{&gochroma.ColorIn{third.Genesis, 100}}
+	tx, err = third.BurningTx(b, inputs, nil, tstScript(0), 0)
+	if err != nil {
+		t.Fatalf("failed to make burning tx: %v", err)
+	}
+	tx.AddTxOut(btcwire.NewTxOut(0, gochroma.BurnScript(third, 200)))
+	twice := tstPublish(t, chain, tx)
+	transfer := tstTransfer(t, chain, cd, btcwire.NewOutPoint(forged, 0), 100)
+
+	tests := []struct {
+		desc    string
+		defs    []*gochroma.ColorDefinition
+		shaHash *btcwire.ShaHash
+	}{
+		{"forged", []*gochroma.ColorDefinition{cd}, forged},
+		{"unknown color", []*gochroma.ColorDefinition{cd}, burn},
+		{"not a burn", []*gochroma.ColorDefinition{cd}, &transfer.Hash},
+		{"two burn scripts", []*gochroma.ColorDefinition{third}, twice},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := gochroma.VerifyBurn(b, test.defs, test.shaHash)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(gochroma.ErrBadBurn)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package gochroma
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// colorChangeIndexer is implemented by kernels where the color value of
+// an input goes to the output at the same index rather than to the next
+// output in order.
+type colorChangeIndexer interface {
+	// Returns the index the colored change of the inputs has to go to
+	colorChangeIndex(inputs []*ColorIn) int
+}
+
+// withColorChange returns the outputs followed by an output to the script
+// with the color value of the inputs beyond that of the outputs, if any.
+// Order-based kernels give the change what's left after the outputs, so
+// it goes after them; SPOBC sends it to the index of its input, which has
+// to be the next one.
+func withColorChange(kernel ColorKernel, inputs []*ColorIn, outputs []*ColorOut, script []byte) ([]*ColorOut, error) {
+	inSum, outSum := ColorValue(0), ColorValue(0)
+	for _, in := range inputs {
+		var err error
+		inSum, err = inSum.Add(in.ColorValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range outputs {
+		var err error
+		outSum, err = outSum.Add(out.ColorValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if inSum <= outSum {
+		return outputs, nil
+	}
+	indexer, ok := kernel.(colorChangeIndexer)
+	if ok {
+		index := indexer.colorChangeIndex(inputs)
+		if index != len(outputs) {
+			str := fmt.Sprintf("colored change has to go to output %d, not %d",
+				index, len(outputs))
+			return nil, MakeError(ErrBadOutputIndex, str, nil)
+		}
+	}
+	change := &ColorOut{Script: script, ColorValue: inSum - outSum}
+	return append(append([]*ColorOut{}, outputs...), change), nil
+}
+
+// TransferringTxWithChange is TransferringTx with the color value of the
+// inputs beyond what the outputs take going to a colored change output to
+// the color change script, padded like the outputs, instead of being
+// destroyed.
+func (c *ColorDefinition) TransferringTxWithChange(b *BlockExplorer, inputs []*ColorIn,
+	outputs []*ColorOut, colorChangeScript, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
+	outputs, err := withColorChange(c.ColorKernel, inputs, outputs, colorChangeScript)
+	if err != nil {
+		return nil, err
+	}
+	return c.TransferringTx(b, inputs, outputs, changeScript, fee, false)
+}
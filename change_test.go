@@ -0,0 +1,142 @@
+package gochroma_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestTransferringTxWithChange(t *testing.T) {
+	tests := []struct {
+		key     string
+		issued  gochroma.ColorValue
+		outputs []gochroma.ColorValue
+		want    []gochroma.ColorValue
+	}{
+		// the color value goes back to its own index
+		{SPOBCKey, 1, nil, []gochroma.ColorValue{1}},
+		{SPOBCKey, 1, []gochroma.ColorValue{1}, []gochroma.ColorValue{1}},
+		{EPOBCKey, 100, []gochroma.ColorValue{100}, []gochroma.ColorValue{100}},
+	}
+
+	for _, test := range tests {
+		// Setup
+		kernel, err := gochroma.GetColorKernel(test.key)
+		if err != nil {
+			t.Fatalf("error getting %v kernel: %v", test.key, err)
+		}
+		chain := kerneltest.NewMemChain()
+		b := chain.NewBlockExplorer()
+		cd := tstIssue(t, chain, kernel, test.issued)
+		inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, test.issued}}
+		var outputs []*gochroma.ColorOut
+		for _, cv := range test.outputs {
+			outputs = append(outputs, &gochroma.ColorOut{tstScript(2), cv})
+		}
+
+		// Execute
+		tx, err := cd.TransferringTxWithChange(b, inputs, outputs, tstScript(3), tstScript(0), 0)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: failed to make tx: %v", test.key, err)
+			continue
+		}
+		got, err := cd.RunKernelOnChain(b, tx, []gochroma.ColorValue{test.issued})
+		if err != nil {
+			t.Fatalf("%v: failed to run kernel: %v", test.key, err)
+		}
+		if !reflect.DeepEqual(got[:len(test.want)], test.want) {
+			t.Errorf("%v: color values %v, want %v", test.key, got, test.want)
+		}
+		if len(test.outputs) < len(test.want) &&
+			!bytes.Equal(tx.TxOut[len(test.outputs)].PkScript, tstScript(3)) {
+			t.Errorf("%v: change is not to the color change script", test.key)
+		}
+	}
+}
+
+func TestMultiColorTxChange(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd1 := tstIssue(t, chain, epobc, 100)
+	cd2 := tstIssue(t, chain, epobc, 70)
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+	groups := []*gochroma.ColorGroup{
+		&gochroma.ColorGroup{
+			Definition: cd1,
+			Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cd1.Genesis, 100}},
+			Outputs:    []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 60}},
+			Change:     tstScript(3),
+		},
+		&gochroma.ColorGroup{
+			Definition: cd2,
+			Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cd2.Genesis, 70}},
+			Outputs:    []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(4), 70}},
+			Change:     tstScript(3),
+		},
+	}
+
+	// Execute
+	tx, err := epobc.(gochroma.MultiColorKernel).MultiColorTx(b, groups,
+		[]*btcwire.OutPoint{funding}, tstScript(0), 1000)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to make tx: %v", err)
+	}
+	report, err := gochroma.ValidateColorTx(b, []*gochroma.ColorDefinition{cd1, cd2}, tx, gochroma.DefaultDustPolicy)
+	if err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("tx is invalid: %v", report.Err())
+	}
+	want := [][]gochroma.ColorValue{{60, 40, 0, 0}, {0, 0, 70, 0}}
+	for i, flow := range report.Flows {
+		if !reflect.DeepEqual(flow.Outputs, want[i]) {
+			t.Errorf("color %d: got %v, want %v", i, flow.Outputs, want[i])
+		}
+	}
+}
+
+func TestTransferringTxWithChangeError(t *testing.T) {
+	// Setup
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, spobc, 1)
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+	// the color value is in the second input so can't go to the first output
+	inputs := []*gochroma.ColorIn{
+		&gochroma.ColorIn{funding, 0},
+		&gochroma.ColorIn{cd.Genesis, 1},
+	}
+
+	// Execute
+	_, err = cd.TransferringTxWithChange(b, inputs, nil, tstScript(3), tstScript(0), 0)
+
+	// Verify
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	want := gochroma.ErrorCode(gochroma.ErrBadOutputIndex)
+	if rerr.ErrorCode != want {
+		t.Errorf("wrong error, want %v, got %v", want, rerr)
+	}
+}
@@ -0,0 +1,440 @@
+package gochroma
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// Utxo is an unspent output that can fund a colored transaction.
+type Utxo struct {
+	OutPoint *btcwire.OutPoint
+	PkScript []byte
+	Value    int64
+	// color the output holds, nil for plain bitcoin
+	Definition *ColorDefinition
+	ColorValue ColorValue
+}
+
+// CoinSelector picks which candidates to spend.
+type CoinSelector interface {
+	// Returns candidates whose amounts add up to at least the target,
+	// or an ErrInsufficientFunds error if they can't
+	SelectCoins(candidates []*Utxo, amount func(*Utxo) uint64, target uint64) ([]*Utxo, error)
+}
+
+// FeePolicy decides the fee of a transaction.
+type FeePolicy interface {
+	// Returns the fee of a tx with the number of inputs and outputs given
+	Fee(inputs, outputs int) int64
+}
+
+// FlatFee is the same fee whatever the size of the tx.
+type FlatFee int64
+
+func (f FlatFee) Fee(inputs, outputs int) int64 {
+	return int64(f)
+}
+
+func insufficient(total, target uint64) error {
+	str := fmt.Sprintf("candidates have %d, need %d", total, target)
+	return MakeError(ErrInsufficientFunds, str, nil)
+}
+
+// byAmount sorts utxos from the largest amount down.
+type byAmount struct {
+	utxos  []*Utxo
+	amount func(*Utxo) uint64
+}
+
+func (s byAmount) Len() int           { return len(s.utxos) }
+func (s byAmount) Less(i, j int) bool { return s.amount(s.utxos[i]) > s.amount(s.utxos[j]) }
+func (s byAmount) Swap(i, j int)      { s.utxos[i], s.utxos[j] = s.utxos[j], s.utxos[i] }
+
+// sortedByAmount returns the candidates from the largest amount down,
+// keeping the order of those with the same amount.
+func sortedByAmount(candidates []*Utxo, amount func(*Utxo) uint64) []*Utxo {
+	sorted := append([]*Utxo{}, candidates...)
+	sort.Stable(byAmount{sorted, amount})
+	return sorted
+}
+
+// LargestFirst spends the largest candidates until the target is met,
+// which keeps the number of inputs down.
+type LargestFirst struct{}
+
+func (s LargestFirst) SelectCoins(candidates []*Utxo, amount func(*Utxo) uint64, target uint64) ([]*Utxo, error) {
+	var selected []*Utxo
+	sum := uint64(0)
+	for _, utxo := range sortedByAmount(candidates, amount) {
+		if sum >= target {
+			break
+		}
+		selected = append(selected, utxo)
+		sum += amount(utxo)
+	}
+	if sum < target {
+		return nil, insufficient(sum, target)
+	}
+	return selected, nil
+}
+
+// BranchAndBound looks for candidates adding up to the target or at
+// most Tolerance more, so that no change is needed, and falls back to
+// LargestFirst when there are none.
+type BranchAndBound struct {
+	// how far over the target is still as good as exact, usually what a
+	// change output would cost
+	Tolerance uint64
+	// number of branches to look at before giving up, 100000 if 0
+	Tries int
+}
+
+func (s BranchAndBound) SelectCoins(candidates []*Utxo, amount func(*Utxo) uint64, target uint64) ([]*Utxo, error) {
+	sorted := sortedByAmount(candidates, amount)
+	// remaining[i] is the sum of the amounts from i on
+	remaining := make([]uint64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + amount(sorted[i])
+	}
+	if remaining[0] < target {
+		return nil, insufficient(remaining[0], target)
+	}
+	tries := s.Tries
+	if tries == 0 {
+		tries = 100000
+	}
+
+	var best []int
+	bestWaste := uint64(0)
+	var picked []int
+	var search func(i int, sum uint64)
+	search = func(i int, sum uint64) {
+		if tries <= 0 {
+			return
+		}
+		tries--
+		if sum >= target {
+			waste := sum - target
+			if waste <= s.Tolerance && (best == nil || waste < bestWaste) {
+				best = append([]int{}, picked...)
+				bestWaste = waste
+			}
+			return
+		}
+		if i == len(sorted) || sum+remaining[i] < target {
+			return
+		}
+		picked = append(picked, i)
+		search(i+1, sum+amount(sorted[i]))
+		picked = picked[:len(picked)-1]
+		if best != nil && bestWaste == 0 {
+			return
+		}
+		search(i+1, sum)
+	}
+	search(0, 0)
+
+	if best == nil {
+		return LargestFirst{}.SelectCoins(candidates, amount, target)
+	}
+	selected := make([]*Utxo, len(best))
+	for i, index := range best {
+		selected[i] = sorted[index]
+	}
+	return selected, nil
+}
+
+// PrivacyPreserving spends outputs of as few scripts as it can, so that
+// the tx links as few addresses together as possible. All the outputs
+// of a script are spent together so none are left to be linked later.
+type PrivacyPreserving struct{}
+
+// scriptGroup is the candidates paying to one script.
+type scriptGroup struct {
+	utxos []*Utxo
+	sum   uint64
+}
+
+// bySum sorts groups from the largest sum down.
+type bySum []*scriptGroup
+
+func (s bySum) Len() int           { return len(s) }
+func (s bySum) Less(i, j int) bool { return s[i].sum > s[j].sum }
+func (s bySum) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s PrivacyPreserving) SelectCoins(candidates []*Utxo, amount func(*Utxo) uint64, target uint64) ([]*Utxo, error) {
+	var groups []*scriptGroup
+	byScript := make(map[string]*scriptGroup)
+	total := uint64(0)
+	for _, utxo := range candidates {
+		g, ok := byScript[string(utxo.PkScript)]
+		if !ok {
+			g = &scriptGroup{}
+			byScript[string(utxo.PkScript)] = g
+			groups = append(groups, g)
+		}
+		g.utxos = append(g.utxos, utxo)
+		g.sum += amount(utxo)
+		total += amount(utxo)
+	}
+	if total < target {
+		return nil, insufficient(total, target)
+	}
+
+	// the smallest script that covers it all by itself, if any
+	var single *scriptGroup
+	for _, g := range groups {
+		if g.sum >= target && (single == nil || g.sum < single.sum) {
+			single = g
+		}
+	}
+	if single != nil {
+		return single.utxos, nil
+	}
+
+	// otherwise the fewest scripts, largest first
+	sort.Stable(bySum(groups))
+	var selected []*Utxo
+	sum := uint64(0)
+	for _, g := range groups {
+		if sum >= target {
+			break
+		}
+		selected = append(selected, g.utxos...)
+		sum += g.sum
+	}
+	return selected, nil
+}
+
+// CoinRequest is what a transaction needs to be funded with.
+type CoinRequest struct {
+	// outputs that can be spent, colored or not
+	Candidates []*Utxo
+	// colored outputs to create
+	Outputs []*ColorOut
+	// script getting the color value of the selected inputs beyond what
+	// the outputs need
+	ColorChange []byte
+	// script getting the satoshi left over
+	Change   []byte
+	Fee      FeePolicy
+	Selector CoinSelector
+}
+
+// CoinSelection is what was picked to fund a transaction.
+type CoinSelection struct {
+	ColorIns []*ColorIn
+	Funding  []*btcwire.OutPoint
+	// the outputs asked for followed by the colored change, if any
+	Outputs []*ColorOut
+	Fee     int64
+}
+
+func satoshiAmount(utxo *Utxo) uint64 {
+	if utxo.Value < 0 {
+		return 0
+	}
+	return uint64(utxo.Value)
+}
+
+func colorAmount(utxo *Utxo) uint64 {
+	return uint64(utxo.ColorValue)
+}
+
+// issuingExtraPayer is implemented by kernels whose issuing txs pay for
+// an output besides the ones issued to, which IssuingSatoshiNeeded
+// counts along with the padding.
+type issuingExtraPayer interface {
+	// Returns the satoshi of the extra output
+	issuingExtraSatoshi() int64
+}
+
+// satoshiNeeded is what the kernel puts into the colored outputs, with
+// every output padded like the smallest one, and when issuing into the
+// extra output the kernel's issuing txs have.
+func satoshiNeeded(kernel ColorKernel, outputs []*ColorOut, issuing bool) (int64, error) {
+	if len(outputs) == 0 {
+		return 0, nil
+	}
+	minimum := outputs[0].ColorValue
+	for _, output := range outputs {
+		if minimum > output.ColorValue {
+			minimum = output.ColorValue
+		}
+	}
+	extra := int64(0)
+	payer, ok := kernel.(issuingExtraPayer)
+	if ok {
+		extra = payer.issuingExtraSatoshi()
+	}
+	padding := kernel.IssuingSatoshiNeeded(minimum) - int64(minimum) - extra
+	sum := int64(0)
+	if issuing {
+		sum = extra
+	}
+	for _, output := range outputs {
+		satoshi, err := output.ColorValue.Satoshi()
+		if err != nil {
+			return 0, err
+		}
+		sum, err = AddSatoshi(sum, satoshi)
+		if err != nil {
+			return 0, err
+		}
+		sum, err = AddSatoshi(sum, padding)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// fund selects funding until the inputs cover what the outputs and the
+// fee need. The fee is figured for the inputs selected and a change
+// output, so the funding is selected again as long as it doesn't cover
+// the fee its own inputs add.
+func (r *CoinRequest) fund(kernel ColorKernel, sel *CoinSelection, inSatoshi int64, issuing bool) error {
+	var plain []*Utxo
+	for _, utxo := range r.Candidates {
+		if utxo.Definition == nil {
+			plain = append(plain, utxo)
+		}
+	}
+	needed, err := satoshiNeeded(kernel, sel.Outputs, issuing)
+	if err != nil {
+		return err
+	}
+	total := inSatoshi
+	for tries := 0; tries <= len(plain)+1; tries++ {
+		fee := r.Fee.Fee(len(sel.ColorIns)+len(sel.Funding), len(sel.Outputs)+1)
+		if fee < 0 {
+			str := fmt.Sprintf("fee is negative: %d", fee)
+			return MakeError(ErrNegativeValue, str, nil)
+		}
+		target, err := AddSatoshi(needed, fee)
+		if err != nil {
+			return err
+		}
+		if target <= total {
+			sel.Fee = fee
+			return nil
+		}
+		if target <= inSatoshi {
+			// funding selected for a higher fee before isn't needed
+			sel.Funding, total = nil, inSatoshi
+			continue
+		}
+		funding, err := r.Selector.SelectCoins(plain, satoshiAmount, uint64(target-inSatoshi))
+		if err != nil {
+			return err
+		}
+		sel.Funding, total = nil, inSatoshi
+		for _, utxo := range funding {
+			sel.Funding = append(sel.Funding, utxo.OutPoint)
+			total += utxo.Value
+		}
+	}
+	return MakeError(ErrInsufficientFunds, "fee keeps growing with the inputs", nil)
+}
+
+// SelectIssuing picks the funding for issuing the outputs with the
+// kernel.
+func (r *CoinRequest) SelectIssuing(kernel ColorKernel) (*CoinSelection, error) {
+	sel := &CoinSelection{Outputs: r.Outputs}
+	err := r.fund(kernel, sel, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return sel, nil
+}
+
+// SelectTransfer picks colored inputs of the color with enough color
+// value for the outputs, and funding for whatever their satoshi don't
+// cover. Color value beyond the outputs goes to the colored change.
+func (r *CoinRequest) SelectTransfer(c *ColorDefinition) (*CoinSelection, error) {
+	var colored []*Utxo
+	for _, utxo := range r.Candidates {
+		if utxo.Definition != nil && utxo.Definition.HashString() == c.HashString() {
+			colored = append(colored, utxo)
+		}
+	}
+	target := ColorValue(0)
+	for _, output := range r.Outputs {
+		var err error
+		target, err = target.Add(output.ColorValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	picked, err := r.Selector.SelectCoins(colored, colorAmount, uint64(target))
+	if err != nil {
+		rerr, ok := err.(ChromaError)
+		if ok && rerr.ErrorCode == ErrInsufficientFunds {
+			return nil, MakeError(ErrInsufficientColorValue, rerr.Description, nil)
+		}
+		return nil, err
+	}
+
+	sel := &CoinSelection{}
+	inSatoshi := int64(0)
+	for _, utxo := range picked {
+		sel.ColorIns = append(sel.ColorIns, &ColorIn{
+			OutPoint:   utxo.OutPoint,
+			ColorValue: utxo.ColorValue,
+		})
+		inSatoshi, err = AddSatoshi(inSatoshi, utxo.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sel.Outputs, err = withColorChange(c.ColorKernel, sel.ColorIns, r.Outputs, r.ColorChange)
+	if err != nil {
+		return nil, err
+	}
+	err = r.fund(c.ColorKernel, sel, inSatoshi, false)
+	if err != nil {
+		return nil, err
+	}
+	return sel, nil
+}
+
+// IssuingTx selects the funding and builds the issuing tx.
+func (r *CoinRequest) IssuingTx(b *BlockExplorer, kernel ColorKernel) (*btcwire.MsgTx, *CoinSelection, error) {
+	sel, err := r.SelectIssuing(kernel)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := kernel.IssuingTx(b, sel.Funding, sel.Outputs, r.Change, sel.Fee)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, sel, nil
+}
+
+// TransferringTx selects the inputs and builds the transferring tx. The
+// funding goes after the colored inputs, with MultiColorTx when the
+// kernel has it and as inputs without color value otherwise.
+func (r *CoinRequest) TransferringTx(b *BlockExplorer, c *ColorDefinition) (*btcwire.MsgTx, *CoinSelection, error) {
+	sel, err := r.SelectTransfer(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tx *btcwire.MsgTx
+	kernel, ok := c.ColorKernel.(MultiColorKernel)
+	if ok {
+		group := &ColorGroup{Definition: c, Inputs: sel.ColorIns, Outputs: sel.Outputs}
+		tx, err = kernel.MultiColorTx(b, []*ColorGroup{group}, sel.Funding, r.Change, sel.Fee)
+	} else {
+		inputs := sel.ColorIns
+		for _, outPoint := range sel.Funding {
+			inputs = append(inputs, &ColorIn{OutPoint: outPoint})
+		}
+		tx, err = c.ColorKernel.TransferringTx(b, inputs, sel.Outputs, r.Change, sel.Fee, false)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, sel, nil
+}
@@ -0,0 +1,345 @@
+package gochroma_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+// tstUtxos makes plain candidates of the values, each paying to the
+// script of the same index
+func tstUtxos(values []int64, scripts []byte) []*gochroma.Utxo {
+	utxos := make([]*gochroma.Utxo, len(values))
+	for i, value := range values {
+		utxos[i] = &gochroma.Utxo{
+			OutPoint: btcwire.NewOutPoint(&btcwire.ShaHash{}, uint32(i)),
+			PkScript: tstScript(scripts[i]),
+			Value:    value,
+		}
+	}
+	return utxos
+}
+
+func tstValue(utxo *gochroma.Utxo) uint64 {
+	return uint64(utxo.Value)
+}
+
+func TestCoinSelectors(t *testing.T) {
+	tests := []struct {
+		desc     string
+		selector gochroma.CoinSelector
+		values   []int64
+		scripts  []byte
+		target   uint64
+		want     []int64
+	}{
+		{"largest first", gochroma.LargestFirst{},
+			[]int64{10, 50, 30, 20}, []byte{0, 1, 2, 3}, 70, []int64{50, 30}},
+		{"largest first all", gochroma.LargestFirst{},
+			[]int64{10, 50, 30}, []byte{0, 1, 2}, 90, []int64{50, 30, 10}},
+		{"branch and bound exact", gochroma.BranchAndBound{},
+			[]int64{10, 50, 30, 20}, []byte{0, 1, 2, 3}, 70, []int64{50, 20}},
+		{"branch and bound tolerance", gochroma.BranchAndBound{Tolerance: 5},
+			[]int64{33, 48, 12}, []byte{0, 1, 2}, 42, []int64{33, 12}},
+		{"branch and bound fallback", gochroma.BranchAndBound{},
+			[]int64{33, 48, 12}, []byte{0, 1, 2}, 42, []int64{48}},
+		{"privacy single script", gochroma.PrivacyPreserving{},
+			[]int64{60, 20, 30, 10}, []byte{0, 1, 1, 2}, 40, []int64{20, 30}},
+		{"privacy fewest scripts", gochroma.PrivacyPreserving{},
+			[]int64{60, 20, 30, 10}, []byte{0, 1, 1, 2}, 100, []int64{60, 20, 30}},
+	}
+
+	for _, test := range tests {
+		// Setup
+		utxos := tstUtxos(test.values, test.scripts)
+
+		// Execute
+		selected, err := test.selector.SelectCoins(utxos, tstValue, test.target)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: got error %v", test.desc, err)
+			continue
+		}
+		var got []int64
+		for _, utxo := range selected {
+			got = append(got, utxo.Value)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: selected %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestCoinSelectorsError(t *testing.T) {
+	selectors := []gochroma.CoinSelector{
+		gochroma.LargestFirst{},
+		gochroma.BranchAndBound{},
+		gochroma.PrivacyPreserving{},
+	}
+	for _, selector := range selectors {
+		// Setup
+		utxos := tstUtxos([]int64{10, 20}, []byte{0, 1})
+
+		// Execute
+		_, err := selector.SelectCoins(utxos, tstValue, 31)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%T: expected error, got nil", selector)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(gochroma.ErrInsufficientFunds)
+		if rerr.ErrorCode != want {
+			t.Errorf("%T: wrong error, want %v, got %v", selector, want, rerr)
+		}
+	}
+}
+
+func TestCoinRequest(t *testing.T) {
+	tests := []struct {
+		key    string
+		issued gochroma.ColorValue
+		send   gochroma.ColorValue
+		change gochroma.ColorValue
+	}{
+		{EPOBCKey, 100, 60, 40},
+		{EPOBCKey, 100, 100, 0},
+		{REPOBCKey, 100, 60, 40},
+		{SPOBCKey, 1, 1, 0},
+	}
+
+	for _, test := range tests {
+		// Setup
+		kernel, err := gochroma.GetColorKernel(test.key)
+		if err != nil {
+			t.Fatalf("error getting %v kernel: %v", test.key, err)
+		}
+		chain := kerneltest.NewMemChain()
+		b := chain.NewBlockExplorer()
+		issuing := &gochroma.CoinRequest{
+			Candidates: []*gochroma.Utxo{&gochroma.Utxo{
+				OutPoint: chain.Fund(100000, tstScript(0)),
+				PkScript: tstScript(0),
+				Value:    100000,
+			}},
+			Outputs:  []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), test.issued}},
+			Change:   tstScript(0),
+			Fee:      gochroma.FlatFee(1000),
+			Selector: gochroma.LargestFirst{},
+		}
+		chain.Mine()
+		tx, _, err := issuing.IssuingTx(b, kernel)
+		if err != nil {
+			t.Errorf("%v: failed to make issuing tx: %v", test.key, err)
+			continue
+		}
+		shaHash := tstPublish(t, chain, tx)
+		height, err := b.BlockCount()
+		if err != nil {
+			t.Fatalf("failed to get block count: %v", err)
+		}
+		cd, err := gochroma.NewColorDefinition(kernel, btcwire.NewOutPoint(shaHash, 0), height)
+		if err != nil {
+			t.Fatalf("failed to make color definition: %v", err)
+		}
+		funding := chain.Fund(50000, tstScript(4))
+		chain.Mine()
+		transferring := &gochroma.CoinRequest{
+			Candidates: []*gochroma.Utxo{
+				&gochroma.Utxo{
+					OutPoint:   cd.Genesis,
+					PkScript:   tstScript(1),
+					Value:      tx.TxOut[0].Value,
+					Definition: cd,
+					ColorValue: test.issued,
+				},
+				&gochroma.Utxo{
+					OutPoint: funding,
+					PkScript: tstScript(4),
+					Value:    50000,
+				},
+			},
+			Outputs:     []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), test.send}},
+			ColorChange: tstScript(3),
+			Change:      tstScript(0),
+			Fee:         gochroma.FlatFee(20000),
+			Selector:    gochroma.BranchAndBound{},
+		}
+
+		// Execute
+		tx, sel, err := transferring.TransferringTx(b, cd)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: failed to make transferring tx: %v", test.key, err)
+			continue
+		}
+		if len(sel.ColorIns) != 1 || len(sel.Funding) != 1 || sel.Fee != 20000 {
+			t.Errorf("%v: wrong selection %v", test.key, sel)
+		}
+		outputs, err := cd.RunKernelOnChain(b, tx, []gochroma.ColorValue{test.issued, 0})
+		if err != nil {
+			t.Fatalf("%v: failed to run kernel: %v", test.key, err)
+		}
+		out := int64(0)
+		for _, txOut := range tx.TxOut {
+			out += txOut.Value
+		}
+		in := transferring.Candidates[0].Value + 50000
+		if out != in-20000 {
+			t.Errorf("%v: outputs have %d satoshi, want %d", test.key, out, in-20000)
+		}
+		want := []gochroma.ColorValue{test.send}
+		if test.change > 0 {
+			want = append(want, test.change)
+		}
+		got := outputs[:len(want)]
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: color values %v, want %v", test.key, got, want)
+		}
+	}
+}
+
+func TestCoinRequestExactFit(t *testing.T) {
+	tests := []struct {
+		key     string
+		outputs []gochroma.ColorValue
+		// the colored outputs, the authority for REPOBC and the fee
+		satoshi int64
+	}{
+		{EPOBCKey, []gochroma.ColorValue{6000, 7000}, 6001 + 7001 + 1000},
+		{REPOBCKey, []gochroma.ColorValue{6000, 7000}, 6001 + 7001 + 5430 + 1000},
+		{REPOBCKey, []gochroma.ColorValue{100}, 100 + 8192 + 5430 + 1000},
+	}
+
+	for _, test := range tests {
+		// Setup
+		kernel, err := gochroma.GetColorKernel(test.key)
+		if err != nil {
+			t.Fatalf("error getting %v kernel: %v", test.key, err)
+		}
+		chain := kerneltest.NewMemChain()
+		b := chain.NewBlockExplorer()
+		outputs := make([]*gochroma.ColorOut, len(test.outputs))
+		for i, cv := range test.outputs {
+			outputs[i] = &gochroma.ColorOut{tstScript(1), cv}
+		}
+		request := &gochroma.CoinRequest{
+			Candidates: []*gochroma.Utxo{&gochroma.Utxo{
+				OutPoint: chain.Fund(test.satoshi, tstScript(0)),
+				PkScript: tstScript(0),
+				Value:    test.satoshi,
+			}},
+			Outputs:  outputs,
+			Change:   tstScript(0),
+			Fee:      gochroma.FlatFee(1000),
+			Selector: gochroma.BranchAndBound{},
+		}
+		chain.Mine()
+
+		// Execute
+		tx, sel, err := request.IssuingTx(b, kernel)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v %v: failed to make issuing tx: %v", test.key, test.outputs, err)
+			continue
+		}
+		if len(sel.Funding) != 1 {
+			t.Errorf("%v %v: wrong funding %v", test.key, test.outputs, sel.Funding)
+		}
+		out := int64(0)
+		for _, txOut := range tx.TxOut {
+			out += txOut.Value
+		}
+		if out != test.satoshi-1000 {
+			t.Errorf("%v %v: outputs have %d satoshi, want %d", test.key,
+				test.outputs, out, test.satoshi-1000)
+		}
+	}
+
+	// a REPOBC transfer has no authority to pay for
+	repobc, err := gochroma.GetColorKernel(REPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting repobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	cd := tstIssue(t, chain, repobc, 6000)
+	request := &gochroma.CoinRequest{
+		Candidates: []*gochroma.Utxo{&gochroma.Utxo{
+			OutPoint:   cd.Genesis,
+			PkScript:   tstScript(1),
+			Value:      6001,
+			Definition: cd,
+			ColorValue: 6000,
+		}},
+		Outputs:  []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 6000}},
+		Change:   tstScript(0),
+		Fee:      gochroma.FlatFee(0),
+		Selector: gochroma.BranchAndBound{},
+	}
+	sel, err := request.SelectTransfer(cd)
+	if err != nil {
+		t.Fatalf("failed to select transfer: %v", err)
+	}
+	if len(sel.ColorIns) != 1 || len(sel.Funding) != 0 {
+		t.Errorf("wrong selection %v", sel)
+	}
+}
+
+func TestCoinRequestError(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	cd := tstIssue(t, chain, epobc, 100)
+	colored := &gochroma.Utxo{
+		OutPoint:   cd.Genesis,
+		PkScript:   tstScript(1),
+		Value:      epobc.IssuingSatoshiNeeded(100),
+		Definition: cd,
+		ColorValue: 100,
+	}
+
+	tests := []struct {
+		desc string
+		cv   gochroma.ColorValue
+		fee  int64
+		err  int
+	}{
+		{"not enough color", 101, 0, gochroma.ErrInsufficientColorValue},
+		{"not enough satoshi", 100, 1, gochroma.ErrInsufficientFunds},
+		{"negative fee", 100, -1, gochroma.ErrNegativeValue},
+	}
+
+	for _, test := range tests {
+		request := &gochroma.CoinRequest{
+			Candidates: []*gochroma.Utxo{colored},
+			Outputs:    []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), test.cv}},
+			Change:     tstScript(0),
+			Fee:        gochroma.FlatFee(test.fee),
+			Selector:   gochroma.LargestFirst{},
+		}
+
+		// Execute
+		_, err := request.SelectTransfer(cd)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
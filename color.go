@@ -3,8 +3,6 @@ package gochroma
 import (
 	"encoding/binary"
 	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/btcsuite/btcwire"
 	"github.com/btcsuite/fastsha256"
@@ -54,33 +52,36 @@ type ColorKernel interface {
 	FindAffectingInputs(b *BlockExplorer, genesis *btcwire.OutPoint, tx *btcwire.MsgTx, outputIndexes []int) ([]*btcwire.OutPoint, error)
 }
 
-var kernelMap = make(map[string]ColorKernel, 10)
+// ChainKernel is implemented by kernels which need more than the color
+// values of the inputs to calculate the output color values, like the
+// satoshi each input brings in for order-based kernels.
+type ChainKernel interface {
+	// Calculates the output color values given the input color values,
+	// looking up whatever else is needed on the blockchain
+	CalculateOutColorValuesOnChain(b *BlockExplorer, genesis *btcwire.OutPoint, tx *btcwire.MsgTx, inputs []ColorValue) ([]ColorValue, error)
+}
+
+// DefaultKernelRegistry is the registry the package-level kernel
+// functions use. The kernels in this package register themselves here.
+var DefaultKernelRegistry = NewKernelRegistry()
 
+// RegisterColorKernel registers the kernel with DefaultKernelRegistry.
 func RegisterColorKernel(kernel ColorKernel) error {
-	key := kernel.Code()
-	_, ok := kernelMap[key]
-	if ok {
-		// this is a duplicate
-		str := fmt.Sprintf("%v is already a registered kernel", key)
-		return MakeError(ErrDuplicateKernel, str, nil)
-	}
-	kernelMap[key] = kernel
-	return nil
+	return DefaultKernelRegistry.Register(kernel)
 }
 
+// GetColorKernel returns the kernel with the code given from
+// DefaultKernelRegistry.
 func GetColorKernel(key string) (ColorKernel, error) {
-	kernel, ok := kernelMap[key]
-	if !ok {
-		str := fmt.Sprintf("%v is not a registered kernel", key)
-		return nil, MakeError(ErrNonExistentKernel, str, nil)
-	}
-	return kernel, nil
+	return DefaultKernelRegistry.Get(key)
 }
 
 type ColorDefinition struct {
 	ColorKernel
 	Genesis *btcwire.OutPoint
 	Height  int64
+	// how color values are shown to people, nil for raw color values
+	Asset *Asset
 }
 
 func (c *ColorDefinition) String() string {
@@ -121,6 +122,16 @@ func (c *ColorDefinition) RunKernel(tx *btcwire.MsgTx, inputs []ColorValue) ([]C
 	return c.CalculateOutColorValues(c.Genesis, tx, inputs)
 }
 
+// RunKernelOnChain is RunKernel for txs whose inputs may belong to other
+// colors, using CalculateOutColorValuesOnChain when the kernel has it.
+func (c *ColorDefinition) RunKernelOnChain(b *BlockExplorer, tx *btcwire.MsgTx, inputs []ColorValue) ([]ColorValue, error) {
+	kernel, ok := c.ColorKernel.(ChainKernel)
+	if !ok {
+		return c.RunKernel(tx, inputs)
+	}
+	return kernel.CalculateOutColorValuesOnChain(b, c.Genesis, tx, inputs)
+}
+
 func (c *ColorDefinition) AffectingInputs(b *BlockExplorer, tx *btcwire.MsgTx, outputIndexes []int) ([]*btcwire.OutPoint, error) {
 	return c.FindAffectingInputs(b, c.Genesis, tx, outputIndexes)
 }
@@ -135,38 +146,14 @@ func (c *ColorDefinition) ColorValue(b *BlockExplorer, outPoint *btcwire.OutPoin
 
 func NewColorDefinition(kernel ColorKernel, genesis *btcwire.OutPoint, height int64) (*ColorDefinition, error) {
 	return &ColorDefinition{
-		kernel, genesis, height,
+		ColorKernel: kernel,
+		Genesis:     genesis,
+		Height:      height,
 	}, nil
 }
 
+// NewColorDefinitionFromStr parses the color definition, looking up the
+// kernel in DefaultKernelRegistry.
 func NewColorDefinitionFromStr(cdString string) (*ColorDefinition, error) {
-	components := strings.Split(cdString, ":")
-	if len(components) != 4 {
-		return nil, MakeError(ErrBadColorDefinition, "color definition should have 4 components", nil)
-	}
-	kernel, err := GetColorKernel(components[0])
-	if err != nil {
-		return nil, err
-	}
-	shaHash, err := btcwire.NewShaHashFromStr(components[1])
-	if err != nil {
-		return nil, MakeError(ErrInvalidTx, "hash is invalid", err)
-	}
-	index, err := strconv.Atoi(components[2])
-	if err != nil {
-		return nil, MakeError(ErrInvalidTx, "index is invalid", err)
-	}
-	genesis := btcwire.NewOutPoint(shaHash, uint32(index))
-
-	height, err := strconv.Atoi(components[3])
-	if err != nil {
-		return nil, MakeError(ErrInvalidTx, "height is invalid", err)
-	}
-	if height < 0 {
-		return nil, MakeError(ErrInvalidTx, "height is negative", nil)
-	}
-
-	return &ColorDefinition{
-		kernel, genesis, int64(height),
-	}, nil
+	return DefaultKernelRegistry.NewColorDefinitionFromStr(cdString)
 }
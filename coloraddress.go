@@ -0,0 +1,143 @@
+package gochroma
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/fastsha256"
+)
+
+const (
+	// ColorIDSize is how many bytes of the hash of a color definition
+	// identify the color in a colored address.
+	ColorIDSize = 10
+	// colorChecksumSize is how many bytes of checksum follow the color id.
+	colorChecksumSize = 4
+)
+
+// ColoredAddress is an address that only takes one color, written as the
+// color id and a checksum in hex, then "@" and the address, like
+// 0123456789abcdef0123deadbeef@mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn. The
+// checksum covers the address too, so a color id can't be moved to
+// another address unnoticed.
+type ColoredAddress struct {
+	Address btcutil.Address
+	// the first ColorIDSize bytes of the hash of the definition
+	ColorID []byte
+}
+
+// ColorID returns the id of the color in colored addresses.
+func (c *ColorDefinition) ColorID() []byte {
+	return c.Hash()[:ColorIDSize]
+}
+
+// NewColoredAddress returns the address taking only the color of the
+// definition.
+func NewColoredAddress(addr btcutil.Address, cd *ColorDefinition) *ColoredAddress {
+	return &ColoredAddress{
+		Address: addr,
+		ColorID: cd.ColorID(),
+	}
+}
+
+// colorChecksum is the first bytes of the double sha256 of the color id
+// and the encoded address.
+func colorChecksum(colorID []byte, encoded string) []byte {
+	first := fastsha256.Sum256(append(append([]byte{}, colorID...), encoded...))
+	second := fastsha256.Sum256(first[:])
+	return second[:colorChecksumSize]
+}
+
+// String encodes the colored address.
+func (a *ColoredAddress) String() string {
+	encoded := a.Address.EncodeAddress()
+	prefix := append(append([]byte{}, a.ColorID...), colorChecksum(a.ColorID, encoded)...)
+	return hex.EncodeToString(prefix) + "@" + encoded
+}
+
+// IsForColor returns whether the address takes the color of the
+// definition.
+func (a *ColoredAddress) IsForColor(cd *ColorDefinition) bool {
+	return bytes.Equal(a.ColorID, cd.ColorID())
+}
+
+// ColorOut returns the output paying the color value of the color to the
+// address. It's an ErrBadColoredAddress error if the address takes
+// another color.
+func (a *ColoredAddress) ColorOut(cd *ColorDefinition, cv ColorValue) (*ColorOut, error) {
+	if !a.IsForColor(cd) {
+		str := fmt.Sprintf("address %v does not take %v", a, cd)
+		return nil, MakeError(ErrBadColoredAddress, str, nil)
+	}
+	script, err := btcscript.PayToAddrScript(a.Address)
+	if err != nil {
+		return nil, MakeError(ErrBadColoredAddress, "can't pay to the address", err)
+	}
+	return &ColorOut{Script: script, ColorValue: cv}, nil
+}
+
+// DecodeColoredAddress decodes a colored address on the network.
+func DecodeColoredAddress(s string, net *btcnet.Params) (*ColoredAddress, error) {
+	at := strings.Index(s, "@")
+	if at == -1 {
+		return nil, MakeError(ErrBadColoredAddress, "address has no color id", nil)
+	}
+	prefix, err := hex.DecodeString(s[:at])
+	if err != nil || len(prefix) != ColorIDSize+colorChecksumSize {
+		str := fmt.Sprintf("color id should be %d bytes of hex", ColorIDSize+colorChecksumSize)
+		return nil, MakeError(ErrBadColoredAddress, str, err)
+	}
+	encoded := s[at+1:]
+	colorID, checksum := prefix[:ColorIDSize], prefix[ColorIDSize:]
+	if !bytes.Equal(checksum, colorChecksum(colorID, encoded)) {
+		return nil, MakeError(ErrBadColoredAddress, "checksum does not match", nil)
+	}
+	addr, err := btcutil.DecodeAddress(encoded, net)
+	if err != nil {
+		return nil, MakeError(ErrBadColoredAddress, "address is invalid", err)
+	}
+	if !addr.IsForNet(net) {
+		str := fmt.Sprintf("address is not for %v", net.Name)
+		return nil, MakeError(ErrBadColoredAddress, str, nil)
+	}
+	return &ColoredAddress{Address: addr, ColorID: colorID}, nil
+}
+
+// AddressPolicy turns the addresses colored sends go to into outputs.
+type AddressPolicy struct {
+	Net *btcnet.Params
+	// refuse plain addresses, which may not know about colors
+	RequireColored bool
+}
+
+// ColorOut returns the output paying the color value of the color to the
+// address, which is a colored address for the color or, unless the
+// policy requires colored addresses, a plain one. A plain address is an
+// ErrPlainAddress error when it's refused.
+func (p *AddressPolicy) ColorOut(addr string, cd *ColorDefinition, cv ColorValue) (*ColorOut, error) {
+	if strings.Contains(addr, "@") {
+		colored, err := DecodeColoredAddress(addr, p.Net)
+		if err != nil {
+			return nil, err
+		}
+		return colored.ColorOut(cd, cv)
+	}
+	if p.RequireColored {
+		str := fmt.Sprintf("%v is not a colored address for %v", addr, cd)
+		return nil, MakeError(ErrPlainAddress, str, nil)
+	}
+	plain, err := btcutil.DecodeAddress(addr, p.Net)
+	if err != nil {
+		return nil, MakeError(ErrBadColoredAddress, "address is invalid", err)
+	}
+	if !plain.IsForNet(p.Net) {
+		str := fmt.Sprintf("address is not for %v", p.Net.Name)
+		return nil, MakeError(ErrBadColoredAddress, str, nil)
+	}
+	return NewColoredAddress(plain, cd).ColorOut(cd, cv)
+}
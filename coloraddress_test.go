@@ -0,0 +1,159 @@
+package gochroma_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+// tstColors returns two colors of the kernel
+func tstColors(t *testing.T) (*gochroma.ColorDefinition, *gochroma.ColorDefinition) {
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	cd1, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(&btcwire.ShaHash{1}, 0), 100)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	cd2, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(&btcwire.ShaHash{2}, 0), 100)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	return cd1, cd2
+}
+
+func TestColoredAddress(t *testing.T) {
+	// Setup
+	cd, _ := tstColors(t)
+	wif := tstWIF(t, 1)
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(wif.SerializePubKey()), &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	colored := gochroma.NewColoredAddress(addr, cd)
+
+	// Execute
+	s := colored.String()
+	decoded, err := gochroma.DecodeColoredAddress(s, &btcnet.TestNet3Params)
+
+	// Verify
+	if !strings.HasSuffix(s, "@"+addr.EncodeAddress()) || len(s) != 28+1+len(addr.EncodeAddress()) {
+		t.Errorf("wrong encoding: %v", s)
+	}
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if decoded.Address.EncodeAddress() != addr.EncodeAddress() || !decoded.IsForColor(cd) {
+		t.Errorf("got %v, want %v", decoded, colored)
+	}
+	out, err := decoded.ColorOut(cd, 100)
+	if err != nil {
+		t.Fatalf("failed to make output: %v", err)
+	}
+	if !bytes.Equal(out.Script, tstP2PKH(t, wif)) || out.ColorValue != 100 {
+		t.Errorf("wrong output: %v", out)
+	}
+}
+
+func TestDecodeColoredAddressError(t *testing.T) {
+	// Setup
+	cd, _ := tstColors(t)
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	s := gochroma.NewColoredAddress(addr, cd).String()
+	other, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{1}, 20), &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		s    string
+		net  *btcnet.Params
+	}{
+		{"plain", addr.EncodeAddress(), &btcnet.TestNet3Params},
+		{"not hex", "xx" + s[2:], &btcnet.TestNet3Params},
+		{"short id", s[2:], &btcnet.TestNet3Params},
+		{"checksum", s[:29] + other.EncodeAddress(), &btcnet.TestNet3Params},
+		{"network", s, &btcnet.MainNetParams},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := gochroma.DecodeColoredAddress(test.s, test.net)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(gochroma.ErrBadColoredAddress)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
+
+func TestAddressPolicyColorOut(t *testing.T) {
+	// Setup
+	cd, other := tstColors(t)
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	plain := addr.EncodeAddress()
+	colored := gochroma.NewColoredAddress(addr, cd).String()
+	otherColor := gochroma.NewColoredAddress(addr, other).String()
+	lax := &gochroma.AddressPolicy{Net: &btcnet.TestNet3Params}
+	strict := &gochroma.AddressPolicy{Net: &btcnet.TestNet3Params, RequireColored: true}
+
+	tests := []struct {
+		desc   string
+		policy *gochroma.AddressPolicy
+		addr   string
+		err    int
+	}{
+		{"plain", lax, plain, -1},
+		{"colored", lax, colored, -1},
+		{"strict colored", strict, colored, -1},
+		{"strict plain", strict, plain, gochroma.ErrPlainAddress},
+		{"other color", lax, otherColor, gochroma.ErrBadColoredAddress},
+		{"bad plain", lax, "1234", gochroma.ErrBadColoredAddress},
+	}
+
+	for _, test := range tests {
+		// Execute
+		out, err := test.policy.ColorOut(test.addr, cd, 100)
+
+		// Verify
+		if test.err != -1 {
+			if err == nil {
+				t.Errorf("%v: expected error, got nil", test.desc)
+				continue
+			}
+			rerr := err.(gochroma.ChromaError)
+			want := gochroma.ErrorCode(test.err)
+			if rerr.ErrorCode != want {
+				t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: failed to make output: %v", test.desc, err)
+			continue
+		}
+		if len(out.Script) != 25 || out.ColorValue != 100 {
+			t.Errorf("%v: wrong output: %v", test.desc, out)
+		}
+	}
+}
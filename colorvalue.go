@@ -0,0 +1,102 @@
+package gochroma
+
+import (
+	"fmt"
+	"math"
+)
+
+// Color values are uint64 while satoshi values are int64, so going
+// between the two or adding up either can wrap around. The kernels go
+// through these instead of converting and adding directly.
+
+// Add returns the sum of the color values, or an error if it doesn't fit.
+func (cv ColorValue) Add(other ColorValue) (ColorValue, error) {
+	sum := cv + other
+	if sum < cv {
+		str := fmt.Sprintf("%d + %d overflows", cv, other)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	return sum, nil
+}
+
+// Sub returns the difference of the color values, or an error if the
+// other is larger.
+func (cv ColorValue) Sub(other ColorValue) (ColorValue, error) {
+	if other > cv {
+		str := fmt.Sprintf("%d - %d is negative", cv, other)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	return cv - other, nil
+}
+
+// Satoshi returns the color value as a satoshi value, or an error if it
+// doesn't fit in one.
+func (cv ColorValue) Satoshi() (int64, error) {
+	if cv > math.MaxInt64 {
+		str := fmt.Sprintf("%d is too big for a satoshi value", cv)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	return int64(cv), nil
+}
+
+// SumColorValues adds up the color values, or returns an error if the
+// sum doesn't fit.
+func SumColorValues(cvs []ColorValue) (ColorValue, error) {
+	sum := ColorValue(0)
+	for _, cv := range cvs {
+		var err error
+		sum, err = sum.Add(cv)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// NewColorValueFromSatoshi returns the satoshi value as a color value, or
+// an error if it's negative.
+func NewColorValueFromSatoshi(satoshi int64) (ColorValue, error) {
+	if satoshi < 0 {
+		str := fmt.Sprintf("%d is negative", satoshi)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	return ColorValue(satoshi), nil
+}
+
+// AddSatoshi returns the sum of the satoshi values, or an error if one is
+// negative or the sum doesn't fit.
+func AddSatoshi(a, b int64) (int64, error) {
+	if a < 0 || b < 0 {
+		str := fmt.Sprintf("%d + %d has a negative value", a, b)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	if a > math.MaxInt64-b {
+		str := fmt.Sprintf("%d + %d overflows", a, b)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	return a + b, nil
+}
+
+// MulSatoshi returns the product of the satoshi value and the count, or
+// an error if either is negative or the product doesn't fit.
+func MulSatoshi(satoshi int64, count int) (int64, error) {
+	if satoshi < 0 || count < 0 {
+		str := fmt.Sprintf("%d * %d has a negative value", satoshi, count)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	if count != 0 && satoshi > math.MaxInt64/int64(count) {
+		str := fmt.Sprintf("%d * %d overflows", satoshi, count)
+		return 0, MakeError(ErrInvalidColorValue, str, nil)
+	}
+	return satoshi * int64(count), nil
+}
+
+// paddedValue is what the satoshi value brings beyond the padding, 0 if
+// it's no more than the padding. Unlike subtracting, this can't wrap
+// around for hostile values, as the padding is never negative.
+func paddedValue(value, padding int64) int64 {
+	if value <= padding {
+		return 0
+	}
+	return value - padding
+}
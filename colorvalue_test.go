@@ -0,0 +1,114 @@
+package gochroma_test
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/jimmysong/gochroma"
+)
+
+func TestColorValueArithmetic(t *testing.T) {
+	max := gochroma.ColorValue(math.MaxUint64)
+	tests := []struct {
+		desc string
+		do   func() (int64, error)
+		want int64
+		ok   bool
+	}{
+		{"add", func() (int64, error) { cv, err := gochroma.ColorValue(2).Add(3); return int64(cv), err }, 5, true},
+		{"add overflow", func() (int64, error) { cv, err := max.Add(1); return int64(cv), err }, 0, false},
+		{"sub", func() (int64, error) { cv, err := gochroma.ColorValue(5).Sub(3); return int64(cv), err }, 2, true},
+		{"sub negative", func() (int64, error) { cv, err := gochroma.ColorValue(3).Sub(5); return int64(cv), err }, 0, false},
+		{"sum", func() (int64, error) {
+			cv, err := gochroma.SumColorValues([]gochroma.ColorValue{1, 2, 3})
+			return int64(cv), err
+		}, 6, true},
+		{"sum overflow", func() (int64, error) {
+			cv, err := gochroma.SumColorValues([]gochroma.ColorValue{max, 2, 3})
+			return int64(cv), err
+		}, 0, false},
+		{"satoshi", func() (int64, error) { return gochroma.ColorValue(math.MaxInt64).Satoshi() }, math.MaxInt64, true},
+		{"satoshi too big", func() (int64, error) { return gochroma.ColorValue(math.MaxInt64 + 1).Satoshi() }, 0, false},
+		{"from satoshi", func() (int64, error) { cv, err := gochroma.NewColorValueFromSatoshi(7); return int64(cv), err }, 7, true},
+		{"from negative satoshi", func() (int64, error) { cv, err := gochroma.NewColorValueFromSatoshi(-1); return int64(cv), err }, 0, false},
+		{"add satoshi", func() (int64, error) { return gochroma.AddSatoshi(2, 3) }, 5, true},
+		{"add satoshi overflow", func() (int64, error) { return gochroma.AddSatoshi(math.MaxInt64, 1) }, 0, false},
+		{"add negative satoshi", func() (int64, error) { return gochroma.AddSatoshi(-5, 3) }, 0, false},
+		{"mul satoshi", func() (int64, error) { return gochroma.MulSatoshi(8192, 3) }, 24576, true},
+		{"mul satoshi by 0", func() (int64, error) { return gochroma.MulSatoshi(math.MaxInt64, 0) }, 0, true},
+		{"mul satoshi overflow", func() (int64, error) { return gochroma.MulSatoshi(math.MaxInt64/2+1, 2) }, 0, false},
+	}
+
+	for _, test := range tests {
+		// Execute
+		got, err := test.do()
+
+		// Verify
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%v: expected error, got %d", test.desc, got)
+				continue
+			}
+			rerr := err.(gochroma.ChromaError)
+			wantErr := gochroma.ErrorCode(gochroma.ErrInvalidColorValue)
+			if rerr.ErrorCode != wantErr {
+				t.Errorf("%v: wrong error passed back: got %v, want %v",
+					test.desc, rerr.ErrorCode, wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.desc, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%v: got %d, want %d", test.desc, got, test.want)
+		}
+	}
+}
+
+// tstCheckArithmetic checks the checked arithmetic on the operands
+// against big.Int
+func tstCheckArithmetic(t *testing.T, a, b uint64) {
+	maxUint64 := new(big.Int).SetUint64(math.MaxUint64)
+	exact := new(big.Int).Add(new(big.Int).SetUint64(a), new(big.Int).SetUint64(b))
+	sum, err := gochroma.ColorValue(a).Add(gochroma.ColorValue(b))
+	fits := exact.Cmp(maxUint64) <= 0
+	if fits != (err == nil) || (err == nil && uint64(sum) != exact.Uint64()) {
+		t.Errorf("%d + %d: got %d, %v", a, b, sum, err)
+	}
+	diff, err := gochroma.ColorValue(a).Sub(gochroma.ColorValue(b))
+	if (a >= b) != (err == nil) || (err == nil && uint64(diff)+b != a) {
+		t.Errorf("%d - %d: got %d, %v", a, b, diff, err)
+	}
+
+	x, y := int64(a), int64(b)
+	exact.Add(big.NewInt(x), big.NewInt(y))
+	satoshi, err := gochroma.AddSatoshi(x, y)
+	fits = x >= 0 && y >= 0 && exact.Cmp(big.NewInt(math.MaxInt64)) <= 0
+	if fits != (err == nil) || (err == nil && satoshi != exact.Int64()) {
+		t.Errorf("%d + %d satoshi: got %d, %v", x, y, satoshi, err)
+	}
+	satoshi, err = gochroma.ColorValue(a).Satoshi()
+	if (a <= math.MaxInt64) != (err == nil) || (err == nil && uint64(satoshi) != a) {
+		t.Errorf("%d to satoshi: got %d, %v", a, satoshi, err)
+	}
+}
+
+func TestColorValueArithmeticProperties(t *testing.T) {
+	tests := [][2]uint64{
+		{1, 2},
+		{math.MaxUint64, 1},
+		{math.MaxInt64, math.MaxInt64},
+		{0, math.MaxUint64},
+	}
+	r := tstRand()
+	for i := 0; i < 1000; i++ {
+		tests = append(tests, [2]uint64{tstRandUint64(r), tstRandUint64(r)})
+	}
+
+	for _, test := range tests {
+		tstCheckArithmetic(t, test[0], test[1])
+	}
+}
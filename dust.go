@@ -0,0 +1,90 @@
+package gochroma
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcwire"
+)
+
+// DefaultRelayFee is the lowest fee rate nodes relay txs at unless told
+// otherwise.
+const DefaultRelayFee = FeeRate(1000)
+
+// spendInputSize is what nodes take the input spending an output to cost
+// when deciding if the output is dust.
+const spendInputSize = 148
+
+// DustPolicy decides which outputs nodes won't relay as being worth less
+// than the fee to spend them. A nil policy finds nothing dust, for
+// kernels that don't check.
+type DustPolicy struct {
+	// lowest fee rate txs get relayed at
+	RelayFee FeeRate
+}
+
+// DefaultDustPolicy is the policy of nodes at the default relay fee. The
+// kernels in DefaultKernelRegistry use it.
+var DefaultDustPolicy = &DustPolicy{RelayFee: DefaultRelayFee}
+
+// netDustPolicies are the policies of the networks, by their magic. Nodes
+// on every network relay at the default fee for now, so they all have
+// DefaultDustPolicy; this is where one that doesn't would go.
+var netDustPolicies = map[btcwire.BitcoinNet]*DustPolicy{
+	btcwire.MainNet:  DefaultDustPolicy,
+	btcwire.TestNet3: DefaultDustPolicy,
+	btcwire.TestNet:  DefaultDustPolicy,
+	btcwire.SimNet:   DefaultDustPolicy,
+}
+
+// NetDustPolicy returns the dust policy of the network, which is
+// DefaultDustPolicy for networks it doesn't know.
+func NetDustPolicy(net *btcnet.Params) *DustPolicy {
+	policy, ok := netDustPolicies[net.Net]
+	if !ok {
+		return DefaultDustPolicy
+	}
+	return policy
+}
+
+// Threshold returns the smallest value an output to the script can have
+// without being dust: three times the relay fee of the output and the
+// input that spends it. OP_RETURN outputs can't be spent so they are
+// never dust.
+func (p *DustPolicy) Threshold(script []byte) int64 {
+	if p == nil || (len(script) > 0 && script[0] == opReturn) {
+		return 0
+	}
+	txOut := btcwire.NewTxOut(0, script)
+	return 3 * p.RelayFee.FeeForSize(txOut.SerializeSize()+spendInputSize)
+}
+
+// IsDust returns whether the output is below the threshold for its
+// script.
+func (p *DustPolicy) IsDust(txOut *btcwire.TxOut) bool {
+	return txOut.Value < p.Threshold(txOut.PkScript)
+}
+
+// MinimumSatoshi returns the threshold of a pay-to-pubkey-hash output,
+// the smallest a kernel can make its outputs under the policy.
+func (p *DustPolicy) MinimumSatoshi() int64 {
+	return p.Threshold(make([]byte, 25))
+}
+
+// finishTx checks that none of the outputs the builder put in the tx are
+// dust and adds the change, unless it's dust, in which case it's left to
+// the fee.
+func (p *DustPolicy) finishTx(msgTx *btcwire.MsgTx, change int64, changeScript []byte) error {
+	for i, txOut := range msgTx.TxOut {
+		if p.IsDust(txOut) {
+			str := fmt.Sprintf("output %d has %d satoshi, the dust limit is %d",
+				i, txOut.Value, p.Threshold(txOut.PkScript))
+			return MakeError(ErrDust, str, nil)
+		}
+	}
+	changeOut := btcwire.NewTxOut(change, changeScript)
+	if change > 0 && !p.IsDust(changeOut) {
+		msgTx.AddTxOut(changeOut)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package gochroma_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestDustThreshold(t *testing.T) {
+	p2sh := append(append([]byte{0xa9, 0x14}, make([]byte, 20)...), 0x87)
+	tests := []struct {
+		desc   string
+		policy *gochroma.DustPolicy
+		script []byte
+		want   int64
+	}{
+		{"p2pkh", gochroma.DefaultDustPolicy, tstScript(0), 546},
+		{"p2sh", gochroma.DefaultDustPolicy, p2sh, 540},
+		{"op_return", gochroma.DefaultDustPolicy, []byte{0x6a, 0x01, 0x00}, 0},
+		{"higher fee", &gochroma.DustPolicy{RelayFee: 10000}, tstScript(0), 5460},
+		{"nil", nil, tstScript(0), 0},
+	}
+
+	for _, test := range tests {
+		// Execute
+		got := test.policy.Threshold(test.script)
+
+		// Verify
+		if got != test.want {
+			t.Errorf("%v: got threshold %d, want %d", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestNewNetKernelRegistry(t *testing.T) {
+	// Setup
+	policy := gochroma.NetDustPolicy(&btcnet.MainNetParams)
+
+	// Execute
+	r, err := gochroma.NewNetKernelRegistry(&btcnet.MainNetParams)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to make registry: %v", err)
+	}
+	kernel, err := r.Get(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	epobc := kernel.(*gochroma.EPOBC)
+	if epobc.MinimumSatoshi != 546 {
+		t.Errorf("wrong minimum satoshi: got %d, want 546", epobc.MinimumSatoshi)
+	}
+	if epobc.Dust != policy {
+		t.Errorf("kernel doesn't have the network's dust policy")
+	}
+}
+
+func TestDustChange(t *testing.T) {
+	// Setup
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	tests := []struct {
+		desc    string
+		change  int64
+		outputs int
+	}{
+		{"dust", 545, 1},
+		{"not dust", 546, 2},
+	}
+
+	for _, test := range tests {
+		chain := kerneltest.NewMemChain()
+		b := chain.NewBlockExplorer()
+		funding := chain.Fund(spobc.IssuingSatoshiNeeded(1)+1000+test.change, tstScript(0))
+		chain.Mine()
+		outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), 1}}
+
+		// Execute
+		tx, err := spobc.IssuingTx(b, []*btcwire.OutPoint{funding}, outputs, tstScript(0), 1000)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: failed to make issuing tx: %v", test.desc, err)
+			continue
+		}
+		if len(tx.TxOut) != test.outputs {
+			t.Errorf("%v: got %d outputs, want %d", test.desc, len(tx.TxOut), test.outputs)
+		}
+	}
+}
+
+func TestDustColorOutput(t *testing.T) {
+	// Setup
+	epobc := &gochroma.EPOBC{MinimumSatoshi: 1, Dust: gochroma.DefaultDustPolicy}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), 100}}
+
+	// Execute
+	_, err := epobc.IssuingTx(b, []*btcwire.OutPoint{funding}, outputs, tstScript(0), 1000)
+
+	// Verify
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	want := gochroma.ErrorCode(gochroma.ErrDust)
+	if rerr.ErrorCode != want {
+		t.Errorf("wrong error, want %v, got %v", want, rerr)
+	}
+}
@@ -2,48 +2,137 @@ package gochroma
 
 import (
 	"fmt"
+	"math"
 	"sort"
 
 	"github.com/btcsuite/btcwire"
 )
 
 var (
-	// first 6 bits are 101001
+	// first 6 bits are 101001, the next 6 the padding exponent
 	EPOBCGenesisMarker = NewBitList(37, 6)
 	// first 6 bits are 110011
 	EPOBCTransferMarker = NewBitList(51, 6)
+	// first 6 bits are 101101, the next 6 the padding exponent and the
+	// last 20 one less than the number of outputs issued to
+	EPOBCMultiGenesisMarker = NewBitList(45, 6)
 )
 
 func init() {
-	RegisterColorKernel(&EPOBC{MinimumSatoshi: int64(5430)})
+	RegisterColorKernel(&EPOBC{MinimumSatoshi: DefaultMinimumSatoshi, Dust: DefaultDustPolicy})
 }
 
+// EPOBC is the enhanced padded order-based coloring kernel. The nSequence
+// of the first input tags a tx: bits 0-5 are the genesis or transfer
+// marker and bits 6-11 the exponent of the padding, the satoshi every
+// colored output carries beyond its color value. A genesis issues to
+// output 0, which is the genesis of the color.
+//
+// Issuing to several outputs at once is an extension of the protocol
+// with a marker of its own, EPOBCMultiGenesisMarker, so that other EPOBC
+// clients don't take it for a genesis issuing to output 0 alone. Bits
+// 12-31 of its nSequence hold one less than the number of outputs issued
+// to, which are the first outputs of the tx, and output 0 is still the
+// genesis of the color.
 type EPOBC struct {
 	MinimumSatoshi int64
+	// outputs the builders make have to clear it, and change that
+	// doesn't goes to the fee
+	Dust *DustPolicy
+	// markers of a kernel built on EPOBC, nil for EPOBC's own
+	markers *epobcMarkers
 }
 
+// epobcMarkers are what a kernel built on EPOBC tags its txs with, so
+// that they can't be taken for EPOBC txs.
+type epobcMarkers struct {
+	code string
+	// genesis issuing to output 0 alone, nil if the kernel has none
+	genesis BitList
+	// genesis with the number of outputs issued to in bits 12-31
+	multiGenesis BitList
+	transfer     BitList
+}
+
+var epobcOwnMarkers = &epobcMarkers{
+	code:         "EPOBC",
+	genesis:      EPOBCGenesisMarker,
+	multiGenesis: EPOBCMultiGenesisMarker,
+	transfer:     EPOBCTransferMarker,
+}
+
+// tags returns the markers of the kernel.
+func (k EPOBC) tags() *epobcMarkers {
+	if k.markers == nil {
+		return epobcOwnMarkers
+	}
+	return k.markers
+}
+
+// txMarker decodes the marker of the tx if EPOBC tagged it
+func (k EPOBC) txMarker(tx *btcwire.MsgTx) *TxMarker {
+	if len(tx.TxIn) == 0 {
+		return nil
+	}
+	return k.DetectMarker(NewBitList(tx.TxIn[0].Sequence, 32))
+}
+
+// fetchPadding returns the padding of the tx if EPOBC tagged it and 0
+// otherwise.
 func (k EPOBC) fetchPadding(tx *btcwire.MsgTx) int64 {
-	bitList := NewBitList(tx.TxIn[0].Sequence, 32)
-	number := int64(0)
-	digit := int64(1)
-	for _, bit := range bitList[6:12] {
-		if bit {
-			number += digit
-		}
-		digit *= 2
+	marker := k.txMarker(tx)
+	if marker == nil {
+		return 0
 	}
-	return number
+	return marker.Padding
 }
 
 func (k EPOBC) Code() string {
 	return "EPOBC"
 }
 
+// DetectMarker recognizes the nSequence of EPOBC genesis and transfer
+// transactions and decodes the padding from the exponent that follows
+// the marker.
+func (k EPOBC) DetectMarker(sequence BitList) *TxMarker {
+	if len(sequence) < 12 {
+		return nil
+	}
+	markers := k.tags()
+	var kind TxKind
+	outputs := 0
+	switch {
+	case sequence[:6].Equal(markers.genesis):
+		// whatever the rest of the bits are
+		kind, outputs = TxKindGenesis, 1
+	case sequence[:6].Equal(markers.multiGenesis):
+		kind, outputs = TxKindGenesis, int(sequence[12:].Uint32())+1
+	case sequence[:6].Equal(markers.transfer):
+		kind = TxKindTransfer
+	default:
+		return nil
+	}
+	exponent := sequence[6:12].Uint32()
+	if exponent > 62 {
+		// the padding wouldn't fit in a satoshi value
+		return nil
+	}
+	return &TxMarker{
+		Code:    markers.code,
+		Kind:    kind,
+		Padding: int64(1) << exponent,
+		Outputs: outputs,
+	}
+}
+
 func (k EPOBC) paddingNeeded(cv ColorValue) (BitList, int64) {
 	// figure out the power of 2 that will get us the padding needed
 
 	var padding int64
 	exponent := uint32(0)
+	if cv >= ColorValue(k.MinimumSatoshi) {
+		return NewBitList(exponent, 6), 1
+	}
 	paddingNeeded := k.MinimumSatoshi - int64(cv)
 	for padding = 1; padding < paddingNeeded; padding *= 2 {
 		exponent++
@@ -58,9 +147,31 @@ func (k EPOBC) computeSequence(m1, m2 BitList) uint32 {
 	return combined.Combine(empty).Uint32()
 }
 
+// genesisSequence is computeSequence for a genesis issuing to the number
+// of outputs given. The multiple output marker is only used when the
+// kernel has no other, or there's more than one output.
+func (k EPOBC) genesisSequence(exponentMarker BitList, outputs int) uint32 {
+	markers := k.tags()
+	if markers.genesis != nil && outputs == 1 {
+		return k.computeSequence(markers.genesis, exponentMarker)
+	}
+	count := NewBitList(uint32(outputs-1), 20)
+	return markers.multiGenesis.Combine(exponentMarker).Combine(count).Uint32()
+}
+
+// IssuingSatoshiNeeded returns math.MaxInt64 for color values too big
+// to ever issue.
 func (k EPOBC) IssuingSatoshiNeeded(cv ColorValue) int64 {
 	_, padding := k.paddingNeeded(cv)
-	return padding + int64(cv)
+	satoshi, err := cv.Satoshi()
+	if err != nil {
+		return math.MaxInt64
+	}
+	needed, err := AddSatoshi(padding, satoshi)
+	if err != nil {
+		return math.MaxInt64
+	}
+	return needed
 }
 
 func (k EPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, outputs []*ColorOut, fee int64) (*int64, error) {
@@ -80,7 +191,10 @@ func (k EPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, outputs [
 		if err != nil {
 			return nil, err
 		}
-		sum += value
+		sum, err = AddSatoshi(sum, value)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if fee < 0 {
@@ -91,7 +205,11 @@ func (k EPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, outputs [
 	cvSum := ColorValue(0)
 	cvMin := ColorValue(k.MinimumSatoshi)
 	for _, output := range outputs {
-		cvSum += output.ColorValue
+		var err error
+		cvSum, err = cvSum.Add(output.ColorValue)
+		if err != nil {
+			return nil, err
+		}
 		if cvMin > output.ColorValue {
 			cvMin = output.ColorValue
 		}
@@ -99,7 +217,22 @@ func (k EPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, outputs [
 
 	// add up all inputs in order and see if we have enough
 	_, padding := k.paddingNeeded(cvMin)
-	amountNeeded := fee + int64(padding)*int64(len(outputs)) + int64(cvSum)
+	paddingSum, err := MulSatoshi(padding, len(outputs))
+	if err != nil {
+		return nil, err
+	}
+	satoshiSum, err := cvSum.Satoshi()
+	if err != nil {
+		return nil, err
+	}
+	amountNeeded, err := AddSatoshi(fee, paddingSum)
+	if err != nil {
+		return nil, err
+	}
+	amountNeeded, err = AddSatoshi(amountNeeded, satoshiSum)
+	if err != nil {
+		return nil, err
+	}
 
 	if sum < amountNeeded {
 		str := fmt.Sprintf("have %d satoshi, need %d satoshi to issue", sum,
@@ -112,6 +245,13 @@ func (k EPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, outputs [
 
 func (k EPOBC) OutPointToColorIn(b *BlockExplorer,
 	genesis, outPoint *btcwire.OutPoint) (*ColorIn, error) {
+	return k.outPointToColorIn(b, k, genesis, outPoint)
+}
+
+// outPointToColorIn traces the outpoint with the kernel given, which is
+// EPOBC itself or a kernel built on it.
+func (k EPOBC) outPointToColorIn(b *BlockExplorer, kernel ColorKernel,
+	genesis, outPoint *btcwire.OutPoint) (*ColorIn, error) {
 
 	colorIn := &ColorIn{
 		OutPoint:   outPoint,
@@ -136,41 +276,26 @@ func (k EPOBC) OutPointToColorIn(b *BlockExplorer,
 	if value == 0 {
 		return colorIn, nil
 	}
-	current := outPoint
-	genesisHeight, err := b.OutPointHeight(genesis)
+	// the color value can come from several inputs through several txs
+	// so walk the whole provenance back to the genesis
+	cd := &ColorDefinition{ColorKernel: kernel, Genesis: genesis}
+	p, err := cd.Provenance(b, outPoint)
 	if err != nil {
 		return nil, err
 	}
-
-	for !genesis.Hash.IsEqual(&current.Hash) {
-		height, err := b.OutPointHeight(current)
-		if err != nil {
-			return nil, err
-		}
-		if height < genesisHeight {
-			return colorIn, nil
-		}
-		tx, err := b.OutPointTx(current)
-		if err != nil {
-			return nil, err
-		}
-		inputs, err := k.FindAffectingInputs(
-			b, genesis, tx.MsgTx(), []int{int(current.Index)})
-		if err != nil {
-			return nil, err
-		}
-		if inputs == nil {
-			return colorIn, nil
-		}
-		// TODO: traverse all affecting inputs and get the correct color value
-	}
+	colorIn.ColorValue = p.ColorValue
 	return colorIn, nil
 }
 
 func (k EPOBC) ColorInsValid(b *BlockExplorer, genesis *btcwire.OutPoint,
 	colorIns []*ColorIn) (bool, error) {
+	return k.colorInsValid(b, k, genesis, colorIns)
+}
+
+func (k EPOBC) colorInsValid(b *BlockExplorer, kernel ColorKernel,
+	genesis *btcwire.OutPoint, colorIns []*ColorIn) (bool, error) {
 	for _, colorIn := range colorIns {
-		calculated, err := k.OutPointToColorIn(b, genesis, colorIn.OutPoint)
+		calculated, err := k.outPointToColorIn(b, kernel, genesis, colorIn.OutPoint)
 		if err != nil {
 			return false, err
 		}
@@ -181,15 +306,49 @@ func (k EPOBC) ColorInsValid(b *BlockExplorer, genesis *btcwire.OutPoint,
 	return true, nil
 }
 
+// IssuingTx returns the unsigned genesis tx issuing the color values of
+// the outputs, in order. Every output gets the same padding, enough for
+// the smallest color value, and the change goes last. A tx issuing to
+// more than one output is tagged with EPOBCMultiGenesisMarker.
 func (k EPOBC) IssuingTx(b *BlockExplorer, inputs []*btcwire.OutPoint,
 	outputs []*ColorOut, changeScript []byte,
 	fee int64) (*btcwire.MsgTx, error) {
+	return k.issuingTx(b, inputs, outputs, nil, changeScript, fee)
+}
+
+// issuingTx is IssuingTx with uncolored extra outputs going between the
+// issued outputs and the change.
+func (k EPOBC) issuingTx(b *BlockExplorer, inputs []*btcwire.OutPoint,
+	outputs []*ColorOut, extra []*btcwire.TxOut, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
 
-	if len(outputs) != 1 {
-		str := fmt.Sprintf("epobc should have exactly 1 output: %d", len(outputs))
+	if len(outputs) == 0 || len(outputs) > 1<<20 {
+		str := fmt.Sprintf("epobc should have between 1 and %d outputs: %d",
+			1<<20, len(outputs))
 		return nil, MakeError(ErrInvalidColorValue, str, nil)
 	}
+	minimum := ColorValue(1<<64 - 1)
+	for _, output := range outputs {
+		if output.ColorValue <= 0 {
+			return nil, MakeError(ErrInvalidColorValue, "All Color Outputs should have a non-zero color value", nil)
+		}
+		if minimum > output.ColorValue {
+			minimum = output.ColorValue
+		}
+	}
 
+	if fee < 0 {
+		str := fmt.Sprintf("fee is negative: %d", fee)
+		return nil, MakeError(ErrNegativeValue, str, nil)
+	}
+	// the extra outputs are paid for like the fee
+	for _, txOut := range extra {
+		var err error
+		fee, err = AddSatoshi(fee, txOut.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
 	change, err := k.getChange(b, inputs, outputs, fee)
 	if err != nil {
 		return nil, err
@@ -197,9 +356,9 @@ func (k EPOBC) IssuingTx(b *BlockExplorer, inputs []*btcwire.OutPoint,
 
 	// create the transaction
 	msgTx := btcwire.NewMsgTx()
-	exponentMarker, padding := k.paddingNeeded(outputs[0].ColorValue)
+	exponentMarker, padding := k.paddingNeeded(minimum)
 
-	sequence := k.computeSequence(EPOBCGenesisMarker, exponentMarker)
+	sequence := k.genesisSequence(exponentMarker, len(outputs))
 	for i, input := range inputs {
 		txIn := btcwire.NewTxIn(input, nil)
 		// add the special nSequence marker for the first input only
@@ -208,9 +367,16 @@ func (k EPOBC) IssuingTx(b *BlockExplorer, inputs []*btcwire.OutPoint,
 		}
 		msgTx.AddTxIn(txIn)
 	}
-	msgTx.AddTxOut(btcwire.NewTxOut(padding+int64(outputs[0].ColorValue), outputs[0].Script))
-	if *change > 0 {
-		msgTx.AddTxOut(btcwire.NewTxOut(*change, changeScript))
+	for _, output := range outputs {
+		amount := padding + int64(output.ColorValue)
+		msgTx.AddTxOut(btcwire.NewTxOut(amount, output.Script))
+	}
+	for _, txOut := range extra {
+		msgTx.AddTxOut(txOut)
+	}
+	err = k.Dust.finishTx(msgTx, *change, changeScript)
+	if err != nil {
+		return nil, err
 	}
 	return msgTx, nil
 }
@@ -225,9 +391,14 @@ func (k EPOBC) TransferringTx(b *BlockExplorer, inputs []*ColorIn,
 		if in.ColorValue <= 0 {
 			return nil, MakeError(ErrInsufficientColorValue, "All Color Inputs should have a non-zero color value", nil)
 		}
-		inSum += in.ColorValue
+		var err error
+		inSum, err = inSum.Add(in.ColorValue)
+		if err != nil {
+			return nil, err
+		}
 	}
-	minimum := ColorValue(1<<64 - 1)
+	// start where getChange does, so both pad the outputs the same
+	minimum := ColorValue(k.MinimumSatoshi)
 	for _, out := range outputs {
 		if out.ColorValue <= 0 {
 			return nil, MakeError(ErrInsufficientColorValue, "All Color Outputs should have a non-zero color value", nil)
@@ -235,7 +406,11 @@ func (k EPOBC) TransferringTx(b *BlockExplorer, inputs []*ColorIn,
 		if minimum > out.ColorValue {
 			minimum = out.ColorValue
 		}
-		outSum += out.ColorValue
+		var err error
+		outSum, err = outSum.Add(out.ColorValue)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// inputs should have more (with destroy) or equal colorvalue than outputs
@@ -254,7 +429,14 @@ func (k EPOBC) TransferringTx(b *BlockExplorer, inputs []*ColorIn,
 
 	// create the transaction
 	exponentMarker, padding := k.paddingNeeded(minimum)
-	sequence := k.computeSequence(EPOBCTransferMarker, exponentMarker)
+	if outSum < inSum {
+		exponentMarker, padding, *change, err = k.destroyingPadding(
+			padding, *change, changeScript, len(outputs), inSum-outSum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sequence := k.computeSequence(k.tags().transfer, exponentMarker)
 	msgTx := btcwire.NewMsgTx()
 	for i, input := range inputs {
 		txIn := btcwire.NewTxIn(input.OutPoint, nil)
@@ -268,46 +450,182 @@ func (k EPOBC) TransferringTx(b *BlockExplorer, inputs []*ColorIn,
 		txOut := btcwire.NewTxOut(amount, output.Script)
 		msgTx.AddTxOut(txOut)
 	}
-	if *change > 0 {
-		msgTx.AddTxOut(btcwire.NewTxOut(*change, changeScript))
+	err = k.Dust.finishTx(msgTx, *change, changeScript)
+	if err != nil {
+		return nil, err
 	}
 	return msgTx, nil
 }
 
+// destroyingPadding returns the exponent marker, padding and change of a
+// transfer destroying color value. The change comes right after the
+// outputs, so it takes the color value being destroyed unless it's dust,
+// reaches past the color value of the inputs or has no more satoshi than
+// the padding. When none of that holds, the padding is raised until the
+// change has no more than it, the outputs taking the difference.
+func (k EPOBC) destroyingPadding(padding, change int64, changeScript []byte,
+	outputs int, destroyed ColorValue) (BitList, int64, int64, error) {
+
+	paddingSum, err := MulSatoshi(padding, outputs)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	// the satoshi the padding and the change share
+	shared, err := AddSatoshi(change, paddingSum)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	exponent := uint32(0)
+	for int64(1)<<exponent < padding {
+		exponent++
+	}
+	for ; exponent < 63; exponent++ {
+		padding = int64(1) << exponent
+		paddingSum, err = MulSatoshi(padding, outputs)
+		if err != nil || paddingSum > shared {
+			break
+		}
+		change = shared - paddingSum
+		// dust change is left to the fee, see finishTx
+		dust := change <= 0 || k.Dust.IsDust(btcwire.NewTxOut(change, changeScript))
+		if dust || change <= padding || ColorValue(change-padding) > destroyed {
+			return NewBitList(exponent, 6), padding, change, nil
+		}
+	}
+	str := fmt.Sprintf("not enough satoshi to pad %d outputs so that the "+
+		"change doesn't take the %d color value destroyed", outputs, destroyed)
+	return nil, 0, 0, MakeError(ErrInsufficientFunds, str, nil)
+}
+
+// CalculateOutColorValues applies the order-based rules of EPOBC. The
+// outputs a genesis issues to get their value minus the padding, and a
+// genesis other than output 0 is an ErrBadOutputIndex error. In a
+// transfer every output takes its value minus the padding from the inputs
+// in order, and is colored only if all of it comes from colored inputs. Inputs are
+// taken to bring exactly their color value, which is right when the
+// colored inputs come first like in the txs TransferringTx builds; use
+// CalculateOutColorValuesOnChain for txs that move several colors.
 func (k EPOBC) CalculateOutColorValues(genesis *btcwire.OutPoint, tx *btcwire.MsgTx, inputs []ColorValue) ([]ColorValue, error) {
+	inValues := make([]int64, len(inputs))
+	for i, cv := range inputs {
+		var err error
+		inValues[i], err = cv.Satoshi()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k.calculate(genesis, tx, inputs, inValues)
+}
+
+// CalculateOutColorValuesOnChain is CalculateOutColorValues with the
+// inputs bringing the satoshi value of the outputs they spend minus the
+// padding of the tx those came from, so that the inputs of other colors
+// are matched against their own outputs.
+func (k EPOBC) CalculateOutColorValuesOnChain(b *BlockExplorer, genesis *btcwire.OutPoint, tx *btcwire.MsgTx, inputs []ColorValue) ([]ColorValue, error) {
+	marker := k.txMarker(tx)
+	if marker == nil || marker.Kind != TxKindTransfer {
+		// nothing about the inputs matters
+		return k.CalculateOutColorValues(genesis, tx, inputs)
+	}
+	colorIns, err := k.txColorIns(b, tx)
+	if err != nil {
+		return nil, err
+	}
+	inValues := make([]int64, len(colorIns))
+	for i, colorIn := range colorIns {
+		inValues[i] = int64(colorIn.ColorValue)
+	}
+	return k.calculate(genesis, tx, inputs, inValues)
+}
+
+func (k EPOBC) calculate(genesis *btcwire.OutPoint, tx *btcwire.MsgTx, inputs []ColorValue, inValues []int64) ([]ColorValue, error) {
 	outputs := make([]ColorValue, len(tx.TxOut))
+	marker := k.txMarker(tx)
+	if marker == nil {
+		return outputs, nil
+	}
 
 	// handle case where the tx is the issuing tx
 	txShaHash, err := tx.TxSha()
 	if err != nil {
 		return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
 	}
-	if genesis.Hash.String() == txShaHash.String() {
-		outputs[genesis.Index] = ColorValue(1)
+	if genesis.Hash.IsEqual(&txShaHash) {
+		if marker.Kind != TxKindGenesis {
+			return outputs, nil
+		}
+		err = k.checkGenesis(genesis)
+		if err != nil {
+			return nil, err
+		}
+		k.issue(tx, marker, outputs)
+		return outputs, nil
+	}
+	if marker.Kind != TxKindTransfer {
 		return outputs, nil
 	}
 
-	// check inputs don't sum to more than 1
-	sum := ColorValue(0)
-	txOutLength := len(tx.TxOut)
-	for i, value := range inputs {
-		sum += value
-		if value > ColorValue(1) {
-			err := fmt.Sprintf("too much color value, should be at most 1, got %d", value)
-			return nil, MakeError(ErrTooMuchColorValue, err, nil)
+	// each input covers the range [inEnds[i]-inValues[i], inEnds[i])
+	inEnds := make([]int64, len(inValues))
+	inSum := int64(0)
+	for i, value := range inValues {
+		if value > 0 {
+			inSum, err = AddSatoshi(inSum, value)
+			if err != nil {
+				return nil, err
+			}
 		}
-		if txOutLength > i && tx.TxOut[i].Value != 0 && value == ColorValue(1) {
-			outputs[i] = ColorValue(1)
+		inEnds[i] = inSum
+	}
+	outSum := int64(0)
+	for i, txOut := range tx.TxOut {
+		cv := paddedValue(txOut.Value, marker.Padding)
+		if cv == 0 {
+			continue
+		}
+		start := outSum
+		outSum, err = AddSatoshi(outSum, cv)
+		if err != nil {
+			return nil, err
+		}
+		if outSum > inSum {
+			continue
+		}
+		colored := true
+		for j, end := range inEnds {
+			if inValues[j] <= 0 || end <= start || end-inValues[j] >= outSum {
+				continue
+			}
+			if j >= len(inputs) || inputs[j] == 0 {
+				colored = false
+				break
+			}
+		}
+		if colored {
+			outputs[i] = ColorValue(cv)
 		}
 	}
-	if sum > ColorValue(1) {
-		err := fmt.Sprintf("too much color value, should be 1, got %d", sum)
-		return nil, MakeError(ErrTooMuchColorValue, err, nil)
-	} else if sum == 0 {
-		return outputs, nil
+	return outputs, nil
+}
+
+// checkGenesis returns an ErrBadOutputIndex error if the genesis isn't
+// output 0 of the genesis tx, so that an issuance has one color however
+// many outputs it issues to.
+func (k EPOBC) checkGenesis(genesis *btcwire.OutPoint) error {
+	if genesis.Index != 0 {
+		str := fmt.Sprintf("genesis %v:%d is not output 0 of the genesis tx",
+			genesis.Hash, genesis.Index)
+		return MakeError(ErrBadOutputIndex, str, nil)
 	}
+	return nil
+}
 
-	return outputs, nil
+// issue sets the color values of the outputs a genesis tx issues to,
+// which are the first marker.Outputs.
+func (k EPOBC) issue(tx *btcwire.MsgTx, marker *TxMarker, outputs []ColorValue) {
+	for i := 0; i < marker.Outputs && i < len(tx.TxOut); i++ {
+		outputs[i] = ColorValue(paddedValue(tx.TxOut[i].Value, marker.Padding))
+	}
 }
 
 func (k EPOBC) txColorIns(b *BlockExplorer, tx *btcwire.MsgTx) ([]*ColorIn, error) {
@@ -318,9 +636,15 @@ func (k EPOBC) txColorIns(b *BlockExplorer, tx *btcwire.MsgTx) ([]*ColorIn, erro
 			return nil, err
 		}
 		msgTx := prevTx.MsgTx()
+		index := txIn.PreviousOutPoint.Index
+		if int(index) >= len(msgTx.TxOut) {
+			str := fmt.Sprintf("tx %v has no output %d", txIn.PreviousOutPoint.Hash, index)
+			return nil, MakeError(ErrBadOutputIndex, str, nil)
+		}
+		value := paddedValue(msgTx.TxOut[index].Value, k.fetchPadding(msgTx))
 		colorIns[i] = &ColorIn{
 			OutPoint:   &txIn.PreviousOutPoint,
-			ColorValue: ColorValue(msgTx.TxOut[txIn.PreviousOutPoint.Index].Value - k.fetchPadding(msgTx)),
+			ColorValue: ColorValue(value),
 		}
 	}
 
@@ -336,32 +660,41 @@ func (k EPOBC) AffectingIndexes(colorIns []*ColorIn, outValues []int64, padding
 		wantOutput[outputIndex] = true
 	}
 
-	runningSums := make([]ColorValue, len(colorIns))
+	// each input covers the range [runningSums[i]-value, runningSums[i])
+	runningSums := make([]int64, len(colorIns))
+	values := make([]int64, len(colorIns))
+	inSum := int64(0)
 	for i, colorIn := range colorIns {
-		if i == 0 {
-			runningSums[i] = colorIn.ColorValue
-		} else {
-			runningSums[i] = runningSums[i-1] + colorIn.ColorValue
+		value, err := colorIn.ColorValue.Satoshi()
+		if err != nil {
+			return nil, err
+		}
+		inSum, err = AddSatoshi(inSum, value)
+		if err != nil {
+			return nil, err
 		}
+		values[i], runningSums[i] = value, inSum
 	}
-	inSum := runningSums[len(colorIns)-1]
-	runningIndex := 0
-	outSum := ColorValue(0)
+	outSum := int64(0)
 	inputIndexes := make(map[int]bool, len(colorIns))
 	for i, outValue := range outValues {
-		cv := ColorValue(outValue - padding)
-		outSum += ColorValue(cv)
-		if cv <= 0 || outSum > inSum {
+		cv := paddedValue(outValue, padding)
+		if cv == 0 {
 			continue
 		}
-		_, wantCurrent := wantOutput[i]
-		if runningIndex < len(runningSums) && wantCurrent && colorIns[runningIndex].ColorValue != 0 {
-			inputIndexes[runningIndex] = true
+		start := outSum
+		var err error
+		outSum, err = AddSatoshi(outSum, cv)
+		if err != nil {
+			return nil, err
+		}
+		if outSum > inSum || !wantOutput[i] {
+			continue
 		}
-		for runningIndex < len(runningSums) && runningSums[runningIndex] < outSum {
-			runningIndex++
-			if runningIndex < len(runningSums) && wantCurrent {
-				inputIndexes[runningIndex] = true
+		for j, end := range runningSums {
+			value := values[j]
+			if value != 0 && end > start && end-value < outSum {
+				inputIndexes[j] = true
 			}
 		}
 	}
@@ -385,18 +718,26 @@ func (k EPOBC) FindAffectingInputs(b *BlockExplorer, genesis *btcwire.OutPoint,
 		return nil, nil
 	}
 
+	// only transfers move color value from inputs to outputs
+	marker := k.txMarker(tx)
+	if marker == nil || marker.Kind != TxKindTransfer {
+		return nil, nil
+	}
+
 	// calculate the input color values
 	colorIns, err := k.txColorIns(b, tx)
 	if err != nil {
 		return nil, err
 	}
 
-	padding := k.fetchPadding(tx)
 	outputValues := make([]int64, len(tx.TxOut))
 	for i, out := range tx.TxOut {
 		outputValues[i] = out.Value
 	}
-	inputIndexes, err := k.AffectingIndexes(colorIns, outputValues, padding, outputIndexes)
+	inputIndexes, err := k.AffectingIndexes(colorIns, outputValues, marker.Padding, outputIndexes)
+	if err != nil {
+		return nil, err
+	}
 
 	var outPoints []*btcwire.OutPoint
 	for _, i := range inputIndexes {
@@ -405,3 +746,105 @@ func (k EPOBC) FindAffectingInputs(b *BlockExplorer, genesis *btcwire.OutPoint,
 
 	return outPoints, nil
 }
+
+// MultiColorTx returns the unsigned transaction moving the color value of
+// every group at once. The inputs and outputs of each group go in the
+// order the groups are given, so under the order-based rules the outputs
+// of a group take exactly the inputs of that group. Funding inputs come
+// after every colored input and the change goes last.
+func (k EPOBC) MultiColorTx(b *BlockExplorer, groups []*ColorGroup,
+	funding []*btcwire.OutPoint, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
+	return k.multiColorTx(b, k.Code(), groups, funding, changeScript, fee)
+}
+
+// multiColorTx is MultiColorTx for groups of the kernel with the code
+// given, which is EPOBC itself or a kernel built on it.
+func (k EPOBC) multiColorTx(b *BlockExplorer, code string, groups []*ColorGroup,
+	funding []*btcwire.OutPoint, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
+
+	var inputs []*btcwire.OutPoint
+	var outputs []*ColorOut
+	minimum := ColorValue(1<<64 - 1)
+	for i, group := range groups {
+		if group.Definition.Code() != code {
+			str := fmt.Sprintf("group %d is %v, not %v", i,
+				group.Definition.Code(), code)
+			return nil, MakeError(ErrUnknownKernel, str, nil)
+		}
+		groupOutputs := group.Outputs
+		if group.Change != nil {
+			var err error
+			groupOutputs, err = withColorChange(k, group.Inputs, group.Outputs, group.Change)
+			if err != nil {
+				return nil, err
+			}
+		}
+		inSum, outSum := ColorValue(0), ColorValue(0)
+		for _, in := range group.Inputs {
+			if in.ColorValue <= 0 {
+				return nil, MakeError(ErrInsufficientColorValue, "All Color Inputs should have a non-zero color value", nil)
+			}
+			var err error
+			inSum, err = inSum.Add(in.ColorValue)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, out := range groupOutputs {
+			if out.ColorValue <= 0 {
+				return nil, MakeError(ErrInsufficientColorValue, "All Color Outputs should have a non-zero color value", nil)
+			}
+			if minimum > out.ColorValue {
+				minimum = out.ColorValue
+			}
+			var err error
+			outSum, err = outSum.Add(out.ColorValue)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if outSum > inSum {
+			str := fmt.Sprintf("group %d sends %d color value, has %d", i, outSum, inSum)
+			return nil, MakeError(ErrInsufficientColorValue, str, nil)
+		}
+		// destroying would shift the inputs every later group takes from
+		if outSum < inSum {
+			str := fmt.Sprintf("group %d sends %d color value, has %d", i, outSum, inSum)
+			return nil, MakeError(ErrDestroyColorValue, str, nil)
+		}
+		inputs = append(inputs, OutPoints(group.Inputs)...)
+		outputs = append(outputs, groupOutputs...)
+	}
+	if len(outputs) == 0 {
+		return nil, MakeError(ErrInvalidTx, "no color outputs to send", nil)
+	}
+	inputs = append(inputs, funding...)
+
+	change, err := k.getChange(b, inputs, outputs, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	// create the transaction
+	exponentMarker, padding := k.paddingNeeded(minimum)
+	sequence := k.computeSequence(k.tags().transfer, exponentMarker)
+	msgTx := btcwire.NewMsgTx()
+	for i, input := range inputs {
+		txIn := btcwire.NewTxIn(input, nil)
+		if i == 0 {
+			txIn.Sequence = sequence
+		}
+		msgTx.AddTxIn(txIn)
+	}
+	for _, output := range outputs {
+		amount := int64(output.ColorValue) + padding
+		msgTx.AddTxOut(btcwire.NewTxOut(amount, output.Script))
+	}
+	err = k.Dust.finishTx(msgTx, *change, changeScript)
+	if err != nil {
+		return nil, err
+	}
+	return msgTx, nil
+}
@@ -1,12 +1,17 @@
 package gochroma_test
 
 import (
+	"bytes"
 	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
 	"testing"
 
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcwire"
 	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
 )
 
 var (
@@ -133,6 +138,111 @@ func TestEPOBCIssuingTx(t *testing.T) {
 
 }
 
+func TestEPOBCIssuingTxMultiple(t *testing.T) {
+	// Setup
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+	colorValues := []gochroma.ColorValue{10, 20, 30000}
+	outputs := make([]*gochroma.ColorOut, len(colorValues))
+	for i, cv := range colorValues {
+		outputs[i] = &gochroma.ColorOut{tstScript(byte(i + 1)), cv}
+	}
+
+	// Execute
+	tx, err := epobc.IssuingTx(b, []*btcwire.OutPoint{funding}, outputs, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("error issuing tx: %v", err)
+	}
+	shaHash := tstPublish(t, chain, tx)
+
+	// Verify
+	if len(tx.TxOut) != len(colorValues)+1 {
+		t.Fatalf("wrong number of tx outs: got %d, want %d",
+			len(tx.TxOut), len(colorValues)+1)
+	}
+	marker, err := gochroma.ClassifyTx(tx)
+	if err != nil {
+		t.Fatalf("failed to classify: %v", err)
+	}
+	if marker.Kind != gochroma.TxKindGenesis || marker.Outputs != len(colorValues) {
+		t.Fatalf("wrong marker: got %v with %d outputs, want genesis with %d",
+			marker.Kind, marker.Outputs, len(colorValues))
+	}
+	// padding for the smallest color value, 5430 - 10 rounded up
+	padding := int64(8192)
+	if marker.Padding != padding {
+		t.Errorf("wrong padding: got %d, want %d", marker.Padding, padding)
+	}
+	cd, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(shaHash, 0), 0)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	calculated, err := cd.RunKernel(tx, nil)
+	if err != nil {
+		t.Fatalf("failed to run kernel: %v", err)
+	}
+	wants := append(colorValues, 0)
+	for i, want := range wants {
+		if i < len(colorValues) && tx.TxOut[i].Value != int64(want)+padding {
+			t.Errorf("wrong amount at %d: got %d, want %d", i,
+				tx.TxOut[i].Value, int64(want)+padding)
+		}
+		if calculated[i] != want {
+			t.Errorf("wrong calculated color value at %d: got %d, want %d",
+				i, calculated[i], want)
+		}
+		cv, err := cd.ColorValue(b, btcwire.NewOutPoint(shaHash, uint32(i)))
+		if err != nil {
+			t.Fatalf("failed to trace output %d: %v", i, err)
+		}
+		if *cv != want {
+			t.Errorf("wrong traced color value at %d: got %d, want %d", i, *cv, want)
+		}
+	}
+
+	// an output after the first moves on like any other
+	outPoint := tstTransfer(t, chain, cd, btcwire.NewOutPoint(shaHash, 1), 20)
+	cv, err := cd.ColorValue(b, outPoint)
+	if err != nil {
+		t.Fatalf("failed to trace transfer: %v", err)
+	}
+	if *cv != 20 {
+		t.Errorf("wrong color value after transfer: got %d, want 20", *cv)
+	}
+
+	// the tx has the marker of its own, not the one issuing to output 0
+	wantSequence := gochroma.EPOBCMultiGenesisMarker.Combine(
+		gochroma.NewBitList(13|2<<6, 26)).Uint32()
+	if tx.TxIn[0].Sequence != wantSequence {
+		t.Errorf("wrong sequence: got %x, want %x", tx.TxIn[0].Sequence, wantSequence)
+	}
+
+	// only output 0 is the genesis, so the issuance has one color
+	for _, index := range []uint32{1, 2, 3} {
+		other, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(shaHash, index), 0)
+		if err != nil {
+			t.Fatalf("failed to make color definition: %v", err)
+		}
+		_, err = other.RunKernel(tx, nil)
+		if err == nil {
+			t.Errorf("genesis at %d: expected error, got nil", index)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(gochroma.ErrBadOutputIndex)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("genesis at %d: wrong error: got %v, want %v",
+				index, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
 func TestEPOBCIssuingTxError(t *testing.T) {
 	// Setup
 	epobc, err := gochroma.GetColorKernel(EPOBCKey)
@@ -176,10 +286,19 @@ func TestEPOBCIssuingTxError(t *testing.T) {
 			err:        gochroma.ErrInsufficientFunds,
 		},
 		{
-			desc:       "multiple outputs",
+			desc:       "no outputs",
 			bytes:      [][]byte{normalTx},
 			fee:        100,
 			colorValue: gochroma.ColorValue(5000),
+			colorOuts:  0,
+			spents:     []bool{false},
+			err:        gochroma.ErrInvalidColorValue,
+		},
+		{
+			desc:       "zero color value",
+			bytes:      [][]byte{normalTx},
+			fee:        100,
+			colorValue: gochroma.ColorValue(0),
 			colorOuts:  2,
 			spents:     []bool{false},
 			err:        gochroma.ErrInvalidColorValue,
@@ -399,6 +518,119 @@ func TestEPOBCTransferringTxError(t *testing.T) {
 	}
 }
 
+func TestEPOBCTransferringTxDestroy(t *testing.T) {
+	tests := []struct {
+		desc    string
+		outputs []gochroma.ColorValue
+		fee     int64
+	}{
+		{
+			desc:    "half",
+			outputs: []gochroma.ColorValue{10000},
+			fee:     0,
+		},
+		{
+			desc:    "half with a fee",
+			outputs: []gochroma.ColorValue{10000},
+			fee:     1000,
+		},
+		{
+			desc:    "all",
+			outputs: nil,
+			fee:     0,
+		},
+		{
+			desc:    "all with a fee",
+			outputs: nil,
+			fee:     1000,
+		},
+		{
+			desc:    "to two outputs",
+			outputs: []gochroma.ColorValue{8000, 7000},
+			fee:     0,
+		},
+	}
+
+	for _, test := range tests {
+		// Setup
+		chain := kerneltest.NewMemChain()
+		cd := tstIssue(t, chain, gochroma.EPOBC{
+			MinimumSatoshi: gochroma.DefaultMinimumSatoshi,
+			Dust:           gochroma.DefaultDustPolicy,
+		}, 20000)
+		b := chain.NewBlockExplorer()
+		inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 20000}}
+		outputs := make([]*gochroma.ColorOut, len(test.outputs))
+		for i, cv := range test.outputs {
+			outputs[i] = &gochroma.ColorOut{tstScript(2), cv}
+		}
+
+		// Execute
+		tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(3), test.fee, true)
+		if err != nil {
+			t.Errorf("%v: failed to make destroying tx: %v", test.desc, err)
+			continue
+		}
+
+		// Verify
+		if len(tx.TxOut) != len(outputs)+1 {
+			t.Errorf("%v: wrong number of outputs: got %d, want %d",
+				test.desc, len(tx.TxOut), len(outputs)+1)
+			continue
+		}
+		if !bytes.Equal(tx.TxOut[len(outputs)].PkScript, tstScript(3)) {
+			t.Errorf("%v: last output isn't the change", test.desc)
+			continue
+		}
+		got, err := cd.RunKernelOnChain(b, tx, []gochroma.ColorValue{20000})
+		if err != nil {
+			t.Errorf("%v: failed to run kernel: %v", test.desc, err)
+			continue
+		}
+		for i, cv := range got {
+			want := gochroma.ColorValue(0)
+			if i < len(test.outputs) {
+				want = test.outputs[i]
+			}
+			if cv != want {
+				t.Errorf("%v: wrong color value at output %d: got %d, want %d",
+					test.desc, i, cv, want)
+			}
+		}
+	}
+}
+
+func TestEPOBCTransferringTxDestroyError(t *testing.T) {
+	// Setup
+	chain := kerneltest.NewMemChain()
+	cd := tstIssue(t, chain, gochroma.EPOBC{
+		MinimumSatoshi: gochroma.DefaultMinimumSatoshi,
+		Dust:           gochroma.DefaultDustPolicy,
+	}, 20000)
+	b := chain.NewBlockExplorer()
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 20000}}
+	// the change can't be padded past the color value destroyed, nor
+	// below the padding without the outputs taking more than there is
+	outputs := []*gochroma.ColorOut{
+		&gochroma.ColorOut{tstScript(2), 6000},
+		&gochroma.ColorOut{tstScript(2), 6000},
+	}
+
+	// Execute
+	_, err := cd.TransferringTx(b, inputs, outputs, tstScript(3), 0, true)
+
+	// Verify
+	if err == nil {
+		t.Fatalf("got nil where we expected err")
+	}
+	rerr := err.(gochroma.ChromaError)
+	wantErr := gochroma.ErrorCode(gochroma.ErrInsufficientFunds)
+	if rerr.ErrorCode != wantErr {
+		t.Fatalf("wrong error passed back: got %v, want %v",
+			rerr.ErrorCode, wantErr)
+	}
+}
+
 func TestEPOBCCalculateGenesis(t *testing.T) {
 	// Setup
 	msgTx := btcwire.NewMsgTx()
@@ -410,13 +642,15 @@ func TestEPOBCCalculateGenesis(t *testing.T) {
 	}
 	prevOut := btcwire.NewOutPoint(shaHash, 0)
 	txIn := btcwire.NewTxIn(prevOut, nil)
+	// padding of 2^3
+	txIn.Sequence = gochroma.EPOBCGenesisMarker.Combine(gochroma.NewBitList(3, 26)).Uint32()
 	msgTx.AddTxIn(txIn)
 	epobcKernel, err := gochroma.GetColorKernel(EPOBCKey)
 	if err != nil {
 		t.Fatalf("error getting epobc kernel: %v", err)
 	}
 	epobc := epobcKernel.(*gochroma.EPOBC)
-	txOut := btcwire.NewTxOut(epobc.MinimumSatoshi, nil)
+	txOut := btcwire.NewTxOut(108, nil)
 	msgTx.AddTxOut(txOut)
 	genesisShaHash, err := msgTx.TxSha()
 	if err != nil {
@@ -435,8 +669,8 @@ func TestEPOBCCalculateGenesis(t *testing.T) {
 	if len(outputs) != 1 {
 		t.Fatalf("wrong number of outputs: got %v, want 1", len(outputs))
 	}
-	if outputs[0] != gochroma.ColorValue(1) {
-		t.Fatalf("wrong output value: got %v, want 1", outputs[0])
+	if outputs[0] != gochroma.ColorValue(100) {
+		t.Fatalf("wrong output value: got %v, want 100", outputs[0])
 	}
 }
 
@@ -446,36 +680,86 @@ func TestEPOBCCalculate(t *testing.T) {
 		t.Fatalf("error getting epobc kernel: %v", err)
 	}
 	epobc := epobcKernel.(*gochroma.EPOBC)
+	// padding of 2^4
+	transfer := gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(4, 26)).Uint32()
+	genesis := gochroma.EPOBCGenesisMarker.Combine(gochroma.NewBitList(4, 26)).Uint32()
 
 	tests := []struct {
-		desc           string
-		inputs         []gochroma.ColorValue
-		outputs        []gochroma.ColorValue
-		firstOutAmount int64
+		desc       string
+		sequence   uint32
+		inputs     []gochroma.ColorValue
+		outAmounts []int64
+		outputs    []gochroma.ColorValue
 	}{
 		{
-			desc:           "normal transfer",
-			inputs:         []gochroma.ColorValue{1},
-			outputs:        []gochroma.ColorValue{1},
-			firstOutAmount: epobc.MinimumSatoshi,
+			desc:       "normal transfer",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{5},
+			outAmounts: []int64{21},
+			outputs:    []gochroma.ColorValue{5},
+		},
+		{
+			desc:       "split",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{5},
+			outAmounts: []int64{18, 19},
+			outputs:    []gochroma.ColorValue{2, 3},
+		},
+		{
+			desc:       "join",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{2, 3},
+			outAmounts: []int64{21},
+			outputs:    []gochroma.ColorValue{5},
+		},
+		{
+			desc:       "multiple transfer",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{5, 0, 0, 0},
+			outAmounts: []int64{21, 20000},
+			outputs:    []gochroma.ColorValue{5, 0},
+		},
+		{
+			desc:       "destroy transfer",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{5},
+			outAmounts: []int64{19},
+			outputs:    []gochroma.ColorValue{3},
+		},
+		{
+			desc:       "too much color value",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{2, 2},
+			outAmounts: []int64{21},
+			outputs:    []gochroma.ColorValue{0},
 		},
 		{
-			desc:           "multiple transfer",
-			inputs:         []gochroma.ColorValue{1, 0, 0, 0},
-			outputs:        []gochroma.ColorValue{1, 0},
-			firstOutAmount: epobc.MinimumSatoshi,
+			desc:       "below padding",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{5},
+			outAmounts: []int64{16, 21},
+			outputs:    []gochroma.ColorValue{0, 5},
 		},
 		{
-			desc:           "destroy transfer",
-			inputs:         []gochroma.ColorValue{0, 1},
-			outputs:        []gochroma.ColorValue{0},
-			firstOutAmount: int64(100),
+			desc:       "null transfer",
+			sequence:   transfer,
+			inputs:     []gochroma.ColorValue{0, 0, 0},
+			outAmounts: []int64{21, 20000},
+			outputs:    []gochroma.ColorValue{0, 0},
 		},
 		{
-			desc:           "null transfer",
-			inputs:         []gochroma.ColorValue{0, 0, 0},
-			outputs:        []gochroma.ColorValue{0, 0},
-			firstOutAmount: epobc.MinimumSatoshi,
+			desc:       "untagged",
+			sequence:   btcwire.MaxTxInSequenceNum,
+			inputs:     []gochroma.ColorValue{5},
+			outAmounts: []int64{21},
+			outputs:    []gochroma.ColorValue{0},
+		},
+		{
+			desc:       "other genesis",
+			sequence:   genesis,
+			inputs:     []gochroma.ColorValue{5},
+			outAmounts: []int64{21},
+			outputs:    []gochroma.ColorValue{0},
 		},
 	}
 
@@ -483,7 +767,7 @@ OUTER:
 	for _, test := range tests {
 		// Setup
 		msgTx := btcwire.NewMsgTx()
-		for _ = range test.inputs {
+		for i := range test.inputs {
 			hashBytes := make([]byte, 32)
 			rand.Read(hashBytes)
 			shaHash, err := btcwire.NewShaHash(hashBytes)
@@ -493,14 +777,13 @@ OUTER:
 			}
 			prevOut := btcwire.NewOutPoint(shaHash, 0)
 			txIn := btcwire.NewTxIn(prevOut, nil)
+			if i == 0 {
+				txIn.Sequence = test.sequence
+			}
 			msgTx.AddTxIn(txIn)
 		}
-		txOut := btcwire.NewTxOut(test.firstOutAmount, nil)
-		msgTx.AddTxOut(txOut)
-		for _ = range test.outputs[1:] {
-			var txOut *btcwire.TxOut
-			txOut = btcwire.NewTxOut(20000, nil)
-			msgTx.AddTxOut(txOut)
+		for _, amount := range test.outAmounts {
+			msgTx.AddTxOut(btcwire.NewTxOut(amount, nil))
 		}
 		hashBytes := make([]byte, 32)
 		rand.Read(hashBytes)
@@ -542,21 +825,37 @@ func TestEPOBCCalculateError(t *testing.T) {
 		t.Fatalf("error getting epobc kernel: %v", err)
 	}
 	epobc := epobcKernel.(*gochroma.EPOBC)
+	transfer := gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(0, 26)).Uint32()
+	genesis := gochroma.EPOBCGenesisMarker.Combine(gochroma.NewBitList(0, 26)).Uint32()
 
 	tests := []struct {
-		desc   string
-		inputs []gochroma.ColorValue
-		err    int
+		desc     string
+		sequence uint32
+		inputs   []gochroma.ColorValue
+		// index of the genesis in the tx itself, -1 for another tx
+		genesisIndex int
+		err          int
 	}{
 		{
-			desc:   "too much color value",
-			inputs: []gochroma.ColorValue{1, 1},
-			err:    gochroma.ErrTooMuchColorValue,
+			desc:         "input too big for satoshi",
+			sequence:     transfer,
+			inputs:       []gochroma.ColorValue{math.MaxUint64},
+			genesisIndex: -1,
+			err:          gochroma.ErrInvalidColorValue,
 		},
 		{
-			desc:   "too much color value",
-			inputs: []gochroma.ColorValue{2, 0},
-			err:    gochroma.ErrTooMuchColorValue,
+			desc:         "inputs overflow",
+			sequence:     transfer,
+			inputs:       []gochroma.ColorValue{math.MaxInt64, math.MaxInt64},
+			genesisIndex: -1,
+			err:          gochroma.ErrInvalidColorValue,
+		},
+		{
+			desc:         "genesis past the outputs issued to",
+			sequence:     genesis,
+			inputs:       []gochroma.ColorValue{0},
+			genesisIndex: 1,
+			err:          gochroma.ErrBadOutputIndex,
 		},
 	}
 
@@ -576,17 +875,31 @@ OUTER:
 			txIn := btcwire.NewTxIn(prevOut, nil)
 			msgTx.AddTxIn(txIn)
 		}
-		hashBytes := make([]byte, 32)
-		rand.Read(hashBytes)
-		shaHash, err := btcwire.NewShaHash(hashBytes)
+		msgTx.TxIn[0].Sequence = test.sequence
+		msgTx.AddTxOut(btcwire.NewTxOut(100, nil))
+		msgTx.AddTxOut(btcwire.NewTxOut(100, nil))
+		var shaHash *btcwire.ShaHash
+		if test.genesisIndex == -1 {
+			hashBytes := make([]byte, 32)
+			rand.Read(hashBytes)
+			shaHash, err = btcwire.NewShaHash(hashBytes)
+		} else {
+			var txShaHash btcwire.ShaHash
+			txShaHash, err = msgTx.TxSha()
+			shaHash = &txShaHash
+		}
 		if err != nil {
 			t.Errorf("%v: err on shahash creation: %v", test.desc, err)
 			continue
 		}
-		genesis := btcwire.NewOutPoint(shaHash, 0)
+		index := test.genesisIndex
+		if index == -1 {
+			index = 0
+		}
+		genesisOutPoint := btcwire.NewOutPoint(shaHash, uint32(index))
 
 		// Execute
-		_, err = epobc.CalculateOutColorValues(genesis, msgTx, test.inputs)
+		_, err = epobc.CalculateOutColorValues(genesisOutPoint, msgTx, test.inputs)
 
 		// Verify
 		if err == nil {
@@ -598,11 +911,15 @@ OUTER:
 		if rerr.ErrorCode != wantErr {
 			t.Errorf("%v: wrong error passed back: got %v, want %v",
 				test.desc, rerr.ErrorCode, wantErr)
-			continue
 		}
 	}
 }
 
+func TestEPOBCConformance(t *testing.T) {
+	epobc := &gochroma.EPOBC{MinimumSatoshi: gochroma.DefaultMinimumSatoshi}
+	kerneltest.Run(t, epobc, kerneltest.NewMemChain(), 10000)
+}
+
 func TestEPOBCAffectingIndexes(t *testing.T) {
 	epobcKernel, err := gochroma.GetColorKernel(EPOBCKey)
 	if err != nil {
@@ -738,7 +1055,8 @@ func TestEPOBCAffectingInputs(t *testing.T) {
 	txIn := btcwire.NewTxIn(prevOut, nil)
 	txIn.Sequence = gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(8, 26)).Uint32()
 	msgTx.AddTxIn(txIn)
-	txOut := btcwire.NewTxOut(100, nil)
+	// padding of 2^8
+	txOut := btcwire.NewTxOut(300, nil)
 	msgTx.AddTxOut(txOut)
 	rand.Read(hashBytes)
 	genesisShaHash, err := btcwire.NewShaHash(hashBytes)
@@ -820,8 +1138,9 @@ func TestEPOBCAffectingError(t *testing.T) {
 	}
 	prevOut := btcwire.NewOutPoint(shaHash, 0)
 	txIn := btcwire.NewTxIn(prevOut, nil)
+	txIn.Sequence = gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(8, 26)).Uint32()
 	msgTx.AddTxIn(txIn)
-	txOut := btcwire.NewTxOut(100, nil)
+	txOut := btcwire.NewTxOut(300, nil)
 	msgTx.AddTxOut(txOut)
 	rand.Read(hashBytes)
 	genesisShaHash, err := btcwire.NewShaHash(hashBytes)
@@ -926,6 +1245,15 @@ func TestEPOBCOutPointToColorInError(t *testing.T) {
 	genesis := &tx.MsgTx().TxIn[0].PreviousOutPoint
 	outPoint := btcwire.NewOutPoint(tx.Sha(), 0)
 
+	// the same tx tagged as a transfer, so its inputs get looked up
+	transferTx := tx.MsgTx().Copy()
+	transferTx.TxIn[0].Sequence = gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(8, 26)).Uint32()
+	var buf bytes.Buffer
+	err = transferTx.Serialize(&buf)
+	if err != nil {
+		t.Fatalf("failed to serialize tx %v", err)
+	}
+
 	tests := []struct {
 		desc        string
 		blockReader TstBlockReaderWriter
@@ -970,7 +1298,7 @@ func TestEPOBCOutPointToColorInError(t *testing.T) {
 			blockReader: TstBlockReaderWriter{
 				txBlockHash: [][]byte{blockHash, blockHash},
 				block:       [][]byte{rawBlock, rawBlock},
-				rawTx:       [][]byte{normalTx, normalTx},
+				rawTx:       [][]byte{normalTx, buf.Bytes()},
 				txOutSpents: []bool{false},
 			},
 		},
@@ -1073,3 +1401,114 @@ func TestEPOBCColorInsValidError(t *testing.T) {
 			rerr.ErrorCode, wantErr)
 	}
 }
+
+// tstHostileTx makes a tx with the nSequence and output values given,
+// spending one made-up outpoint per input
+func tstHostileTx(sequence uint32, inputs int, outValues []uint64) *btcwire.MsgTx {
+	tx := btcwire.NewMsgTx()
+	for i := 0; i < inputs || i == 0; i++ {
+		txIn := btcwire.NewTxIn(btcwire.NewOutPoint(&btcwire.ShaHash{1}, uint32(i)), nil)
+		if i == 0 {
+			txIn.Sequence = sequence
+		}
+		tx.AddTxIn(txIn)
+	}
+	for _, value := range outValues {
+		tx.AddTxOut(btcwire.NewTxOut(int64(value), tstScript(1)))
+	}
+	return tx
+}
+
+// tstCheckEPOBCCalculate checks that whatever the tx, EPOBC only fails on
+// color values that don't fit in satoshi and never creates color value
+func tstCheckEPOBCCalculate(t *testing.T, exponent uint8, genesis bool, ins, outs []uint64) {
+	desc := fmt.Sprintf("exponent %d, genesis %v, inputs %v, outputs %v",
+		exponent, genesis, ins, outs)
+	epobc := &gochroma.EPOBC{MinimumSatoshi: gochroma.DefaultMinimumSatoshi}
+	marker := gochroma.EPOBCTransferMarker
+	if genesis {
+		marker = gochroma.EPOBCGenesisMarker
+	}
+	sequence := marker.Combine(gochroma.NewBitList(uint32(exponent%63)|0xfffff<<6, 26)).Uint32()
+	inputs := make([]gochroma.ColorValue, len(ins))
+	inSum := new(big.Int)
+	for i, cv := range ins {
+		inputs[i] = gochroma.ColorValue(cv)
+		inSum.Add(inSum, new(big.Int).SetUint64(cv))
+	}
+	tx := tstHostileTx(sequence, len(inputs), outs)
+	genesisOutPoint := btcwire.NewOutPoint(&btcwire.ShaHash{2}, 0)
+	if genesis {
+		shaHash, _ := tx.TxSha()
+		genesisOutPoint = btcwire.NewOutPoint(&shaHash, 0)
+	}
+
+	outputs, err := epobc.CalculateOutColorValues(genesisOutPoint, tx, inputs)
+	if err != nil {
+		rerr := err.(gochroma.ChromaError)
+		if rerr.ErrorCode != gochroma.ErrorCode(gochroma.ErrInvalidColorValue) {
+			t.Errorf("%v: wrong error passed back: %v", desc, err)
+		}
+		return
+	}
+
+	if len(outputs) != len(tx.TxOut) {
+		t.Errorf("%v: wrong number of outputs: got %d, want %d", desc, len(outputs), len(tx.TxOut))
+		return
+	}
+	outSum := new(big.Int)
+	for i, cv := range outputs {
+		if cv > 0 && (tx.TxOut[i].Value <= 0 || uint64(cv) >= uint64(tx.TxOut[i].Value)) {
+			t.Errorf("%v: output %d has %d color value but %d satoshi", desc, i, cv, tx.TxOut[i].Value)
+			return
+		}
+		outSum.Add(outSum, new(big.Int).SetUint64(uint64(cv)))
+	}
+	if !genesis && outSum.Cmp(inSum) > 0 {
+		t.Errorf("%v: created color value: %v in, %v out", desc, inSum, outSum)
+	}
+
+	colorIns := make([]*gochroma.ColorIn, len(inputs))
+	for i, cv := range inputs {
+		colorIns[i] = &gochroma.ColorIn{OutPoint: &tx.TxIn[i].PreviousOutPoint, ColorValue: cv}
+	}
+	outValues := make([]int64, len(tx.TxOut))
+	outIndexes := make([]int, len(tx.TxOut))
+	for i, txOut := range tx.TxOut {
+		outValues[i], outIndexes[i] = txOut.Value, i
+	}
+	indexes, err := epobc.AffectingIndexes(colorIns, outValues, 1<<(exponent%63), outIndexes)
+	if err != nil {
+		return
+	}
+	for _, index := range indexes {
+		if index < 0 || index >= len(colorIns) {
+			t.Errorf("%v: affecting index %d out of range", desc, index)
+			return
+		}
+	}
+}
+
+func TestEPOBCCalculateProperties(t *testing.T) {
+	tests := []struct {
+		exponent uint8
+		genesis  bool
+		inputs   []uint64
+		outputs  []uint64
+	}{
+		{4, false, []uint64{5}, []uint64{21}},
+		{0, false, []uint64{math.MaxUint64, 2}, []uint64{3, 1 << 63}},
+		{0, false, []uint64{1 << 62, 1 << 62}, []uint64{1 << 62, 1 << 62, 1 << 62}},
+		{62, false, []uint64{1}, []uint64{1 << 63, math.MaxInt64}},
+		{3, true, nil, []uint64{1 << 63, 9, math.MaxInt64}},
+	}
+	for _, test := range tests {
+		tstCheckEPOBCCalculate(t, test.exponent, test.genesis, test.inputs, test.outputs)
+	}
+
+	r := tstRand()
+	for i := 0; i < 500; i++ {
+		tstCheckEPOBCCalculate(t, uint8(r.Intn(256)), r.Intn(2) == 0,
+			tstRandUint64s(r, 16), tstRandUint64s(r, 16))
+	}
+}
@@ -24,6 +24,23 @@ const (
 	ErrDestroyColorValue
 	ErrOutPointSpent
 	ErrUnknownKernel
+	ErrBadHeight
+	ErrBadTrade
+	ErrBadAsset
+	ErrNotAuthority
+	ErrBadBurn
+	ErrBadMarker
+	ErrBadPadding
+	ErrDust
+	ErrInvalidColorTx
+	ErrNoFeeEstimate
+	ErrSign
+	ErrBadSignature
+	ErrBadPartialTx
+	ErrRBFConflict
+	ErrBadPaymentURI
+	ErrBadColoredAddress
+	ErrPlainAddress
 )
 
 type ErrorCode int
@@ -48,6 +65,23 @@ var errCodeStrings = map[ErrorCode]string{
 	ErrDestroyColorValue:      "color funds are being destroyed",
 	ErrOutPointSpent:          "tx outpoint has been spent already",
 	ErrUnknownKernel:          "unknown kernel",
+	ErrBadHeight:              "block height is out of range",
+	ErrBadTrade:               "trade does not match the offer",
+	ErrBadAsset:               "asset metadata is invalid",
+	ErrNotAuthority:           "outpoint is not the issuance authority",
+	ErrBadBurn:                "burn does not destroy what it claims",
+	ErrBadMarker:              "nSequence marker is wrong for the tx",
+	ErrBadPadding:             "padding leaves a colored output below dust",
+	ErrDust:                   "output is below the dust limit",
+	ErrInvalidColorTx:         "colored transaction failed validation",
+	ErrNoFeeEstimate:          "no fee estimate is available",
+	ErrSign:                   "unable to sign the tx",
+	ErrBadSignature:           "signature script does not verify",
+	ErrBadPartialTx:           "partially signed tx is inconsistent",
+	ErrRBFConflict:            "replace-by-fee conflicts with the color of the tx",
+	ErrBadPaymentURI:          "payment request uri is invalid",
+	ErrBadColoredAddress:      "colored address is invalid or for another color",
+	ErrPlainAddress:           "address does not say it takes the color",
 }
 
 func (e ErrorCode) String() string {
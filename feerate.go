@@ -0,0 +1,159 @@
+package gochroma
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// Sizes of what signing adds to a tx, for estimating the fee before the
+// tx is signed.
+const (
+	// P2PKHSigScriptSize is the signature script spending a
+	// pay-to-pubkey-hash output: a signature of at most 72 bytes with the
+	// hash type and a compressed public key, each with its push.
+	P2PKHSigScriptSize = 1 + 73 + 1 + 33
+
+	// txOverhead is the version, the input and output counts and the
+	// lock time of a tx with fewer than 253 of either.
+	txOverhead = 4 + 1 + 1 + 4
+	// p2pkhInputSize is an input spending a pay-to-pubkey-hash output.
+	p2pkhInputSize = 32 + 4 + 1 + P2PKHSigScriptSize + 4
+	// p2pkhOutputSize is an output paying to a pubkey hash.
+	p2pkhOutputSize = 8 + 1 + 25
+)
+
+// MultisigSigScriptSize returns the size of the signature script spending
+// a pay-to-script-hash output of an m of n multisig script with
+// compressed public keys.
+func MultisigSigScriptSize(m, n int) int {
+	redeemScript := 1 + n*(1+33) + 1 + 1
+	push := 1
+	switch {
+	case redeemScript > 0xff:
+		push = 3
+	case redeemScript >= 0x4c:
+		push = 2
+	}
+	// OP_0 for the extra item OP_CHECKMULTISIG pops
+	return 1 + m*(1+73) + push + redeemScript
+}
+
+// SignedTxSize returns the size the unsigned tx will be once its inputs
+// are signed with signature scripts of the sizes given, in order. Inputs
+// past the end of the sizes are taken to spend pay-to-pubkey-hash outputs.
+func SignedTxSize(tx *btcwire.MsgTx, sigScriptSizes []int) int {
+	size := tx.SerializeSize()
+	for i, txIn := range tx.TxIn {
+		sigScriptSize := P2PKHSigScriptSize
+		if i < len(sigScriptSizes) {
+			sigScriptSize = sigScriptSizes[i]
+		}
+		current := len(txIn.SignatureScript)
+		size -= btcwire.VarIntSerializeSize(uint64(current)) + current
+		size += btcwire.VarIntSerializeSize(uint64(sigScriptSize)) + sigScriptSize
+	}
+	return size
+}
+
+// FeeRate is a fee in satoshi per 1000 bytes of tx.
+type FeeRate int64
+
+// FeeForSize returns the fee of a tx of the size given, rounded up.
+func (r FeeRate) FeeForSize(size int) int64 {
+	return (int64(r)*int64(size) + 999) / 1000
+}
+
+// Fee makes the rate a FeePolicy, for a tx spending and paying to
+// pubkey hashes.
+func (r FeeRate) Fee(inputs, outputs int) int64 {
+	return r.FeeForSize(txOverhead + inputs*p2pkhInputSize + outputs*p2pkhOutputSize)
+}
+
+// buildAtRate builds the tx with a fee that covers the rate for its signed
+// size. Each time the fee isn't enough the tx is built again with more,
+// which ends as the fee only goes up and the size can't grow past that
+// of the tx with change. The fee returned is what the tx pays, which is
+// more when the builder left dust change to the fee.
+func buildAtRate(b *BlockExplorer, build func(fee int64) (*btcwire.MsgTx, error), rate FeeRate, sigScriptSizes []int) (*btcwire.MsgTx, int64, error) {
+	if rate < 0 {
+		str := fmt.Sprintf("fee rate is negative: %d", rate)
+		return nil, 0, MakeError(ErrNegativeValue, str, nil)
+	}
+	fee := int64(0)
+	for {
+		tx, err := build(fee)
+		if err != nil {
+			return nil, 0, err
+		}
+		needed := rate.FeeForSize(SignedTxSize(tx, sigScriptSizes))
+		if needed <= fee {
+			paid, err := txFee(b, tx)
+			if err != nil {
+				return nil, 0, err
+			}
+			return tx, paid, nil
+		}
+		fee = needed
+	}
+}
+
+// txFee returns what the inputs of the tx have beyond its outputs.
+func txFee(b *BlockExplorer, tx *btcwire.MsgTx) (int64, error) {
+	fee := int64(0)
+	for _, txIn := range tx.TxIn {
+		value, err := b.OutPointValue(&txIn.PreviousOutPoint)
+		if err != nil {
+			return 0, err
+		}
+		fee, err = AddSatoshi(fee, value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, txOut := range tx.TxOut {
+		fee -= txOut.Value
+	}
+	return fee, nil
+}
+
+// IssuingTxAtRate returns the unsigned genesis tx of the kernel along with
+// its fee, which is that of the rate for the size of the tx once the
+// inputs are signed with scripts of the sizes given, as for SignedTxSize.
+func IssuingTxAtRate(b *BlockExplorer, kernel ColorKernel,
+	inputs []*btcwire.OutPoint, outputs []*ColorOut, changeScript []byte,
+	rate FeeRate, sigScriptSizes []int) (*btcwire.MsgTx, int64, error) {
+	return buildAtRate(b, func(fee int64) (*btcwire.MsgTx, error) {
+		return kernel.IssuingTx(b, inputs, outputs, changeScript, fee)
+	}, rate, sigScriptSizes)
+}
+
+// TransferringTxAtRate returns the unsigned transferring tx of the color
+// along with its fee, which is that of the rate for the size of the tx
+// once the inputs are signed with scripts of the sizes given, as for
+// SignedTxSize.
+func (c *ColorDefinition) TransferringTxAtRate(b *BlockExplorer,
+	inputs []*ColorIn, outputs []*ColorOut, changeScript []byte,
+	destroy bool, rate FeeRate, sigScriptSizes []int) (*btcwire.MsgTx, int64, error) {
+	return buildAtRate(b, func(fee int64) (*btcwire.MsgTx, error) {
+		return c.TransferringTx(b, inputs, outputs, changeScript, fee, destroy)
+	}, rate, sigScriptSizes)
+}
+
+// FeeEstimator is a BlockReaderWriter that can estimate fee rates.
+type FeeEstimator interface {
+	// Get the fee rate for a tx to be mined within the number of blocks.
+	EstimateFeeRate(blocks int) (FeeRate, error)
+}
+
+// EstimateFeeRate returns the fee rate for a tx to be mined within the
+// number of blocks, if the backend can estimate it. It's an
+// ErrNoFeeEstimate error if it can't, so the caller can use a rate of its
+// own.
+func (b *BlockExplorer) EstimateFeeRate(blocks int) (FeeRate, error) {
+	estimator, ok := b.BlockReaderWriter.(FeeEstimator)
+	if !ok {
+		return 0, MakeError(ErrNoFeeEstimate, "backend does not estimate fees", nil)
+	}
+	return estimator.EstimateFeeRate(blocks)
+}
@@ -0,0 +1,186 @@
+package gochroma_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestSignedTxSize(t *testing.T) {
+	// Setup
+	tx := btcwire.NewMsgTx()
+	tx.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(&btcwire.ShaHash{}, 0), nil))
+	tx.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(&btcwire.ShaHash{}, 1), nil))
+	tx.AddTxOut(btcwire.NewTxOut(1000, tstScript(0)))
+
+	tests := []struct {
+		desc  string
+		sizes []int
+		want  int
+	}{
+		{"p2pkh", nil, 10 + 2*149 + 34},
+		{"multisig", []int{gochroma.MultisigSigScriptSize(2, 3)},
+			10 + (32 + 4 + 3 + 256 + 4) + 149 + 34},
+		{"big multisig", []int{gochroma.MultisigSigScriptSize(1, 8), 0},
+			10 + (32 + 4 + 3 + 353 + 4) + (32 + 4 + 1 + 4) + 34},
+	}
+
+	for _, test := range tests {
+		// Execute
+		got := gochroma.SignedTxSize(tx, test.sizes)
+
+		// Verify
+		if got != test.want {
+			t.Errorf("%v: got size %d, want %d", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestFeeRate(t *testing.T) {
+	tests := []struct {
+		rate    gochroma.FeeRate
+		inputs  int
+		outputs int
+		want    int64
+	}{
+		{10000, 1, 2, 2270},
+		{1000, 1, 1, 193},
+		{1, 1, 1, 1},
+		{0, 3, 3, 0},
+	}
+
+	for _, test := range tests {
+		// Execute
+		got := test.rate.Fee(test.inputs, test.outputs)
+
+		// Verify
+		if got != test.want {
+			t.Errorf("%d with %d inputs and %d outputs: got %d, want %d",
+				test.rate, test.inputs, test.outputs, got, test.want)
+		}
+	}
+}
+
+func TestTxAtRate(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	funding := chain.Fund(100000, tstScript(0))
+	cd := tstIssue(t, chain, spobc, 1)
+	chain.Mine()
+	rate := gochroma.FeeRate(20000)
+	sizes := []int{gochroma.MultisigSigScriptSize(2, 3)}
+
+	issue := func() (*btcwire.MsgTx, int64, error) {
+		outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), 50}}
+		return gochroma.IssuingTxAtRate(b, epobc, []*btcwire.OutPoint{funding},
+			outputs, tstScript(0), rate, sizes)
+	}
+	transfer := func() (*btcwire.MsgTx, int64, error) {
+		// the funding has no color value
+		inputs := []*gochroma.ColorIn{
+			&gochroma.ColorIn{cd.Genesis, 1},
+			&gochroma.ColorIn{funding, 0},
+		}
+		outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 1}}
+		return cd.TransferringTxAtRate(b, inputs, outputs, tstScript(0), false,
+			rate, sizes)
+	}
+	tests := []struct {
+		desc  string
+		build func() (*btcwire.MsgTx, int64, error)
+		in    int64
+	}{
+		{"issuing", issue, 100000},
+		{"transferring", transfer, spobc.IssuingSatoshiNeeded(1) + 100000},
+	}
+
+	for _, test := range tests {
+		// Execute
+		tx, fee, err := test.build()
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: failed to build: %v", test.desc, err)
+			continue
+		}
+		want := rate.FeeForSize(gochroma.SignedTxSize(tx, sizes))
+		if fee != want {
+			t.Errorf("%v: got fee %d, want %d", test.desc, fee, want)
+		}
+		out := int64(0)
+		for _, txOut := range tx.TxOut {
+			out += txOut.Value
+		}
+		if test.in-out != fee {
+			t.Errorf("%v: tx pays %d, want %d", test.desc, test.in-out, fee)
+		}
+	}
+}
+
+func TestTxAtRateError(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	funding := chain.Fund(epobc.IssuingSatoshiNeeded(50)+1000, tstScript(0))
+	chain.Mine()
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), 50}}
+
+	tests := []struct {
+		desc string
+		rate gochroma.FeeRate
+		err  int
+	}{
+		{"negative", -1, gochroma.ErrNegativeValue},
+		{"too high", 100000, gochroma.ErrInsufficientFunds},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, _, err := gochroma.IssuingTxAtRate(b, epobc,
+			[]*btcwire.OutPoint{funding}, outputs, tstScript(0), test.rate, nil)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
+
+func TestEstimateFeeRateUnsupported(t *testing.T) {
+	// Setup
+	b := kerneltest.NewMemChain().NewBlockExplorer()
+
+	// Execute
+	_, err := b.EstimateFeeRate(6)
+
+	// Verify
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	want := gochroma.ErrorCode(gochroma.ErrNoFeeEstimate)
+	if rerr.ErrorCode != want {
+		t.Errorf("wrong error, want %v, got %v", want, rerr)
+	}
+}
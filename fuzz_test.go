@@ -0,0 +1,63 @@
+//go:build go1.18
+// +build go1.18
+
+package gochroma_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// The fuzz targets run the same checks as the property tests on inputs
+// the fuzzer comes up with. They need Go 1.18, so older Go leaves this
+// file out and only runs the property tests.
+
+// tstUint64s splits fuzz data into up to max 8-byte numbers
+func tstUint64s(data []byte, max int) []uint64 {
+	var nums []uint64
+	for len(data) >= 8 && len(nums) < max {
+		nums = append(nums, binary.LittleEndian.Uint64(data[:8]))
+		data = data[8:]
+	}
+	return nums
+}
+
+// tstBytes joins numbers into fuzz data
+func tstBytes(nums ...uint64) []byte {
+	data := make([]byte, 8*len(nums))
+	for i, n := range nums {
+		binary.LittleEndian.PutUint64(data[8*i:], n)
+	}
+	return data
+}
+
+func FuzzColorValueArithmetic(f *testing.F) {
+	f.Add(uint64(1), uint64(2))
+	f.Add(uint64(math.MaxUint64), uint64(1))
+	f.Add(uint64(math.MaxInt64), uint64(math.MaxInt64))
+	f.Add(uint64(0), uint64(math.MaxUint64))
+	f.Fuzz(func(t *testing.T, a, b uint64) {
+		tstCheckArithmetic(t, a, b)
+	})
+}
+
+func FuzzEPOBCCalculate(f *testing.F) {
+	f.Add(uint8(4), false, tstBytes(5), tstBytes(21))
+	f.Add(uint8(0), false, tstBytes(math.MaxUint64, 2), tstBytes(3, 1<<63))
+	f.Add(uint8(0), false, tstBytes(1<<62, 1<<62), tstBytes(1<<62, 1<<62, 1<<62))
+	f.Add(uint8(62), false, tstBytes(1), tstBytes(1<<63, math.MaxInt64))
+	f.Add(uint8(3), true, tstBytes(), tstBytes(1<<63, 9, math.MaxInt64))
+	f.Fuzz(func(t *testing.T, exponent uint8, genesis bool, inData, outData []byte) {
+		tstCheckEPOBCCalculate(t, exponent, genesis, tstUint64s(inData, 16), tstUint64s(outData, 16))
+	})
+}
+
+func FuzzSPOBCCalculate(f *testing.F) {
+	f.Add(tstBytes(1, 0), tstBytes(5430, 1))
+	f.Add(tstBytes(math.MaxUint64, 2), tstBytes(5430, 5430))
+	f.Add(tstBytes(1, 1), tstBytes(1<<63, 5430))
+	f.Fuzz(func(t *testing.T, inData, outData []byte) {
+		tstCheckSPOBCCalculate(t, tstUint64s(inData, 16), tstUint64s(outData, 16))
+	})
+}
@@ -0,0 +1,68 @@
+package gochroma
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// ColorValueAt returns the color value the outpoint had at the height
+// given, even if it was spent afterwards, and whether it was still
+// unspent at that height. The outpoint has to have been created by then.
+// Every block from the genesis height up to the height given may be
+// read, so this is much slower than ColorValue.
+func (c *ColorDefinition) ColorValueAt(b *BlockExplorer, outPoint *btcwire.OutPoint, height int64) (*ColorValue, bool, error) {
+	count, err := b.BlockCount()
+	if err != nil {
+		return nil, false, err
+	}
+	if height < c.Height || height > count {
+		str := fmt.Sprintf("height %d is not between %d and %d", height, c.Height, count)
+		return nil, false, MakeError(ErrBadHeight, str, nil)
+	}
+
+	// find the height of the block the outpoint was created in
+	txBlockHash, err := b.TxBlockHash(BigEndianBytes(&outPoint.Hash))
+	if err != nil {
+		return nil, false, err
+	}
+	created := int64(-1)
+	for h := c.Height; h <= height; h++ {
+		blockHash, err := b.BlockHash(h)
+		if err != nil {
+			return nil, false, err
+		}
+		if bytes.Equal(blockHash, txBlockHash) {
+			created = h
+			break
+		}
+	}
+	if created < 0 {
+		str := fmt.Sprintf("outpoint %v:%d did not exist at height %d",
+			outPoint.Hash, outPoint.Index, height)
+		return nil, false, MakeError(ErrBadHeight, str, nil)
+	}
+
+	provenance, err := c.Provenance(b, outPoint)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// look for a spend from the block it was created in onwards
+	unspent := true
+	for h := created; h <= height && unspent; h++ {
+		block, err := b.BlockAtHeight(h)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, tx := range block.MsgBlock().Transactions {
+			for _, txIn := range tx.TxIn {
+				if txIn.PreviousOutPoint == *outPoint {
+					unspent = false
+				}
+			}
+		}
+	}
+	return &provenance.ColorValue, unspent, nil
+}
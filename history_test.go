@@ -0,0 +1,145 @@
+package gochroma_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestColorValueAt(t *testing.T) {
+	// Setup
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, spobc, 1)
+	hop := tstTransfer(t, chain, cd, cd.Genesis, 1)
+	transferHeight, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+	chain.Mine()
+
+	tests := []struct {
+		desc     string
+		outPoint *btcwire.OutPoint
+		height   int64
+		cv       gochroma.ColorValue
+		unspent  bool
+	}{
+		{
+			desc:     "genesis at issuing",
+			outPoint: cd.Genesis,
+			height:   cd.Height,
+			cv:       1,
+			unspent:  true,
+		},
+		{
+			desc:     "genesis at transfer",
+			outPoint: cd.Genesis,
+			height:   transferHeight,
+			cv:       1,
+			unspent:  false,
+		},
+		{
+			desc:     "transfer at transfer",
+			outPoint: hop,
+			height:   transferHeight,
+			cv:       1,
+			unspent:  true,
+		},
+		{
+			desc:     "transfer later",
+			outPoint: hop,
+			height:   transferHeight + 1,
+			cv:       1,
+			unspent:  true,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		cv, unspent, err := cd.ColorValueAt(b, test.outPoint, test.height)
+		if err != nil {
+			t.Errorf("%v: failed to get color value: %v", test.desc, err)
+			continue
+		}
+
+		// Verify
+		if *cv != test.cv {
+			t.Errorf("%v: wrong color value: got %d, want %d", test.desc, *cv, test.cv)
+		}
+		if unspent != test.unspent {
+			t.Errorf("%v: wrong unspent: got %v, want %v", test.desc, unspent, test.unspent)
+		}
+	}
+}
+
+func TestColorValueAtError(t *testing.T) {
+	// Setup
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, spobc, 1)
+	hop := tstTransfer(t, chain, cd, cd.Genesis, 1)
+	count, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+
+	tests := []struct {
+		desc     string
+		outPoint *btcwire.OutPoint
+		height   int64
+		err      int
+	}{
+		{
+			desc:     "before genesis",
+			outPoint: cd.Genesis,
+			height:   cd.Height - 1,
+			err:      gochroma.ErrBadHeight,
+		},
+		{
+			desc:     "after latest block",
+			outPoint: cd.Genesis,
+			height:   count + 1,
+			err:      gochroma.ErrBadHeight,
+		},
+		{
+			desc:     "not created yet",
+			outPoint: hop,
+			height:   cd.Height,
+			err:      gochroma.ErrBadHeight,
+		},
+		{
+			desc:     "unknown tx",
+			outPoint: btcwire.NewOutPoint(&btcwire.ShaHash{1}, 0),
+			height:   count,
+			err:      gochroma.ErrBlockRead,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, _, err := cd.ColorValueAt(b, test.outPoint, test.height)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+// Package kerneltest has a battery of checks that every ColorKernel
+// should pass, run against an in-memory blockchain.
+package kerneltest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+// fee used by every issuing tx of the battery
+const issuingFee = int64(1000)
+
+// harness keeps what every check needs.
+type harness struct {
+	t          *testing.T
+	name       string
+	kernel     gochroma.ColorKernel
+	chain      *MemChain
+	b          *gochroma.BlockExplorer
+	issueValue gochroma.ColorValue
+	scripts    int
+}
+
+// Run runs the whole battery against the kernel using the chain given.
+// issueValue is the color value each check issues; kernels like SPOBC
+// which can only ever issue 1 should pass 1.
+func Run(t *testing.T, kernel gochroma.ColorKernel, chain *MemChain, issueValue gochroma.ColorValue) {
+	checks := []struct {
+		name  string
+		check func(*harness)
+	}{
+		{"issue transfer trace", checkIssueTransferTrace},
+		{"calculate affecting consistency", checkConsistency},
+		{"no value creation", checkNoValueCreation},
+		{"insufficient funds", checkInsufficientFunds},
+		{"destroy", checkDestroy},
+	}
+	for _, c := range checks {
+		c.check(&harness{
+			t:          t,
+			name:       kernel.Code() + " " + c.name,
+			kernel:     kernel,
+			chain:      chain,
+			b:          chain.NewBlockExplorer(),
+			issueValue: issueValue,
+		})
+	}
+}
+
+func (h *harness) errorf(format string, args ...interface{}) {
+	h.t.Errorf(h.name+": "+format, args...)
+}
+
+// script returns a new pay-to-pubkey-hash script each time it's called
+func (h *harness) script() []byte {
+	h.scripts++
+	script := []byte{0x76, 0xa9, 0x14}
+	hash := make([]byte, 20)
+	hash[0] = byte(h.scripts)
+	hash[1] = byte(h.scripts >> 8)
+	script = append(script, hash...)
+	return append(script, 0x88, 0xac)
+}
+
+// publish sends the tx to the chain and mines it
+func (h *harness) publish(tx *btcwire.MsgTx) (*btcwire.ShaHash, bool) {
+	shaHash, err := h.b.PublishTx(tx)
+	if err != nil {
+		h.errorf("failed to publish tx: %v", err)
+		return nil, false
+	}
+	h.chain.Mine()
+	return shaHash, true
+}
+
+// issue creates a new color with issueValue and returns its definition
+func (h *harness) issue() (*gochroma.ColorDefinition, bool) {
+	needed := h.kernel.IssuingSatoshiNeeded(h.issueValue) + issuingFee
+	funding := h.chain.Fund(needed+100000, h.script())
+	h.chain.Mine()
+	outputs := []*gochroma.ColorOut{
+		&gochroma.ColorOut{Script: h.script(), ColorValue: h.issueValue}}
+	tx, err := h.kernel.IssuingTx(h.b, []*btcwire.OutPoint{funding},
+		outputs, h.script(), issuingFee)
+	if err != nil {
+		h.errorf("failed to make issuing tx: %v", err)
+		return nil, false
+	}
+	shaHash, ok := h.publish(tx)
+	if !ok {
+		return nil, false
+	}
+	height, err := h.b.BlockCount()
+	if err != nil {
+		h.errorf("failed to get height: %v", err)
+		return nil, false
+	}
+	genesis := btcwire.NewOutPoint(shaHash, 0)
+	cd, err := gochroma.NewColorDefinition(h.kernel, genesis, height)
+	if err != nil {
+		h.errorf("failed to make color definition: %v", err)
+		return nil, false
+	}
+	return cd, true
+}
+
+// colorValue traces the outpoint back to the genesis
+func (h *harness) colorValue(cd *gochroma.ColorDefinition, outPoint *btcwire.OutPoint) (gochroma.ColorValue, bool) {
+	cv, err := cd.ColorValue(h.b, outPoint)
+	if err != nil {
+		h.errorf("failed to trace %v: %v", outPoint, err)
+		return 0, false
+	}
+	return *cv, true
+}
+
+// expectError checks that err is a ChromaError with the code given
+func (h *harness) expectError(err error, code int) {
+	if err == nil {
+		h.errorf("expected error %v, got nil", gochroma.ErrorCode(code))
+		return
+	}
+	rerr, ok := err.(gochroma.ChromaError)
+	if !ok {
+		h.errorf("expected error %v, got %v", gochroma.ErrorCode(code), err)
+		return
+	}
+	if rerr.ErrorCode != gochroma.ErrorCode(code) {
+		h.errorf("wrong error passed back: got %v, want %v",
+			rerr.ErrorCode, gochroma.ErrorCode(code))
+	}
+}
+
+// checkIssueTransferTrace issues a color, moves all of it to a new
+// output and makes sure tracing finds it at each step.
+func checkIssueTransferTrace(h *harness) {
+	cd, ok := h.issue()
+	if !ok {
+		return
+	}
+	cv, ok := h.colorValue(cd, cd.Genesis)
+	if !ok {
+		return
+	}
+	if cv != h.issueValue {
+		h.errorf("wrong color value at genesis: got %d, want %d", cv, h.issueValue)
+		return
+	}
+	colorIn := &gochroma.ColorIn{OutPoint: cd.Genesis, ColorValue: h.issueValue}
+	valid, err := h.kernel.ColorInsValid(h.b, cd.Genesis, []*gochroma.ColorIn{colorIn})
+	if err != nil {
+		h.errorf("failed to validate genesis: %v", err)
+		return
+	}
+	if !valid {
+		h.errorf("genesis with color value %d is not valid", h.issueValue)
+		return
+	}
+
+	outputs := []*gochroma.ColorOut{
+		&gochroma.ColorOut{Script: h.script(), ColorValue: h.issueValue}}
+	tx, err := h.kernel.TransferringTx(h.b, []*gochroma.ColorIn{colorIn},
+		outputs, h.script(), 0, false)
+	if err != nil {
+		h.errorf("failed to make transferring tx: %v", err)
+		return
+	}
+	shaHash, ok := h.publish(tx)
+	if !ok {
+		return
+	}
+	cv, ok = h.colorValue(cd, btcwire.NewOutPoint(shaHash, 0))
+	if !ok {
+		return
+	}
+	if cv != h.issueValue {
+		h.errorf("wrong color value after transfer: got %d, want %d", cv, h.issueValue)
+	}
+	cv, ok = h.colorValue(cd, cd.Genesis)
+	if !ok {
+		return
+	}
+	if cv != 0 {
+		h.errorf("spent genesis still has color value %d", cv)
+	}
+}
+
+// checkConsistency makes sure every output that CalculateOutColorValues
+// colors is traced by FindAffectingInputs to colored inputs, and that
+// outputs never have more color value than inputs.
+func checkConsistency(h *harness) {
+	cd, ok := h.issue()
+	if !ok {
+		return
+	}
+
+	// the genesis tx has the whole color value and nothing affecting it
+	genesisTx, err := h.b.OutPointTx(cd.Genesis)
+	if err != nil {
+		h.errorf("failed to get genesis tx: %v", err)
+		return
+	}
+	genesisValues, err := cd.RunKernel(genesisTx.MsgTx(), nil)
+	if err != nil {
+		h.errorf("failed to run kernel on genesis: %v", err)
+		return
+	}
+	if genesisValues[cd.Genesis.Index] != h.issueValue {
+		h.errorf("wrong genesis output color value: got %d, want %d",
+			genesisValues[cd.Genesis.Index], h.issueValue)
+	}
+	affecting, err := cd.AffectingInputs(h.b, genesisTx.MsgTx(),
+		[]int{int(cd.Genesis.Index)})
+	if err != nil {
+		h.errorf("failed to find inputs affecting genesis: %v", err)
+		return
+	}
+	if len(affecting) != 0 {
+		h.errorf("genesis has %d affecting inputs, want 0", len(affecting))
+	}
+
+	colorIn := &gochroma.ColorIn{OutPoint: cd.Genesis, ColorValue: h.issueValue}
+	outputs := []*gochroma.ColorOut{
+		&gochroma.ColorOut{Script: h.script(), ColorValue: h.issueValue}}
+	tx, err := h.kernel.TransferringTx(h.b, []*gochroma.ColorIn{colorIn},
+		outputs, h.script(), 0, false)
+	if err != nil {
+		h.errorf("failed to make transferring tx: %v", err)
+		return
+	}
+	inValues := make([]gochroma.ColorValue, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		cv, ok := h.colorValue(cd, &txIn.PreviousOutPoint)
+		if !ok {
+			return
+		}
+		inValues[i] = cv
+	}
+	inSum, err := gochroma.SumColorValues(inValues)
+	if err != nil {
+		h.errorf("input color values don't add up: %v", err)
+		return
+	}
+	outValues, err := cd.RunKernel(tx, inValues)
+	if err != nil {
+		h.errorf("failed to run kernel: %v", err)
+		return
+	}
+	if len(outValues) != len(tx.TxOut) {
+		h.errorf("wrong number of output color values: got %d, want %d",
+			len(outValues), len(tx.TxOut))
+		return
+	}
+	outSum, err := gochroma.SumColorValues(outValues)
+	if err != nil {
+		h.errorf("output color values don't add up: %v", err)
+		return
+	}
+	for i, outValue := range outValues {
+		if i < len(outputs) && outValue != outputs[i].ColorValue {
+			h.errorf("wrong color value at output %d: got %d, want %d",
+				i, outValue, outputs[i].ColorValue)
+		}
+	}
+	if outSum > inSum {
+		h.errorf("outputs have %d color value, inputs only %d", outSum, inSum)
+	}
+
+	// FindAffectingInputs needs the inputs to still be on the chain
+	_, ok = h.publish(tx)
+	if !ok {
+		return
+	}
+	for i, outValue := range outValues {
+		if outValue == 0 {
+			continue
+		}
+		affecting, err := cd.AffectingInputs(h.b, tx, []int{i})
+		if err != nil {
+			h.errorf("failed to find inputs affecting output %d: %v", i, err)
+			return
+		}
+		if len(affecting) == 0 {
+			h.errorf("output %d has color value %d but no affecting inputs",
+				i, outValue)
+		}
+		affectingSum := gochroma.ColorValue(0)
+		for _, outPoint := range affecting {
+			for j, txIn := range tx.TxIn {
+				if txIn.PreviousOutPoint == *outPoint {
+					affectingSum += inValues[j]
+				}
+			}
+		}
+		if affectingSum < outValue {
+			h.errorf("output %d has color value %d but affecting inputs only %d",
+				i, outValue, affectingSum)
+		}
+	}
+}
+
+// checkNoValueCreation makes sure a transfer can't send out more color
+// value than it takes in.
+func checkNoValueCreation(h *harness) {
+	cd, ok := h.issue()
+	if !ok {
+		return
+	}
+	colorIn := &gochroma.ColorIn{OutPoint: cd.Genesis, ColorValue: h.issueValue}
+	outputs := []*gochroma.ColorOut{
+		&gochroma.ColorOut{Script: h.script(), ColorValue: h.issueValue + 1}}
+	_, err := h.kernel.TransferringTx(h.b, []*gochroma.ColorIn{colorIn},
+		outputs, h.script(), 0, false)
+	h.expectError(err, gochroma.ErrInsufficientColorValue)
+}
+
+// checkInsufficientFunds makes sure issuing fails when the inputs can't
+// cover the fee.
+func checkInsufficientFunds(h *harness) {
+	funding := h.chain.Fund(h.kernel.IssuingSatoshiNeeded(h.issueValue), h.script())
+	h.chain.Mine()
+	outputs := []*gochroma.ColorOut{
+		&gochroma.ColorOut{Script: h.script(), ColorValue: h.issueValue}}
+	_, err := h.kernel.IssuingTx(h.b, []*btcwire.OutPoint{funding},
+		outputs, h.script(), issuingFee)
+	h.expectError(err, gochroma.ErrInsufficientFunds)
+}
+
+// checkDestroy makes sure a transfer that sends out less color value
+// than it takes in fails unless destroying is asked for, and that when
+// it is, the outputs get what they were sent and the rest is gone. Half
+// is destroyed, or all of it when there's no half, and without a fee
+// the change is well above dust.
+func checkDestroy(h *harness) {
+	cd, ok := h.issue()
+	if !ok {
+		return
+	}
+	colorIn := &gochroma.ColorIn{OutPoint: cd.Genesis, ColorValue: h.issueValue}
+	var outputs []*gochroma.ColorOut
+	if h.issueValue > 1 {
+		outputs = append(outputs, &gochroma.ColorOut{
+			Script: h.script(), ColorValue: h.issueValue / 2})
+	}
+	changeScript := h.script()
+	_, err := h.kernel.TransferringTx(h.b, []*gochroma.ColorIn{colorIn},
+		outputs, changeScript, 0, false)
+	h.expectError(err, gochroma.ErrDestroyColorValue)
+
+	tx, err := h.kernel.TransferringTx(h.b, []*gochroma.ColorIn{colorIn},
+		outputs, changeScript, 0, true)
+	if err != nil {
+		h.errorf("failed to make destroying tx: %v", err)
+		return
+	}
+	change := -1
+	for i, txOut := range tx.TxOut {
+		if bytes.Equal(txOut.PkScript, changeScript) {
+			change = i
+		}
+	}
+	if change == -1 || gochroma.DefaultDustPolicy.IsDust(tx.TxOut[change]) {
+		h.errorf("destroying tx has no change above dust")
+		return
+	}
+	cvs, err := cd.RunKernelOnChain(h.b, tx, []gochroma.ColorValue{h.issueValue})
+	if err != nil {
+		h.errorf("failed to run kernel on destroying tx: %v", err)
+		return
+	}
+	// kernels may add outputs, so go by the script
+	want := make([]gochroma.ColorValue, len(tx.TxOut))
+	for i, txOut := range tx.TxOut {
+		for _, output := range outputs {
+			if bytes.Equal(txOut.PkScript, output.Script) {
+				want[i] = output.ColorValue
+			}
+		}
+	}
+	for i, cv := range cvs {
+		if cv != want[i] {
+			h.errorf("wrong color value at output %d after destroying: got %d, want %d",
+				i, cv, want[i])
+		}
+	}
+
+	shaHash, ok := h.publish(tx)
+	if !ok {
+		return
+	}
+	for i := range tx.TxOut {
+		cv, ok := h.colorValue(cd, btcwire.NewOutPoint(shaHash, uint32(i)))
+		if !ok {
+			return
+		}
+		if cv != want[i] {
+			h.errorf("wrong color value at output %d traced after destroying: got %d, want %d",
+				i, cv, want[i])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package kerneltest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+// MemChain is a BlockReaderWriter that keeps the whole blockchain in
+// memory. Published transactions go to the mempool until Mine is called.
+type MemChain struct {
+	blocks  []*btcwire.MsgBlock
+	mempool []*btcwire.MsgTx
+	txs     map[btcwire.ShaHash]*btcwire.MsgTx
+	// height of the block each confirmed tx is in
+	txHeight map[btcwire.ShaHash]int64
+	// which outpoints are spent by confirmed and mempool txs
+	spent        map[btcwire.OutPoint]bool
+	mempoolSpent map[btcwire.OutPoint]bool
+	// used to make funding txs unique
+	counter uint32
+}
+
+// NewMemChain returns a MemChain that has just a genesis block.
+func NewMemChain() *MemChain {
+	m := &MemChain{
+		txs:          make(map[btcwire.ShaHash]*btcwire.MsgTx),
+		txHeight:     make(map[btcwire.ShaHash]int64),
+		spent:        make(map[btcwire.OutPoint]bool),
+		mempoolSpent: make(map[btcwire.OutPoint]bool),
+	}
+	m.Mine()
+	return m
+}
+
+// NewBlockExplorer returns a BlockExplorer that reads from and writes to
+// this chain.
+func (m *MemChain) NewBlockExplorer() *gochroma.BlockExplorer {
+	return &gochroma.BlockExplorer{BlockReaderWriter: m}
+}
+
+func (m *MemChain) nextCounter() []byte {
+	m.counter++
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, m.counter)
+	return buf
+}
+
+func (m *MemChain) addToMempool(tx *btcwire.MsgTx) (*btcwire.ShaHash, error) {
+	shaHash, err := tx.TxSha()
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	m.mempool = append(m.mempool, tx)
+	m.txs[shaHash] = tx
+	for _, txIn := range tx.TxIn {
+		m.mempoolSpent[txIn.PreviousOutPoint] = true
+	}
+	return &shaHash, nil
+}
+
+// Fund puts a transaction paying value satoshi to pkScript into the
+// mempool and returns the outpoint that can be spent. The transaction
+// spends a made-up outpoint, so it never needs funding itself.
+func (m *MemChain) Fund(value int64, pkScript []byte) *btcwire.OutPoint {
+	prevHash, _ := btcwire.NewShaHash(btcwire.DoubleSha256(m.nextCounter()))
+	msgTx := btcwire.NewMsgTx()
+	msgTx.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(prevHash, 0), nil))
+	msgTx.AddTxOut(btcwire.NewTxOut(value, pkScript))
+	shaHash, _ := m.addToMempool(msgTx)
+	return btcwire.NewOutPoint(shaHash, 0)
+}
+
+// Mine puts every transaction in the mempool into a new block.
+func (m *MemChain) Mine() {
+	height := int64(len(m.blocks))
+	coinbase := btcwire.NewMsgTx()
+	coinbase.AddTxIn(btcwire.NewTxIn(
+		btcwire.NewOutPoint(&btcwire.ShaHash{}, 0xffffffff), m.nextCounter()))
+	coinbase.AddTxOut(btcwire.NewTxOut(0, nil))
+
+	msgBlock := &btcwire.MsgBlock{}
+	if height > 0 {
+		prev, _ := m.blocks[height-1].Header.BlockSha()
+		msgBlock.Header.PrevBlock = prev
+	}
+	msgBlock.Transactions = append([]*btcwire.MsgTx{coinbase}, m.mempool...)
+	for _, tx := range msgBlock.Transactions {
+		shaHash, _ := tx.TxSha()
+		m.txs[shaHash] = tx
+		m.txHeight[shaHash] = height
+		for _, txIn := range tx.TxIn {
+			m.spent[txIn.PreviousOutPoint] = true
+		}
+	}
+	m.blocks = append(m.blocks, msgBlock)
+	m.mempool = nil
+}
+
+// BlockCount returns the height of the newest block.
+func (m *MemChain) BlockCount() (int64, error) {
+	return int64(len(m.blocks) - 1), nil
+}
+
+// BlockHash returns the big-endian hash of the block at the height given.
+func (m *MemChain) BlockHash(height int64) ([]byte, error) {
+	if height < 0 || height >= int64(len(m.blocks)) {
+		str := fmt.Sprintf("no block at height %d", height)
+		return nil, gochroma.MakeError(gochroma.ErrBlockRead, str, nil)
+	}
+	shaHash, _ := m.blocks[height].Header.BlockSha()
+	return gochroma.BigEndianBytes(&shaHash), nil
+}
+
+func (m *MemChain) findBlock(hash []byte) (*btcwire.MsgBlock, error) {
+	shaHash, err := gochroma.NewShaHash(hash)
+	if err != nil {
+		str := fmt.Sprintf("hash %x looks bad", hash)
+		return nil, gochroma.MakeError(gochroma.ErrInvalidHash, str, err)
+	}
+	for _, block := range m.blocks {
+		blockHash, _ := block.Header.BlockSha()
+		if blockHash.IsEqual(shaHash) {
+			return block, nil
+		}
+	}
+	str := fmt.Sprintf("no block %v", shaHash)
+	return nil, gochroma.MakeError(gochroma.ErrBlockRead, str, nil)
+}
+
+// RawBlock returns the serialized block with the big-endian hash given.
+func (m *MemChain) RawBlock(hash []byte) ([]byte, error) {
+	block, err := m.findBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	err = block.Serialize(&buffer)
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrBlockRead, "unable to serialize", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func (m *MemChain) findTx(hash []byte) (*btcwire.ShaHash, *btcwire.MsgTx, error) {
+	shaHash, err := gochroma.NewShaHash(hash)
+	if err != nil {
+		str := fmt.Sprintf("hash %x looks bad", hash)
+		return nil, nil, gochroma.MakeError(gochroma.ErrInvalidHash, str, err)
+	}
+	tx, ok := m.txs[*shaHash]
+	if !ok {
+		str := fmt.Sprintf("no tx %v", shaHash)
+		return nil, nil, gochroma.MakeError(gochroma.ErrBlockRead, str, nil)
+	}
+	return shaHash, tx, nil
+}
+
+// RawTx returns the serialized tx with the big-endian hash given.
+func (m *MemChain) RawTx(hash []byte) ([]byte, error) {
+	_, tx, err := m.findTx(hash)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	err = tx.Serialize(&buffer)
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrBlockRead, "unable to serialize", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// MempoolTxs returns the big-endian hashes of the mempool txs.
+func (m *MemChain) MempoolTxs() ([][]byte, error) {
+	ret := make([][]byte, len(m.mempool))
+	for i, tx := range m.mempool {
+		shaHash, _ := tx.TxSha()
+		ret[i] = gochroma.BigEndianBytes(&shaHash)
+	}
+	return ret, nil
+}
+
+// TxBlockHash returns the big-endian hash of the block containing the
+// tx. Txs still in the mempool aren't in any block.
+func (m *MemChain) TxBlockHash(txHash []byte) ([]byte, error) {
+	shaHash, _, err := m.findTx(txHash)
+	if err != nil {
+		return nil, err
+	}
+	height, ok := m.txHeight[*shaHash]
+	if !ok {
+		str := fmt.Sprintf("tx %v is not in a block", shaHash)
+		return nil, gochroma.MakeError(gochroma.ErrBlockRead, str, nil)
+	}
+	return m.BlockHash(height)
+}
+
+// TxOutSpent reports whether the outpoint is spent. Like btcd, outpoints
+// that don't exist are reported as spent.
+func (m *MemChain) TxOutSpent(txHash []byte, index uint32, mempool bool) (*bool, error) {
+	spent := true
+	shaHash, tx, err := m.findTx(txHash)
+	if err != nil {
+		return &spent, nil
+	}
+	outPoint := btcwire.NewOutPoint(shaHash, index)
+	_, confirmed := m.txHeight[*shaHash]
+	switch {
+	case int(index) >= len(tx.TxOut):
+	case m.spent[*outPoint]:
+	case mempool && m.mempoolSpent[*outPoint]:
+	case !mempool && !confirmed:
+	default:
+		spent = false
+	}
+	return &spent, nil
+}
+
+// PublishRawTx puts the tx in the mempool if every input exists, hasn't
+// been spent and the outputs don't spend more than the inputs have.
+func (m *MemChain) PublishRawTx(rawTx []byte) ([]byte, error) {
+	msgTx := btcwire.NewMsgTx()
+	err := msgTx.Deserialize(bytes.NewReader(rawTx))
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrInvalidTx, "unable to deserialize", err)
+	}
+	inSum := int64(0)
+	for _, txIn := range msgTx.TxIn {
+		prev := txIn.PreviousOutPoint
+		prevTx, ok := m.txs[prev.Hash]
+		if !ok || int(prev.Index) >= len(prevTx.TxOut) {
+			str := fmt.Sprintf("input %v:%d does not exist", prev.Hash, prev.Index)
+			return nil, gochroma.MakeError(gochroma.ErrBlockWrite, str, nil)
+		}
+		if m.spent[prev] || m.mempoolSpent[prev] {
+			str := fmt.Sprintf("input %v:%d is spent", prev.Hash, prev.Index)
+			return nil, gochroma.MakeError(gochroma.ErrBlockWrite, str, nil)
+		}
+		inSum += prevTx.TxOut[prev.Index].Value
+	}
+	outSum := int64(0)
+	for _, txOut := range msgTx.TxOut {
+		outSum += txOut.Value
+	}
+	if outSum > inSum {
+		str := fmt.Sprintf("outputs spend %d, inputs only have %d", outSum, inSum)
+		return nil, gochroma.MakeError(gochroma.ErrBlockWrite, str, nil)
+	}
+	shaHash, err := m.addToMempool(msgTx)
+	if err != nil {
+		return nil, err
+	}
+	return gochroma.BigEndianBytes(shaHash), nil
+}
@@ -0,0 +1,165 @@
+package kerneltest_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestMemChainFund(t *testing.T) {
+	// Setup
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	script := []byte{0x51}
+
+	// Execute
+	outPoint := chain.Fund(12345, script)
+	chain.Mine()
+
+	// Verify
+	count, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("wrong block count: got %d, want 1", count)
+	}
+	value, err := b.OutPointValue(outPoint)
+	if err != nil {
+		t.Fatalf("failed to get value: %v", err)
+	}
+	if value != 12345 {
+		t.Fatalf("wrong value: got %d, want 12345", value)
+	}
+	spent, err := b.OutPointSpent(outPoint)
+	if err != nil {
+		t.Fatalf("failed to get spent: %v", err)
+	}
+	if *spent {
+		t.Fatalf("funded outpoint is spent")
+	}
+	block, err := b.BlockAtHeight(1)
+	if err != nil {
+		t.Fatalf("failed to get block: %v", err)
+	}
+	txs := block.Transactions()
+	if len(txs) != 2 || !txs[1].Sha().IsEqual(&outPoint.Hash) {
+		t.Fatalf("funding tx is not in the block")
+	}
+	blockHash, err := b.TxBlockHash(gochroma.BigEndianBytes(&outPoint.Hash))
+	if err != nil {
+		t.Fatalf("failed to get tx block hash: %v", err)
+	}
+	wantHash, err := b.BlockHash(1)
+	if err != nil {
+		t.Fatalf("failed to get block hash: %v", err)
+	}
+	if !bytes.Equal(blockHash, wantHash) {
+		t.Fatalf("wrong block hash: got %x, want %x", blockHash, wantHash)
+	}
+}
+
+func TestMemChainPublish(t *testing.T) {
+	// Setup
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	outPoint := chain.Fund(10000, nil)
+	chain.Mine()
+	msgTx := btcwire.NewMsgTx()
+	msgTx.AddTxIn(btcwire.NewTxIn(outPoint, nil))
+	msgTx.AddTxOut(btcwire.NewTxOut(9000, nil))
+
+	// Execute
+	shaHash, err := b.PublishTx(msgTx)
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	// Verify
+	mempool, err := b.MempoolTxs()
+	if err != nil {
+		t.Fatalf("failed to get mempool: %v", err)
+	}
+	if len(mempool) != 1 || !bytes.Equal(mempool[0], gochroma.BigEndianBytes(shaHash)) {
+		t.Fatalf("published tx is not in the mempool")
+	}
+	spent, err := b.OutPointSpent(outPoint)
+	if err != nil {
+		t.Fatalf("failed to get spent: %v", err)
+	}
+	if !*spent {
+		t.Fatalf("outpoint spent in the mempool is unspent")
+	}
+	_, err = b.TxHeight(gochroma.BigEndianBytes(shaHash))
+	if err == nil {
+		t.Fatalf("mempool tx should not be in a block")
+	}
+	chain.Mine()
+	mempool, err = b.MempoolTxs()
+	if err != nil {
+		t.Fatalf("failed to get mempool: %v", err)
+	}
+	if len(mempool) != 0 {
+		t.Fatalf("mempool not empty after mining: %d", len(mempool))
+	}
+}
+
+func TestMemChainPublishError(t *testing.T) {
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	outPoint := chain.Fund(10000, nil)
+	chain.Mine()
+	spender := btcwire.NewMsgTx()
+	spender.AddTxIn(btcwire.NewTxIn(outPoint, nil))
+	spender.AddTxOut(btcwire.NewTxOut(1000, nil))
+	_, err := b.PublishTx(spender)
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	tests := []struct {
+		desc     string
+		outPoint *btcwire.OutPoint
+		value    int64
+	}{
+		{
+			desc:     "double spend",
+			outPoint: outPoint,
+			value:    1000,
+		},
+		{
+			desc:     "non-existent input",
+			outPoint: btcwire.NewOutPoint(&btcwire.ShaHash{}, 0),
+			value:    1000,
+		},
+		{
+			desc:     "too much output",
+			outPoint: chain.Fund(1000, nil),
+			value:    1001,
+		},
+	}
+
+	for _, test := range tests {
+		msgTx := btcwire.NewMsgTx()
+		msgTx.AddTxIn(btcwire.NewTxIn(test.outPoint, nil))
+		msgTx.AddTxOut(btcwire.NewTxOut(test.value, nil))
+
+		// Execute
+		_, err := b.PublishTx(msgTx)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(gochroma.ErrBlockWrite)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
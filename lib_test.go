@@ -3,8 +3,12 @@ package gochroma_test
 import (
 	"encoding/hex"
 	"fmt"
+	"math/rand"
+	"testing"
 
+	"github.com/btcsuite/btcwire"
 	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
 )
 
 // example hashes and blocks that tests can use
@@ -151,3 +155,78 @@ func (b *TstBlockReaderWriter) PublishRawTx(_ []byte) ([]byte, error) {
 	b.sendHash = b.sendHash[1:]
 	return ret, nil
 }
+
+// tstScript returns a made-up pay-to-pubkey-hash script for the number
+func tstScript(n byte) []byte {
+	script := []byte{0x76, 0xa9, 0x14}
+	script = append(script, make([]byte, 20)...)
+	script[3] = n
+	return append(script, 0x88, 0xac)
+}
+
+// tstPublish publishes the tx to the chain and mines it
+func tstPublish(t *testing.T, chain *kerneltest.MemChain, tx *btcwire.MsgTx) *btcwire.ShaHash {
+	shaHash, err := chain.NewBlockExplorer().PublishTx(tx)
+	if err != nil {
+		t.Fatalf("failed to publish tx: %v", err)
+	}
+	chain.Mine()
+	return shaHash
+}
+
+// tstIssue issues a new color of the kernel on the chain
+func tstIssue(t *testing.T, chain *kerneltest.MemChain, kernel gochroma.ColorKernel, cv gochroma.ColorValue) *gochroma.ColorDefinition {
+	b := chain.NewBlockExplorer()
+	funding := chain.Fund(kernel.IssuingSatoshiNeeded(cv)+100000, tstScript(0))
+	chain.Mine()
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), cv}}
+	tx, err := kernel.IssuingTx(b, []*btcwire.OutPoint{funding}, outputs, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make issuing tx: %v", err)
+	}
+	shaHash := tstPublish(t, chain, tx)
+	height, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(kernel, btcwire.NewOutPoint(shaHash, 0), height)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	return cd
+}
+
+// tstTransfer moves the color value at the outpoint to a new output and
+// returns the new outpoint
+func tstTransfer(t *testing.T, chain *kerneltest.MemChain, cd *gochroma.ColorDefinition, outPoint *btcwire.OutPoint, cv gochroma.ColorValue) *btcwire.OutPoint {
+	b := chain.NewBlockExplorer()
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{outPoint, cv}}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), cv}}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, false)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	return btcwire.NewOutPoint(tstPublish(t, chain, tx), 0)
+}
+
+// tstRand returns the source of the random cases of property tests, the
+// same every run
+func tstRand() *rand.Rand {
+	return rand.New(rand.NewSource(1))
+}
+
+// tstRandUint64 returns a random number of any size, so that small values
+// and overflows both come up
+func tstRandUint64(r *rand.Rand) uint64 {
+	n := uint64(r.Uint32())<<32 | uint64(r.Uint32())
+	return n >> uint(r.Intn(64))
+}
+
+// tstRandUint64s returns up to max random numbers
+func tstRandUint64s(r *rand.Rand, max int) []uint64 {
+	nums := make([]uint64, r.Intn(max+1))
+	for i := range nums {
+		nums[i] = tstRandUint64(r)
+	}
+	return nums
+}
@@ -0,0 +1,78 @@
+package gochroma
+
+import (
+	"github.com/btcsuite/btcwire"
+)
+
+// TxKind is the kind of colored transaction a kernel has tagged.
+type TxKind int
+
+const (
+	TxKindNone TxKind = iota
+	TxKindGenesis
+	TxKindTransfer
+)
+
+var txKindStrings = map[TxKind]string{
+	TxKindNone:     "none",
+	TxKindGenesis:  "genesis",
+	TxKindTransfer: "transfer",
+}
+
+func (k TxKind) String() string {
+	s, ok := txKindStrings[k]
+	if ok {
+		return s
+	}
+	return "unknown"
+}
+
+// TxMarker is what a kernel was able to decode from the nSequence of
+// the first input of a transaction.
+type TxMarker struct {
+	// Code of the kernel that tagged the transaction, empty if none did
+	Code string
+	Kind TxKind
+	// Number of satoshi every colored output is padded with
+	Padding int64
+	// Number of colored outputs a genesis issues to, 0 otherwise
+	Outputs int
+}
+
+// MarkerDetector is implemented by kernels which tag their transactions
+// through the nSequence of the first input.
+type MarkerDetector interface {
+	// Returns the marker if the bits of the nSequence belong to this
+	// kernel, nil otherwise
+	DetectMarker(sequence BitList) *TxMarker
+}
+
+// ClassifyTx classifies the transaction with the kernels in
+// DefaultKernelRegistry.
+func ClassifyTx(tx *btcwire.MsgTx) (*TxMarker, error) {
+	return DefaultKernelRegistry.ClassifyTx(tx)
+}
+
+// ClassifyTx asks every kernel in the registry that can detect markers
+// whether it tagged the transaction. A marker with TxKindNone is returned
+// when no kernel recognizes the transaction.
+func (r *KernelRegistry) ClassifyTx(tx *btcwire.MsgTx) (*TxMarker, error) {
+	if len(tx.TxIn) == 0 {
+		return nil, MakeError(ErrInvalidTx, "transaction has no inputs", nil)
+	}
+	sequence := NewBitList(tx.TxIn[0].Sequence, 32)
+
+	// kernels come back in a fixed order so the result doesn't depend
+	// on map iteration
+	for _, kernel := range r.Kernels() {
+		detector, ok := kernel.(MarkerDetector)
+		if !ok {
+			continue
+		}
+		marker := detector.DetectMarker(sequence)
+		if marker != nil {
+			return marker, nil
+		}
+	}
+	return &TxMarker{Kind: TxKindNone}, nil
+}
@@ -0,0 +1,164 @@
+package gochroma_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+func TestTxKindString(t *testing.T) {
+	tests := []struct {
+		kind gochroma.TxKind
+		want string
+	}{
+		{gochroma.TxKindNone, "none"},
+		{gochroma.TxKindGenesis, "genesis"},
+		{gochroma.TxKindTransfer, "transfer"},
+		{gochroma.TxKind(-1), "unknown"},
+	}
+	for _, test := range tests {
+		if test.kind.String() != test.want {
+			t.Errorf("wrong string: got %v, want %v", test.kind.String(), test.want)
+		}
+	}
+}
+
+func TestClassifyTx(t *testing.T) {
+	tests := []struct {
+		desc     string
+		sequence uint32
+		code     string
+		kind     gochroma.TxKind
+		padding  int64
+		outputs  int
+	}{
+		{
+			desc:     "spobc genesis",
+			sequence: gochroma.SPOBCSequenceMarker,
+			code:     "SPOBC",
+			kind:     gochroma.TxKindGenesis,
+			padding:  0,
+			outputs:  1,
+		},
+		{
+			desc:     "epobc genesis",
+			sequence: gochroma.EPOBCGenesisMarker.Combine(gochroma.NewBitList(13, 26)).Uint32(),
+			code:     "EPOBC",
+			kind:     gochroma.TxKindGenesis,
+			padding:  8192,
+			outputs:  1,
+		},
+		{
+			desc:     "epobc genesis to 3 outputs",
+			sequence: gochroma.EPOBCMultiGenesisMarker.Combine(gochroma.NewBitList(3|2<<6, 26)).Uint32(),
+			code:     "EPOBC",
+			kind:     gochroma.TxKindGenesis,
+			padding:  8,
+			outputs:  3,
+		},
+		{
+			desc:     "epobc genesis with more bits set",
+			sequence: gochroma.EPOBCGenesisMarker.Combine(gochroma.NewBitList(3|2<<6, 26)).Uint32(),
+			code:     "EPOBC",
+			kind:     gochroma.TxKindGenesis,
+			padding:  8,
+			outputs:  1,
+		},
+		{
+			desc:     "epobc transfer",
+			sequence: gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(0, 26)).Uint32(),
+			code:     "EPOBC",
+			kind:     gochroma.TxKindTransfer,
+			padding:  1,
+		},
+		{
+			desc:     "epobc padding too big",
+			sequence: gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(63, 26)).Uint32(),
+			code:     "",
+			kind:     gochroma.TxKindNone,
+			padding:  0,
+		},
+		{
+			desc:     "final sequence",
+			sequence: btcwire.MaxTxInSequenceNum,
+			code:     "",
+			kind:     gochroma.TxKindNone,
+			padding:  0,
+		},
+		{
+			desc:     "spobc marker bits then more",
+			sequence: 0x41,
+			code:     "",
+			kind:     gochroma.TxKindNone,
+			padding:  0,
+		},
+		{
+			desc:     "spobc marker bits in a high sequence",
+			sequence: 0xFFFFFFC1,
+			code:     "",
+			kind:     gochroma.TxKindNone,
+			padding:  0,
+		},
+		{
+			desc:     "zero sequence",
+			sequence: 0,
+			code:     "",
+			kind:     gochroma.TxKindNone,
+			padding:  0,
+		},
+	}
+
+	for _, test := range tests {
+		// Setup
+		msgTx := btcwire.NewMsgTx()
+		hashBytes := make([]byte, 32)
+		rand.Read(hashBytes)
+		shaHash, err := btcwire.NewShaHash(hashBytes)
+		if err != nil {
+			t.Errorf("%v: err on shahash creation: %v", test.desc, err)
+			continue
+		}
+		txIn := btcwire.NewTxIn(btcwire.NewOutPoint(shaHash, 0), nil)
+		txIn.Sequence = test.sequence
+		msgTx.AddTxIn(txIn)
+		msgTx.AddTxOut(btcwire.NewTxOut(10000, nil))
+
+		// Execute
+		marker, err := gochroma.ClassifyTx(msgTx)
+		if err != nil {
+			t.Errorf("%v: err on classifying: %v", test.desc, err)
+			continue
+		}
+
+		// Verify
+		if marker.Code != test.code {
+			t.Errorf("%v: wrong code: got %v, want %v", test.desc, marker.Code, test.code)
+		}
+		if marker.Kind != test.kind {
+			t.Errorf("%v: wrong kind: got %v, want %v", test.desc, marker.Kind, test.kind)
+		}
+		if marker.Padding != test.padding {
+			t.Errorf("%v: wrong padding: got %v, want %v", test.desc, marker.Padding, test.padding)
+		}
+		if marker.Outputs != test.outputs {
+			t.Errorf("%v: wrong outputs: got %v, want %v", test.desc, marker.Outputs, test.outputs)
+		}
+	}
+}
+
+func TestClassifyTxError(t *testing.T) {
+	// Execute
+	_, err := gochroma.ClassifyTx(btcwire.NewMsgTx())
+
+	// Verify
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	wantErr := gochroma.ErrorCode(gochroma.ErrInvalidTx)
+	if rerr.ErrorCode != wantErr {
+		t.Fatalf("got wrong error: got %v, want %v", rerr.ErrorCode, wantErr)
+	}
+}
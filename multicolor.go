@@ -0,0 +1,53 @@
+package gochroma
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// ColorGroup is what one color puts into and gets out of a transaction
+// that moves several colors.
+type ColorGroup struct {
+	Definition *ColorDefinition
+	Inputs     []*ColorIn
+	Outputs    []*ColorOut
+	// script getting the color value of the inputs beyond the outputs,
+	// nil if there's none
+	Change []byte
+}
+
+// MultiColorKernel is implemented by kernels whose rules allow moving
+// several colors in the same transaction.
+type MultiColorKernel interface {
+	// Returns the unsigned transaction that transfers the color values of
+	// every group, paid for by the funding inputs
+	MultiColorTx(b *BlockExplorer, groups []*ColorGroup, funding []*btcwire.OutPoint, changeScript []byte, fee int64) (*btcwire.MsgTx, error)
+}
+
+// MultiColorTx builds one transaction moving the color value of every
+// group. The groups have to share a kernel that implements
+// MultiColorKernel, and each group has to send out exactly the color
+// value it takes in.
+func MultiColorTx(b *BlockExplorer, groups []*ColorGroup,
+	funding []*btcwire.OutPoint, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
+
+	if len(groups) == 0 {
+		return nil, MakeError(ErrInvalidTx, "no color groups to send", nil)
+	}
+	code := groups[0].Definition.Code()
+	for i, group := range groups[1:] {
+		if group.Definition.Code() != code {
+			str := fmt.Sprintf("group %d is %v, group 0 is %v", i+1,
+				group.Definition.Code(), code)
+			return nil, MakeError(ErrUnknownKernel, str, nil)
+		}
+	}
+	kernel, ok := groups[0].Definition.ColorKernel.(MultiColorKernel)
+	if !ok {
+		str := fmt.Sprintf("%v can't move several colors in one tx", code)
+		return nil, MakeError(ErrUnimplemented, str, nil)
+	}
+	return kernel.MultiColorTx(b, groups, funding, changeScript, fee)
+}
@@ -0,0 +1,169 @@
+package gochroma_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestMultiColorTx(t *testing.T) {
+	// Setup
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	cdA := tstIssue(t, chain, epobc, 100)
+	cdB := tstIssue(t, chain, epobc, 50)
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+	groups := []*gochroma.ColorGroup{
+		&gochroma.ColorGroup{
+			Definition: cdA,
+			Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cdA.Genesis, 100}},
+			Outputs: []*gochroma.ColorOut{
+				&gochroma.ColorOut{tstScript(3), 60},
+				&gochroma.ColorOut{tstScript(4), 40},
+			},
+		},
+		&gochroma.ColorGroup{
+			Definition: cdB,
+			Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cdB.Genesis, 50}},
+			Outputs:    []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(5), 50}},
+		},
+	}
+
+	// Execute
+	tx, err := gochroma.MultiColorTx(b, groups, []*btcwire.OutPoint{funding},
+		tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make multi color tx: %v", err)
+	}
+	shaHash := tstPublish(t, chain, tx)
+
+	// Verify
+	if len(tx.TxIn) != 3 || len(tx.TxOut) != 4 {
+		t.Fatalf("wrong shape: got %d inputs %d outputs, want 3 and 4",
+			len(tx.TxIn), len(tx.TxOut))
+	}
+	tests := []struct {
+		cd      *gochroma.ColorDefinition
+		inputs  []gochroma.ColorValue
+		outputs []gochroma.ColorValue
+	}{
+		{cdA, []gochroma.ColorValue{100, 0, 0}, []gochroma.ColorValue{60, 40, 0, 0}},
+		{cdB, []gochroma.ColorValue{0, 50, 0}, []gochroma.ColorValue{0, 0, 50, 0}},
+	}
+	for _, test := range tests {
+		calculated, err := test.cd.RunKernelOnChain(b, tx, test.inputs)
+		if err != nil {
+			t.Fatalf("%v: failed to run kernel: %v", test.cd, err)
+		}
+		for i, want := range test.outputs {
+			if calculated[i] != want {
+				t.Errorf("%v: wrong calculated color value at %d: got %d, want %d",
+					test.cd, i, calculated[i], want)
+			}
+			cv, err := test.cd.ColorValue(b, btcwire.NewOutPoint(shaHash, uint32(i)))
+			if err != nil {
+				t.Fatalf("%v: failed to trace output %d: %v", test.cd, i, err)
+			}
+			if *cv != want {
+				t.Errorf("%v: wrong traced color value at %d: got %d, want %d",
+					test.cd, i, *cv, want)
+			}
+		}
+	}
+
+	// the second color keeps tracing after it moves on its own
+	outPoint := tstTransfer(t, chain, cdB, btcwire.NewOutPoint(shaHash, 2), 50)
+	cv, err := cdB.ColorValue(b, outPoint)
+	if err != nil {
+		t.Fatalf("failed to trace transfer: %v", err)
+	}
+	if *cv != 50 {
+		t.Errorf("wrong color value after transfer: got %d, want 50", *cv)
+	}
+}
+
+func TestMultiColorTxError(t *testing.T) {
+	chain := kerneltest.NewMemChain()
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	cdA := tstIssue(t, chain, epobc, 100)
+	cdB := tstIssue(t, chain, spobc, 1)
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+	group := func(cd *gochroma.ColorDefinition, in, out gochroma.ColorValue) *gochroma.ColorGroup {
+		return &gochroma.ColorGroup{
+			Definition: cd,
+			Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, in}},
+			Outputs:    []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(3), out}},
+		}
+	}
+
+	tests := []struct {
+		desc   string
+		groups []*gochroma.ColorGroup
+		fee    int64
+		err    int
+	}{
+		{
+			desc: "no groups",
+			err:  gochroma.ErrInvalidTx,
+		},
+		{
+			desc:   "mixed kernels",
+			groups: []*gochroma.ColorGroup{group(cdA, 100, 100), group(cdB, 1, 1)},
+			err:    gochroma.ErrUnknownKernel,
+		},
+		{
+			desc:   "position based kernel",
+			groups: []*gochroma.ColorGroup{group(cdB, 1, 1)},
+			err:    gochroma.ErrUnimplemented,
+		},
+		{
+			desc:   "create color value",
+			groups: []*gochroma.ColorGroup{group(cdA, 100, 101)},
+			err:    gochroma.ErrInsufficientColorValue,
+		},
+		{
+			desc:   "destroy color value",
+			groups: []*gochroma.ColorGroup{group(cdA, 100, 99)},
+			err:    gochroma.ErrDestroyColorValue,
+		},
+		{
+			desc:   "insufficient funds",
+			groups: []*gochroma.ColorGroup{group(cdA, 100, 100)},
+			fee:    1000000,
+			err:    gochroma.ErrInsufficientFunds,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := gochroma.MultiColorTx(chain.NewBlockExplorer(), test.groups,
+			[]*btcwire.OutPoint{funding}, tstScript(0), test.fee)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
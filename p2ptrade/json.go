@@ -0,0 +1,273 @@
+package p2ptrade
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+// Offers and trades go between the two sides as JSON, with color
+// definitions in their string form, outpoints as txhash:index and
+// scripts and transactions as hex.
+
+type jsonLeg struct {
+	Definition string          `json:"definition,omitempty"`
+	Asset      *gochroma.Asset `json:"asset,omitempty"`
+	Amount     int64           `json:"amount"`
+}
+
+type jsonColorIn struct {
+	OutPoint   string              `json:"outPoint"`
+	ColorValue gochroma.ColorValue `json:"colorValue"`
+}
+
+type jsonHalf struct {
+	ColorIns []jsonColorIn `json:"colorIns"`
+	Funding  []string      `json:"funding"`
+	Receive  string        `json:"receive"`
+	Change   string        `json:"change"`
+	// colored change, empty when there's none
+	ColorChange string `json:"colorChange,omitempty"`
+	Fee         int64  `json:"fee"`
+}
+
+type jsonOffer struct {
+	Give  jsonLeg  `json:"give"`
+	Want  jsonLeg  `json:"want"`
+	Maker jsonHalf `json:"maker"`
+}
+
+type jsonTrade struct {
+	Offer jsonOffer `json:"offer"`
+	Taker jsonHalf  `json:"taker"`
+	Tx    string    `json:"tx"`
+}
+
+func outPointString(outPoint *btcwire.OutPoint) string {
+	return fmt.Sprintf("%v:%d", outPoint.Hash, outPoint.Index)
+}
+
+func parseOutPoint(s string) (*btcwire.OutPoint, error) {
+	components := strings.Split(s, ":")
+	if len(components) != 2 {
+		str := fmt.Sprintf("outpoint should be txhash:index: %v", s)
+		return nil, gochroma.MakeError(gochroma.ErrBadTrade, str, nil)
+	}
+	shaHash, err := btcwire.NewShaHashFromStr(components[0])
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrInvalidHash, "hash is invalid", err)
+	}
+	index, err := strconv.ParseUint(components[1], 10, 32)
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrBadTrade, "index is invalid", err)
+	}
+	return btcwire.NewOutPoint(shaHash, uint32(index)), nil
+}
+
+func decodeHex(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrBadTrade, "hex is invalid", err)
+	}
+	return b, nil
+}
+
+func (l *Leg) toJSON() jsonLeg {
+	j := jsonLeg{Amount: l.Amount}
+	if !l.IsBitcoin() {
+		j.Definition = l.Definition.String()
+		j.Asset = l.Definition.Asset
+	}
+	return j
+}
+
+func (j *jsonLeg) leg(r *gochroma.KernelRegistry) (*Leg, error) {
+	l := &Leg{Amount: j.Amount}
+	if j.Definition == "" {
+		return l, nil
+	}
+	cd, err := r.NewColorDefinitionFromStr(j.Definition)
+	if err != nil {
+		return nil, err
+	}
+	cd.Asset = j.Asset
+	l.Definition = cd
+	return l, nil
+}
+
+func (h *Half) toJSON() jsonHalf {
+	j := jsonHalf{
+		ColorIns: make([]jsonColorIn, len(h.ColorIns)),
+		Funding:  make([]string, len(h.Funding)),
+		Receive:  hex.EncodeToString(h.Receive),
+		Change:   hex.EncodeToString(h.Change),
+		Fee:      h.Fee,
+	}
+	if h.ColorChange != nil {
+		j.ColorChange = hex.EncodeToString(h.ColorChange)
+	}
+	for i, colorIn := range h.ColorIns {
+		j.ColorIns[i] = jsonColorIn{
+			OutPoint:   outPointString(colorIn.OutPoint),
+			ColorValue: colorIn.ColorValue,
+		}
+	}
+	for i, outPoint := range h.Funding {
+		j.Funding[i] = outPointString(outPoint)
+	}
+	return j
+}
+
+func (j *jsonHalf) half() (*Half, error) {
+	h := &Half{
+		ColorIns: make([]*gochroma.ColorIn, len(j.ColorIns)),
+		Funding:  make([]*btcwire.OutPoint, len(j.Funding)),
+		Fee:      j.Fee,
+	}
+	for i, colorIn := range j.ColorIns {
+		outPoint, err := parseOutPoint(colorIn.OutPoint)
+		if err != nil {
+			return nil, err
+		}
+		h.ColorIns[i] = &gochroma.ColorIn{
+			OutPoint:   outPoint,
+			ColorValue: colorIn.ColorValue,
+		}
+	}
+	for i, s := range j.Funding {
+		outPoint, err := parseOutPoint(s)
+		if err != nil {
+			return nil, err
+		}
+		h.Funding[i] = outPoint
+	}
+	var err error
+	h.Receive, err = decodeHex(j.Receive)
+	if err != nil {
+		return nil, err
+	}
+	h.Change, err = decodeHex(j.Change)
+	if err != nil {
+		return nil, err
+	}
+	if j.ColorChange != "" {
+		h.ColorChange, err = decodeHex(j.ColorChange)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (o *Offer) toJSON() jsonOffer {
+	return jsonOffer{
+		Give:  o.Give.toJSON(),
+		Want:  o.Want.toJSON(),
+		Maker: o.Maker.toJSON(),
+	}
+}
+
+func (j *jsonOffer) offer(r *gochroma.KernelRegistry) (*Offer, error) {
+	give, err := j.Give.leg(r)
+	if err != nil {
+		return nil, err
+	}
+	want, err := j.Want.leg(r)
+	if err != nil {
+		return nil, err
+	}
+	maker, err := j.Maker.half()
+	if err != nil {
+		return nil, err
+	}
+	return NewOffer(*give, *want, maker)
+}
+
+// MarshalJSON encodes the offer to send to takers.
+func (o *Offer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.toJSON())
+}
+
+// UnmarshalJSON decodes an offer, looking up the kernels of the color
+// definitions in gochroma.DefaultKernelRegistry.
+func (o *Offer) UnmarshalJSON(data []byte) error {
+	offer, err := UnmarshalOffer(gochroma.DefaultKernelRegistry, data)
+	if err != nil {
+		return err
+	}
+	*o = *offer
+	return nil
+}
+
+// UnmarshalOffer decodes an offer, looking up the kernels of the color
+// definitions in the registry given.
+func UnmarshalOffer(r *gochroma.KernelRegistry, data []byte) (*Offer, error) {
+	var j jsonOffer
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrBadTrade, "offer is unparseable", err)
+	}
+	return j.offer(r)
+}
+
+// MarshalJSON encodes the trade with the partially signed tx to send to
+// the other side.
+func (t *Trade) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := t.Tx.Serialize(&buf)
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrInvalidTx, "failed to serialize tx", err)
+	}
+	return json.Marshal(jsonTrade{
+		Offer: t.Offer.toJSON(),
+		Taker: t.Taker.toJSON(),
+		Tx:    hex.EncodeToString(buf.Bytes()),
+	})
+}
+
+// UnmarshalJSON decodes a trade, looking up the kernels of the color
+// definitions in gochroma.DefaultKernelRegistry. Nothing is checked
+// beyond the encoding; use Validate for that.
+func (t *Trade) UnmarshalJSON(data []byte) error {
+	trade, err := UnmarshalTrade(gochroma.DefaultKernelRegistry, data)
+	if err != nil {
+		return err
+	}
+	*t = *trade
+	return nil
+}
+
+// UnmarshalTrade decodes a trade, looking up the kernels of the color
+// definitions in the registry given. Nothing is checked beyond the
+// encoding; use Validate for that.
+func UnmarshalTrade(r *gochroma.KernelRegistry, data []byte) (*Trade, error) {
+	var j jsonTrade
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrBadTrade, "trade is unparseable", err)
+	}
+	offer, err := j.Offer.offer(r)
+	if err != nil {
+		return nil, err
+	}
+	taker, err := j.Taker.half()
+	if err != nil {
+		return nil, err
+	}
+	rawTx, err := decodeHex(j.Tx)
+	if err != nil {
+		return nil, err
+	}
+	tx := btcwire.NewMsgTx()
+	err = tx.Deserialize(bytes.NewReader(rawTx))
+	if err != nil {
+		return nil, gochroma.MakeError(gochroma.ErrInvalidTx, "failed to deserialize tx", err)
+	}
+	return &Trade{Offer: offer, Taker: taker, Tx: tx}, nil
+}
@@ -0,0 +1,394 @@
+// Package p2ptrade lets two parties swap colored coins for other colored
+// coins or for bitcoin in a single transaction, without trusting each
+// other or anyone else.
+//
+// The maker puts out an Offer with its half of the trade. The taker
+// accepts it with its own half, which gives a Trade whose transaction
+// has the inputs and outputs of both halves laid out by the ordering
+// rules of the kernel. Each side checks the trade against the offer and
+// signs only its own inputs, and only when the color flows match.
+package p2ptrade
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+// Leg is what one side of a trade gives.
+type Leg struct {
+	// color of the leg, nil when the leg is bitcoin
+	Definition *gochroma.ColorDefinition
+	// color value of the color, or satoshi when the leg is bitcoin
+	Amount int64
+}
+
+// IsBitcoin returns whether the leg is uncolored bitcoin.
+func (l *Leg) IsBitcoin() bool {
+	return l.Definition == nil
+}
+
+// Half is what one side puts into the trade transaction.
+type Half struct {
+	// colored outpoints giving the leg, empty when giving bitcoin
+	ColorIns []*gochroma.ColorIn
+	// uncolored outpoints paying for the padding, the fee and any
+	// bitcoin given
+	Funding []*btcwire.OutPoint
+	// script that gets what this side wants
+	Receive []byte
+	// script that gets back what's left of the funding, which can only be
+	// left out when nothing is
+	Change []byte
+	// script that gets back the color value of the color inputs beyond
+	// the leg, nil when they add up to the leg exactly
+	ColorChange []byte
+	// fee this side pays
+	Fee int64
+}
+
+// owns returns whether the outpoint is spent by this half.
+func (h *Half) owns(outPoint *btcwire.OutPoint) bool {
+	for _, colorIn := range h.ColorIns {
+		if *colorIn.OutPoint == *outPoint {
+			return true
+		}
+	}
+	for _, funding := range h.Funding {
+		if *funding == *outPoint {
+			return true
+		}
+	}
+	return false
+}
+
+// satoshi adds up the satoshi value of every outpoint of the half.
+func (h *Half) satoshi(b *gochroma.BlockExplorer) (int64, error) {
+	sum := int64(0)
+	outPoints := append(gochroma.OutPoints(h.ColorIns), h.Funding...)
+	for _, outPoint := range outPoints {
+		value, err := b.OutPointValue(outPoint)
+		if err != nil {
+			return 0, err
+		}
+		sum, err = gochroma.AddSatoshi(sum, value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// Offer is the maker giving one leg in exchange for the other.
+type Offer struct {
+	Give  Leg
+	Want  Leg
+	Maker *Half
+}
+
+// NewOffer makes an offer giving one leg for the other, paid for by the
+// half of the maker.
+func NewOffer(give, want Leg, maker *Half) (*Offer, error) {
+	if give.IsBitcoin() && want.IsBitcoin() {
+		return nil, gochroma.MakeError(gochroma.ErrBadTrade,
+			"at least one leg has to be colored", nil)
+	}
+	if give.Amount <= 0 || want.Amount <= 0 {
+		str := fmt.Sprintf("amounts have to be positive: give %d, want %d",
+			give.Amount, want.Amount)
+		return nil, gochroma.MakeError(gochroma.ErrNegativeValue, str, nil)
+	}
+	return &Offer{Give: give, Want: want, Maker: maker}, nil
+}
+
+// Trade is an offer with the half of the taker and the transaction
+// putting both halves together. Tx collects the signatures of both sides.
+type Trade struct {
+	Offer *Offer
+	Taker *Half
+	Tx    *btcwire.MsgTx
+}
+
+// SignFunc signs the input at the index of the tx in place.
+type SignFunc func(tx *btcwire.MsgTx, index int) error
+
+// Accept puts the half of the taker together with the offer into the
+// unsigned trade transaction.
+func (o *Offer) Accept(b *gochroma.BlockExplorer, taker *Half) (*Trade, error) {
+	t := &Trade{Offer: o, Taker: taker}
+	tx, err := t.build(b)
+	if err != nil {
+		return nil, err
+	}
+	t.Tx = tx
+	return t, nil
+}
+
+// group returns the color group of the leg given by the half to the other
+// side, nil when the leg is bitcoin. Color value of the giver beyond the
+// leg goes back to its colored change.
+func group(leg *Leg, giver, receiver *Half) *gochroma.ColorGroup {
+	if leg.IsBitcoin() {
+		return nil
+	}
+	return &gochroma.ColorGroup{
+		Definition: leg.Definition,
+		Inputs:     giver.ColorIns,
+		Outputs: []*gochroma.ColorOut{&gochroma.ColorOut{
+			Script:     receiver.Receive,
+			ColorValue: gochroma.ColorValue(leg.Amount),
+		}},
+		Change: giver.ColorChange,
+	}
+}
+
+// groupOutputs returns how many outputs the kernel makes for the group,
+// which is one more than asked for when there's colored change.
+func groupOutputs(g *gochroma.ColorGroup) (int, error) {
+	inSum, outSum := gochroma.ColorValue(0), gochroma.ColorValue(0)
+	for _, in := range g.Inputs {
+		var err error
+		inSum, err = inSum.Add(in.ColorValue)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, out := range g.Outputs {
+		var err error
+		outSum, err = outSum.Add(out.ColorValue)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if g.Change != nil && inSum > outSum {
+		return len(g.Outputs) + 1, nil
+	}
+	return len(g.Outputs), nil
+}
+
+// build lays out the trade transaction. The colored groups come first in
+// the order of the kernel, then the bitcoin leg, then the change of the
+// maker and of the taker.
+func (t *Trade) build(b *gochroma.BlockExplorer) (*btcwire.MsgTx, error) {
+	o := t.Offer
+	// an empty script would let anyone take what goes to it
+	if len(o.Maker.Receive) == 0 || len(t.Taker.Receive) == 0 {
+		return nil, gochroma.MakeError(gochroma.ErrBadTrade,
+			"both sides need a script to receive to", nil)
+	}
+	var groups []*gochroma.ColorGroup
+	// the satoshi of each group's outputs come out of the giver's half
+	var givers []*int64
+	makerOut, takerOut := o.Maker.Fee, t.Taker.Fee
+	if g := group(&o.Give, o.Maker, t.Taker); g != nil {
+		groups = append(groups, g)
+		givers = append(givers, &makerOut)
+	}
+	if g := group(&o.Want, t.Taker, o.Maker); g != nil {
+		groups = append(groups, g)
+		givers = append(givers, &takerOut)
+	}
+	funding := append(append([]*btcwire.OutPoint{}, o.Maker.Funding...),
+		t.Taker.Funding...)
+
+	// the kernel puts whatever is left in one output, which gets split
+	// between the two sides below
+	tx, err := gochroma.MultiColorTx(b, groups, funding, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	colored := 0
+	for i, g := range groups {
+		n, err := groupOutputs(g)
+		if err != nil {
+			return nil, err
+		}
+		for _, txOut := range tx.TxOut[colored : colored+n] {
+			*givers[i], err = gochroma.AddSatoshi(*givers[i], txOut.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		colored += n
+	}
+	tx.TxOut = tx.TxOut[:colored]
+
+	if o.Give.IsBitcoin() {
+		tx.AddTxOut(btcwire.NewTxOut(o.Give.Amount, t.Taker.Receive))
+		makerOut, err = gochroma.AddSatoshi(makerOut, o.Give.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.Want.IsBitcoin() {
+		tx.AddTxOut(btcwire.NewTxOut(o.Want.Amount, o.Maker.Receive))
+		takerOut, err = gochroma.AddSatoshi(takerOut, o.Want.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, side := range []struct {
+		half *Half
+		out  int64
+		name string
+	}{
+		{o.Maker, makerOut, "maker"},
+		{t.Taker, takerOut, "taker"},
+	} {
+		in, err := side.half.satoshi(b)
+		if err != nil {
+			return nil, err
+		}
+		if in < side.out {
+			str := fmt.Sprintf("%v has %d satoshi, needs %d", side.name, in, side.out)
+			return nil, gochroma.MakeError(gochroma.ErrInsufficientFunds, str, nil)
+		}
+		if in > side.out {
+			if len(side.half.Change) == 0 {
+				str := fmt.Sprintf("%v has %d satoshi of change and no script for it",
+					side.name, in-side.out)
+				return nil, gochroma.MakeError(gochroma.ErrBadTrade, str, nil)
+			}
+			tx.AddTxOut(btcwire.NewTxOut(in-side.out, side.half.Change))
+		}
+	}
+	return tx, nil
+}
+
+// sameTx returns whether the txs spend and pay the same, ignoring the
+// signatures.
+func sameTx(a, b *btcwire.MsgTx) bool {
+	if len(a.TxIn) != len(b.TxIn) || len(a.TxOut) != len(b.TxOut) {
+		return false
+	}
+	for i, txIn := range a.TxIn {
+		if txIn.PreviousOutPoint != b.TxIn[i].PreviousOutPoint ||
+			txIn.Sequence != b.TxIn[i].Sequence {
+			return false
+		}
+	}
+	for i, txOut := range a.TxOut {
+		if txOut.Value != b.TxOut[i].Value ||
+			!bytes.Equal(txOut.PkScript, b.TxOut[i].PkScript) {
+			return false
+		}
+	}
+	return a.Version == b.Version && a.LockTime == b.LockTime
+}
+
+// Validate checks that the trade tx is the one the offer and both halves
+// make, that the color inputs of both halves are what they claim, and
+// that the kernel sends each leg to the side that wants it.
+func (t *Trade) Validate(b *gochroma.BlockExplorer) error {
+	want, err := t.build(b)
+	if err != nil {
+		return err
+	}
+	if !sameTx(want, t.Tx) {
+		return gochroma.MakeError(gochroma.ErrBadTrade,
+			"tx doesn't match the offer and halves", nil)
+	}
+	o := t.Offer
+	err = t.checkLeg(b, &o.Give, o.Maker, t.Taker)
+	if err != nil {
+		return err
+	}
+	return t.checkLeg(b, &o.Want, t.Taker, o.Maker)
+}
+
+// checkLeg checks that the leg goes from the giver to the receiver.
+func (t *Trade) checkLeg(b *gochroma.BlockExplorer, leg *Leg, giver, receiver *Half) error {
+	if leg.IsBitcoin() {
+		for _, txOut := range t.Tx.TxOut {
+			if txOut.Value >= leg.Amount && bytes.Equal(txOut.PkScript, receiver.Receive) {
+				return nil
+			}
+		}
+		str := fmt.Sprintf("no output pays %d satoshi", leg.Amount)
+		return gochroma.MakeError(gochroma.ErrBadTrade, str, nil)
+	}
+
+	cd := leg.Definition
+	valid, err := cd.ColorInsValid(b, cd.Genesis, giver.ColorIns)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		str := fmt.Sprintf("color inputs don't have the color value of %v", cd)
+		return gochroma.MakeError(gochroma.ErrBadTrade, str, nil)
+	}
+
+	inputs := make([]gochroma.ColorValue, len(t.Tx.TxIn))
+	for i, txIn := range t.Tx.TxIn {
+		for _, colorIn := range giver.ColorIns {
+			if *colorIn.OutPoint == txIn.PreviousOutPoint {
+				inputs[i] = colorIn.ColorValue
+			}
+		}
+	}
+	outputs, err := cd.RunKernelOnChain(b, t.Tx, inputs)
+	if err != nil {
+		return err
+	}
+	// whatever doesn't go to the receiver has to go back to the giver
+	received, returned, total := gochroma.ColorValue(0), gochroma.ColorValue(0), gochroma.ColorValue(0)
+	for i, cv := range outputs {
+		total, err = total.Add(cv)
+		if err != nil {
+			return err
+		}
+		switch {
+		case bytes.Equal(t.Tx.TxOut[i].PkScript, receiver.Receive):
+			received, err = received.Add(cv)
+		case giver.ColorChange != nil && bytes.Equal(t.Tx.TxOut[i].PkScript, giver.ColorChange):
+			returned, err = returned.Add(cv)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if received != gochroma.ColorValue(leg.Amount) || total != received+returned {
+		str := fmt.Sprintf("%d of %d color value of %v goes to the receiver, want %d",
+			received, total, cd, leg.Amount)
+		return gochroma.MakeError(gochroma.ErrBadTrade, str, nil)
+	}
+	return nil
+}
+
+// SignMaker validates the trade against the offer the maker put out and
+// signs the inputs of the maker. The offer in the trade comes back from
+// the taker, so a trade whose offer isn't the maker's is refused.
+func (t *Trade) SignMaker(b *gochroma.BlockExplorer, offer *Offer, sign SignFunc) error {
+	if !reflect.DeepEqual(t.Offer.toJSON(), offer.toJSON()) {
+		return gochroma.MakeError(gochroma.ErrBadTrade,
+			"trade is not for the offer made", nil)
+	}
+	original := &Trade{Offer: offer, Taker: t.Taker, Tx: t.Tx}
+	return original.sign(b, offer.Maker, sign)
+}
+
+// SignTaker validates the trade and signs the inputs of the taker.
+func (t *Trade) SignTaker(b *gochroma.BlockExplorer, sign SignFunc) error {
+	return t.sign(b, t.Taker, sign)
+}
+
+func (t *Trade) sign(b *gochroma.BlockExplorer, half *Half, sign SignFunc) error {
+	err := t.Validate(b)
+	if err != nil {
+		return err
+	}
+	for i, txIn := range t.Tx.TxIn {
+		if !half.owns(&txIn.PreviousOutPoint) {
+			continue
+		}
+		err = sign(t.Tx, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
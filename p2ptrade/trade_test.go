@@ -0,0 +1,553 @@
+package p2ptrade_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+	"github.com/jimmysong/gochroma/p2ptrade"
+)
+
+// tstScript makes a pay-to-pubkey-hash-like script unique to n
+func tstScript(n byte) []byte {
+	script := []byte{0x76, 0xa9, 0x14}
+	script = append(script, make([]byte, 20)...)
+	script[3] = n
+	return append(script, 0x88, 0xac)
+}
+
+// tstIssue issues a new EPOBC color on the chain
+func tstIssue(t *testing.T, chain *kerneltest.MemChain, cv gochroma.ColorValue) *gochroma.ColorDefinition {
+	kernel, err := gochroma.GetColorKernel("EPOBC")
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	b := chain.NewBlockExplorer()
+	funding := chain.Fund(kernel.IssuingSatoshiNeeded(cv)+1000, tstScript(0))
+	chain.Mine()
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{Script: tstScript(1), ColorValue: cv}}
+	tx, err := kernel.IssuingTx(b, []*btcwire.OutPoint{funding}, outputs, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make issuing tx: %v", err)
+	}
+	shaHash, err := b.PublishTx(tx)
+	if err != nil {
+		t.Fatalf("failed to publish tx: %v", err)
+	}
+	chain.Mine()
+	height, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(kernel, btcwire.NewOutPoint(shaHash, 0), height)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	return cd
+}
+
+// tstSign marks the input as signed and counts the calls
+func tstSign(count *int) p2ptrade.SignFunc {
+	return func(tx *btcwire.MsgTx, index int) error {
+		*count++
+		tx.TxIn[index].SignatureScript = []byte{0x51}
+		return nil
+	}
+}
+
+// tstRoundTrip sends the trade through JSON like going to the other side
+func tstRoundTrip(t *testing.T, trade *p2ptrade.Trade) *p2ptrade.Trade {
+	data, err := json.Marshal(trade)
+	if err != nil {
+		t.Fatalf("failed to encode trade: %v", err)
+	}
+	got := new(p2ptrade.Trade)
+	err = json.Unmarshal(data, got)
+	if err != nil {
+		t.Fatalf("failed to decode trade: %v", err)
+	}
+	return got
+}
+
+func TestTrade(t *testing.T) {
+	chain := kerneltest.NewMemChain()
+	cdA := tstIssue(t, chain, 100)
+	cdB := tstIssue(t, chain, 50)
+	cdC := tstIssue(t, chain, 100)
+	cdD := tstIssue(t, chain, 100)
+	cdA.Asset = &gochroma.Asset{Name: "Gold", Ticker: "GLD", Decimals: 2}
+
+	tests := []struct {
+		desc      string
+		give      p2ptrade.Leg
+		want      p2ptrade.Leg
+		makerIns  []*gochroma.ColorIn
+		takerIns  []*gochroma.ColorIn
+		makerGets int64
+		takerGets int64
+		// color value the maker's colored change gets back
+		makerKeeps gochroma.ColorValue
+	}{
+		{
+			desc:      "color for color",
+			give:      p2ptrade.Leg{Definition: cdA, Amount: 100},
+			want:      p2ptrade.Leg{Definition: cdB, Amount: 50},
+			makerIns:  []*gochroma.ColorIn{&gochroma.ColorIn{OutPoint: cdA.Genesis, ColorValue: 100}},
+			takerIns:  []*gochroma.ColorIn{&gochroma.ColorIn{OutPoint: cdB.Genesis, ColorValue: 50}},
+			makerGets: 50,
+			takerGets: 100,
+		},
+		{
+			desc:      "bitcoin for color",
+			give:      p2ptrade.Leg{Amount: 30000},
+			want:      p2ptrade.Leg{Definition: cdC, Amount: 100},
+			takerIns:  []*gochroma.ColorIn{&gochroma.ColorIn{OutPoint: cdC.Genesis, ColorValue: 100}},
+			makerGets: 100,
+			takerGets: 30000,
+		},
+		{
+			desc:       "part of the color for bitcoin",
+			give:       p2ptrade.Leg{Definition: cdD, Amount: 60},
+			want:       p2ptrade.Leg{Amount: 10000},
+			makerIns:   []*gochroma.ColorIn{&gochroma.ColorIn{OutPoint: cdD.Genesis, ColorValue: 100}},
+			makerGets:  10000,
+			takerGets:  60,
+			makerKeeps: 40,
+		},
+	}
+
+	for i, test := range tests {
+		// Setup
+		b := chain.NewBlockExplorer()
+		makerFunding := chain.Fund(50000, tstScript(0))
+		takerFunding := chain.Fund(20000, tstScript(0))
+		chain.Mine()
+		makerReceive, takerReceive := tstScript(byte(10+2*i)), tstScript(byte(11+2*i))
+		made, err := p2ptrade.NewOffer(test.give, test.want, &p2ptrade.Half{
+			ColorIns:    test.makerIns,
+			Funding:     []*btcwire.OutPoint{makerFunding},
+			Receive:     makerReceive,
+			Change:      tstScript(2),
+			ColorChange: tstScript(4),
+			Fee:         500,
+		})
+		if err != nil {
+			t.Fatalf("%v: failed to make offer: %v", test.desc, err)
+		}
+		data, err := json.Marshal(made)
+		if err != nil {
+			t.Fatalf("%v: failed to encode offer: %v", test.desc, err)
+		}
+		offer := new(p2ptrade.Offer)
+		err = json.Unmarshal(data, offer)
+		if err != nil {
+			t.Fatalf("%v: failed to decode offer: %v", test.desc, err)
+		}
+		if !offer.Give.IsBitcoin() && test.give.Definition.Asset != nil &&
+			*offer.Give.Definition.Asset != *test.give.Definition.Asset {
+			t.Errorf("%v: asset not carried through: got %v, want %v", test.desc,
+				offer.Give.Definition.Asset, test.give.Definition.Asset)
+		}
+
+		// Execute
+		trade, err := offer.Accept(b, &p2ptrade.Half{
+			ColorIns: test.takerIns,
+			Funding:  []*btcwire.OutPoint{takerFunding},
+			Receive:  takerReceive,
+			Change:   tstScript(3),
+			Fee:      500,
+		})
+		if err != nil {
+			t.Fatalf("%v: failed to accept offer: %v", test.desc, err)
+		}
+		signed := 0
+		err = trade.SignTaker(b, tstSign(&signed))
+		if err != nil {
+			t.Fatalf("%v: taker failed to sign: %v", test.desc, err)
+		}
+		trade = tstRoundTrip(t, trade)
+		err = trade.SignMaker(b, made, tstSign(&signed))
+		if err != nil {
+			t.Fatalf("%v: maker failed to sign: %v", test.desc, err)
+		}
+		trade = tstRoundTrip(t, trade)
+		shaHash, err := b.PublishTx(trade.Tx)
+		if err != nil {
+			t.Fatalf("%v: failed to publish: %v", test.desc, err)
+		}
+		chain.Mine()
+
+		// Verify
+		if signed != len(trade.Tx.TxIn) {
+			t.Errorf("%v: wrong number of inputs signed: got %d, want %d",
+				test.desc, signed, len(trade.Tx.TxIn))
+		}
+		for _, txIn := range trade.Tx.TxIn {
+			if len(txIn.SignatureScript) == 0 {
+				t.Errorf("%v: input %v is not signed", test.desc, txIn.PreviousOutPoint)
+			}
+		}
+		for _, side := range []struct {
+			leg     p2ptrade.Leg
+			receive []byte
+			amount  int64
+		}{
+			{test.want, makerReceive, test.makerGets},
+			{test.give, takerReceive, test.takerGets},
+		} {
+			found := false
+			for j, txOut := range trade.Tx.TxOut {
+				if string(txOut.PkScript) != string(side.receive) {
+					continue
+				}
+				found = true
+				got := txOut.Value
+				if !side.leg.IsBitcoin() {
+					cv, err := side.leg.Definition.ColorValue(b, btcwire.NewOutPoint(shaHash, uint32(j)))
+					if err != nil {
+						t.Fatalf("%v: failed to trace: %v", test.desc, err)
+					}
+					got = int64(*cv)
+				}
+				if got != side.amount {
+					t.Errorf("%v: wrong amount received: got %d, want %d",
+						test.desc, got, side.amount)
+				}
+			}
+			if !found {
+				t.Errorf("%v: nothing paid to %x", test.desc, side.receive)
+			}
+		}
+		kept := gochroma.ColorValue(0)
+		for j, txOut := range trade.Tx.TxOut {
+			if string(txOut.PkScript) != string(tstScript(4)) {
+				continue
+			}
+			cv, err := test.give.Definition.ColorValue(b, btcwire.NewOutPoint(shaHash, uint32(j)))
+			if err != nil {
+				t.Fatalf("%v: failed to trace: %v", test.desc, err)
+			}
+			kept += *cv
+		}
+		if kept != test.makerKeeps {
+			t.Errorf("%v: maker kept %d color value, want %d", test.desc, kept, test.makerKeeps)
+		}
+	}
+}
+
+func TestTradeRefuse(t *testing.T) {
+	chain := kerneltest.NewMemChain()
+	cdA := tstIssue(t, chain, 100)
+	cdB := tstIssue(t, chain, 50)
+	uncolored := chain.Fund(10000, tstScript(0))
+	chain.Mine()
+
+	tests := []struct {
+		desc     string
+		takerIns []*gochroma.ColorIn
+		tamper   func(*p2ptrade.Trade)
+	}{
+		{
+			desc: "tx changed",
+			tamper: func(trade *p2ptrade.Trade) {
+				trade.Tx.TxOut[0].PkScript = tstScript(99)
+			},
+		},
+		{
+			desc: "color inputs don't have the color",
+			takerIns: []*gochroma.ColorIn{
+				&gochroma.ColorIn{OutPoint: uncolored, ColorValue: 50},
+			},
+		},
+		{
+			desc: "half changed",
+			tamper: func(trade *p2ptrade.Trade) {
+				trade.Taker.Fee = 100
+			},
+		},
+		{
+			// the change output in the tx is left as is, paying to an
+			// empty script anyone could spend
+			desc: "taker's change script dropped on the way",
+			tamper: func(trade *p2ptrade.Trade) {
+				last := trade.Tx.TxOut[len(trade.Tx.TxOut)-1]
+				last.PkScript = nil
+				trade.Taker.Change = nil
+				*trade = *tstRoundTrip(t, trade)
+			},
+		},
+		{
+			// the taker asks for less and rebuilds the tx to match
+			desc: "offer changed",
+			tamper: func(trade *p2ptrade.Trade) {
+				offer := *trade.Offer
+				offer.Want.Amount = 25
+				taker := *trade.Taker
+				taker.ColorChange = tstScript(12)
+				rebuilt, err := offer.Accept(chain.NewBlockExplorer(), &taker)
+				if err != nil {
+					t.Fatalf("failed to accept changed offer: %v", err)
+				}
+				*trade = *rebuilt
+			},
+		},
+		{
+			desc: "maker's half changed",
+			tamper: func(trade *p2ptrade.Trade) {
+				offer := *trade.Offer
+				maker := *offer.Maker
+				maker.Receive = tstScript(11)
+				offer.Maker = &maker
+				rebuilt, err := offer.Accept(chain.NewBlockExplorer(), trade.Taker)
+				if err != nil {
+					t.Fatalf("failed to accept changed offer: %v", err)
+				}
+				*trade = *rebuilt
+			},
+		},
+	}
+
+	for _, test := range tests {
+		// Setup
+		b := chain.NewBlockExplorer()
+		makerFunding := chain.Fund(20000, tstScript(0))
+		takerFunding := chain.Fund(20000, tstScript(0))
+		chain.Mine()
+		takerIns := test.takerIns
+		if takerIns == nil {
+			takerIns = []*gochroma.ColorIn{&gochroma.ColorIn{OutPoint: cdB.Genesis, ColorValue: 50}}
+		}
+		offer, err := p2ptrade.NewOffer(
+			p2ptrade.Leg{Definition: cdA, Amount: 100},
+			p2ptrade.Leg{Definition: cdB, Amount: 50},
+			&p2ptrade.Half{
+				ColorIns: []*gochroma.ColorIn{&gochroma.ColorIn{OutPoint: cdA.Genesis, ColorValue: 100}},
+				Funding:  []*btcwire.OutPoint{makerFunding},
+				Receive:  tstScript(10),
+				Change:   tstScript(2),
+			})
+		if err != nil {
+			t.Fatalf("%v: failed to make offer: %v", test.desc, err)
+		}
+		trade, err := offer.Accept(b, &p2ptrade.Half{
+			ColorIns: takerIns,
+			Funding:  []*btcwire.OutPoint{takerFunding},
+			Receive:  tstScript(11),
+			Change:   tstScript(3),
+		})
+		if err != nil {
+			t.Fatalf("%v: failed to accept offer: %v", test.desc, err)
+		}
+		if test.tamper != nil {
+			test.tamper(trade)
+		}
+
+		// Execute
+		signed := 0
+		err = trade.SignMaker(b, offer, tstSign(&signed))
+
+		// Verify
+		if signed != 0 {
+			t.Errorf("%v: signed %d inputs of a bad trade", test.desc, signed)
+		}
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(gochroma.ErrBadTrade)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
+func TestTradeError(t *testing.T) {
+	chain := kerneltest.NewMemChain()
+	cdA := tstIssue(t, chain, 100)
+	funding := chain.Fund(20000, tstScript(0))
+	takerFunding := chain.Fund(20000, tstScript(0))
+	chain.Mine()
+	maker := &p2ptrade.Half{
+		ColorIns: []*gochroma.ColorIn{&gochroma.ColorIn{OutPoint: cdA.Genesis, ColorValue: 100}},
+		Funding:  []*btcwire.OutPoint{funding},
+		Receive:  tstScript(10),
+		Change:   tstScript(2),
+	}
+
+	tests := []struct {
+		desc string
+		give p2ptrade.Leg
+		want p2ptrade.Leg
+		fee  int64
+		// changes the halves before the offer is accepted
+		tamper func(maker, taker *p2ptrade.Half)
+		err    int
+	}{
+		{
+			desc: "bitcoin for bitcoin",
+			give: p2ptrade.Leg{Amount: 100},
+			want: p2ptrade.Leg{Amount: 100},
+			err:  gochroma.ErrBadTrade,
+		},
+		{
+			desc: "zero amount",
+			give: p2ptrade.Leg{Definition: cdA, Amount: 100},
+			want: p2ptrade.Leg{Amount: 0},
+			err:  gochroma.ErrNegativeValue,
+		},
+		{
+			desc: "taker can't pay",
+			give: p2ptrade.Leg{Definition: cdA, Amount: 100},
+			want: p2ptrade.Leg{Amount: 100000},
+			err:  gochroma.ErrInsufficientFunds,
+		},
+		{
+			desc: "maker can't pay fee",
+			give: p2ptrade.Leg{Definition: cdA, Amount: 100},
+			want: p2ptrade.Leg{Amount: 100},
+			fee:  100000,
+			err:  gochroma.ErrInsufficientFunds,
+		},
+		{
+			desc: "maker has change and no script for it",
+			give: p2ptrade.Leg{Definition: cdA, Amount: 100},
+			want: p2ptrade.Leg{Amount: 100},
+			tamper: func(maker, taker *p2ptrade.Half) {
+				maker.Change = nil
+			},
+			err: gochroma.ErrBadTrade,
+		},
+		{
+			desc: "taker has change and no script for it",
+			give: p2ptrade.Leg{Definition: cdA, Amount: 100},
+			want: p2ptrade.Leg{Amount: 100},
+			tamper: func(maker, taker *p2ptrade.Half) {
+				taker.Change = nil
+			},
+			err: gochroma.ErrBadTrade,
+		},
+		{
+			desc: "taker has no script to receive to",
+			give: p2ptrade.Leg{Definition: cdA, Amount: 100},
+			want: p2ptrade.Leg{Amount: 100},
+			tamper: func(maker, taker *p2ptrade.Half) {
+				taker.Receive = nil
+			},
+			err: gochroma.ErrBadTrade,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		made := *maker
+		made.Fee = test.fee
+		taker := &p2ptrade.Half{
+			Funding: []*btcwire.OutPoint{takerFunding},
+			Receive: tstScript(11),
+			Change:  tstScript(3),
+		}
+		if test.tamper != nil {
+			test.tamper(&made, taker)
+		}
+		offer, err := p2ptrade.NewOffer(test.give, test.want, &made)
+		if err == nil {
+			_, err = offer.Accept(chain.NewBlockExplorer(), taker)
+		}
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
+// tstKernel is an EPOBC kernel under a code only its own registry knows
+type tstKernel struct {
+	gochroma.EPOBC
+}
+
+func (k *tstKernel) Code() string {
+	return "TSTEPOBC"
+}
+
+func TestTradeJSONRegistry(t *testing.T) {
+	// Setup
+	kernel := &tstKernel{gochroma.EPOBC{MinimumSatoshi: 546}}
+	r := gochroma.NewKernelRegistry()
+	err := r.Register(kernel)
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	shaHash, err := btcwire.NewShaHashFromStr(
+		"0f9d0b4a1a8e2e5b9b1d6ac0d2a05fb43cfa2bd4c3a8d1b0a3e8e74ee3c8aa4e")
+	if err != nil {
+		t.Fatalf("err on shahash creation: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(kernel, btcwire.NewOutPoint(shaHash, 0), 1)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	half := &p2ptrade.Half{
+		Funding: []*btcwire.OutPoint{btcwire.NewOutPoint(shaHash, 1)},
+		Receive: tstScript(10),
+		Change:  tstScript(2),
+	}
+	offer, err := p2ptrade.NewOffer(p2ptrade.Leg{Definition: cd, Amount: 100},
+		p2ptrade.Leg{Amount: 10000}, half)
+	if err != nil {
+		t.Fatalf("failed to make offer: %v", err)
+	}
+	tx := btcwire.NewMsgTx()
+	tx.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(shaHash, 1), nil))
+	tx.AddTxOut(btcwire.NewTxOut(10000, tstScript(10)))
+	offerData, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatalf("failed to encode offer: %v", err)
+	}
+	tradeData, err := json.Marshal(&p2ptrade.Trade{Offer: offer, Taker: half, Tx: tx})
+	if err != nil {
+		t.Fatalf("failed to encode trade: %v", err)
+	}
+
+	// Execute
+	gotOffer, err := p2ptrade.UnmarshalOffer(r, offerData)
+	if err != nil {
+		t.Fatalf("failed to decode offer: %v", err)
+	}
+	gotTrade, err := p2ptrade.UnmarshalTrade(r, tradeData)
+	if err != nil {
+		t.Fatalf("failed to decode trade: %v", err)
+	}
+
+	// Verify
+	if gotOffer.Give.Definition.ColorKernel != kernel {
+		t.Errorf("offer kernel not from the registry: got %v", gotOffer.Give.Definition.ColorKernel)
+	}
+	if gotTrade.Offer.Give.Definition.ColorKernel != kernel {
+		t.Errorf("trade kernel not from the registry: got %v", gotTrade.Offer.Give.Definition.ColorKernel)
+	}
+	if len(gotTrade.Tx.TxOut) != 1 || gotTrade.Tx.TxOut[0].Value != 10000 {
+		t.Errorf("trade tx changed in the round trip")
+	}
+	// the default registry doesn't know the kernel
+	err = json.Unmarshal(offerData, new(p2ptrade.Offer))
+	if err == nil {
+		t.Fatalf("expected error decoding with the default registry, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	wantErr := gochroma.ErrorCode(gochroma.ErrNonExistentKernel)
+	if rerr.ErrorCode != wantErr {
+		t.Fatalf("wrong error passed back: got %v, want %v", rerr.ErrorCode, wantErr)
+	}
+}
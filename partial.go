@@ -0,0 +1,539 @@
+package gochroma
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/btcsuite/btcscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+)
+
+// PartialInput is what signing an input of a PartialTx needs and what it
+// has gathered so far.
+type PartialInput struct {
+	// the output the input spends
+	PrevOut *btcwire.TxOut
+	// the multisig script of a pay-to-script-hash output
+	RedeemScript []byte
+	// signatures by hex serialized public key
+	Signatures map[string][]byte
+	// the signature script once there are enough signatures
+	FinalScript []byte
+}
+
+// PartialTx is an unsigned colored tx being passed between the parties
+// that sign it, with what they need to check it and sign it offline.
+// Signatures are kept by input and public key, so parties can sign copies
+// in parallel and combine them.
+type PartialTx struct {
+	// the tx without signature scripts
+	Tx     *btcwire.MsgTx
+	Inputs []*PartialInput
+	// the color value of every input and output for each color the tx
+	// moves, as the kernels compute it
+	Flows []*ColorFlow
+}
+
+// NewPartialTx returns the tx to be signed with the outputs it spends and
+// the color values the kernels of the definitions compute for it. Any
+// signature scripts the tx has are dropped.
+func NewPartialTx(b *BlockExplorer, defs []*ColorDefinition, tx *btcwire.MsgTx) (*PartialTx, error) {
+	p := &PartialTx{
+		Tx:     tx.Copy(),
+		Inputs: make([]*PartialInput, len(tx.TxIn)),
+	}
+	for i, txIn := range p.Tx.TxIn {
+		txIn.SignatureScript = nil
+		prevOut, err := b.OutPointTxOut(&txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		p.Inputs[i] = &PartialInput{
+			PrevOut:    prevOut,
+			Signatures: make(map[string][]byte),
+		}
+	}
+	for _, cd := range defs {
+		flow, err := colorFlow(b, cd, p.Tx)
+		if err != nil {
+			return nil, err
+		}
+		p.Flows = append(p.Flows, flow)
+	}
+	return p, nil
+}
+
+func badPartialTx(format string, args ...interface{}) error {
+	return MakeError(ErrBadPartialTx, fmt.Sprintf(format, args...), nil)
+}
+
+// Validate checks the outputs the inputs spend and the color values
+// against the chain and the kernels, which a party should do before
+// signing a PartialTx it was sent.
+func (p *PartialTx) Validate(b *BlockExplorer) error {
+	if len(p.Inputs) != len(p.Tx.TxIn) {
+		return badPartialTx("%d inputs described for %d inputs",
+			len(p.Inputs), len(p.Tx.TxIn))
+	}
+	for i, txIn := range p.Tx.TxIn {
+		prevOut, err := b.OutPointTxOut(&txIn.PreviousOutPoint)
+		if err != nil {
+			return err
+		}
+		input := p.Inputs[i]
+		if input.PrevOut.Value != prevOut.Value ||
+			!bytes.Equal(input.PrevOut.PkScript, prevOut.PkScript) {
+			return badPartialTx("input %d does not spend the output described", i)
+		}
+	}
+	for _, flow := range p.Flows {
+		want, err := colorFlow(b, flow.Definition, p.Tx)
+		if err != nil {
+			return err
+		}
+		if !flowsEqual(flow, want) {
+			return badPartialTx("color values of %v are not what the kernel computes",
+				flow.Definition)
+		}
+	}
+	return nil
+}
+
+// flowsEqual returns whether the flows are of the same color and have
+// the same color values.
+func flowsEqual(a, b *ColorFlow) bool {
+	return a.Definition.HashString() == b.Definition.HashString() &&
+		reflect.DeepEqual(a.Inputs, b.Inputs) &&
+		reflect.DeepEqual(a.Outputs, b.Outputs) &&
+		a.In == b.In && a.Out == b.Out &&
+		a.Burned == b.Burned && a.Issuance == b.Issuance
+}
+
+// pushData returns the script pushing the data.
+func pushData(data []byte) []byte {
+	switch {
+	case len(data) < 0x4c:
+		return append([]byte{byte(len(data))}, data...)
+	case len(data) <= 0xff:
+		return append([]byte{0x4c, byte(len(data))}, data...)
+	}
+	return append([]byte{0x4d, byte(len(data)), byte(len(data) >> 8)}, data...)
+}
+
+// multisigKeys returns the number of signatures the multisig script
+// needs and its public keys.
+func multisigKeys(script []byte) (int, [][]byte, error) {
+	if btcscript.GetScriptClass(script) != btcscript.MultiSigTy {
+		return 0, nil, MakeError(ErrSign, "redeem script is not multisig", nil)
+	}
+	pubKeys, err := btcscript.PushedData(script)
+	if err != nil {
+		return 0, nil, MakeError(ErrSign, "redeem script is unparseable", err)
+	}
+	// OP_1 through OP_16
+	return int(script[0]) - 0x50, pubKeys, nil
+}
+
+// Sign adds the signatures the key store can make to the inputs that
+// aren't final, and returns how many it added. Inputs it has no keys
+// for are left alone.
+func (p *PartialTx) Sign(s *KeyStore) (int, error) {
+	added := 0
+	for i, input := range p.Inputs {
+		if input.FinalScript != nil {
+			continue
+		}
+		class, addrs, _, err := btcscript.ExtractPkScriptAddrs(input.PrevOut.PkScript, s.Net)
+		if err != nil || len(addrs) != 1 {
+			str := fmt.Sprintf("input %d spends a script that can't be signed", i)
+			return added, MakeError(ErrSign, str, err)
+		}
+		subscript := input.PrevOut.PkScript
+		var pubKeys [][]byte
+		switch class {
+		case btcscript.PubKeyHashTy:
+			key, compress, err := s.GetKey(addrs[0])
+			if err != nil {
+				continue
+			}
+			pubKey := key.PubKey().SerializeUncompressed()
+			if compress {
+				pubKey = key.PubKey().SerializeCompressed()
+			}
+			pubKeys = [][]byte{pubKey}
+		case btcscript.ScriptHashTy:
+			if input.RedeemScript == nil {
+				input.RedeemScript, err = s.GetScript(addrs[0])
+				if err != nil {
+					continue
+				}
+			}
+			subscript = input.RedeemScript
+			_, pubKeys, err = multisigKeys(subscript)
+			if err != nil {
+				return added, err
+			}
+		default:
+			str := fmt.Sprintf("input %d spends a script that can't be signed", i)
+			return added, MakeError(ErrSign, str, nil)
+		}
+		for _, pubKey := range pubKeys {
+			n, err := p.signInput(s, i, subscript, pubKey)
+			if err != nil {
+				return added, err
+			}
+			added += n
+		}
+	}
+	return added, nil
+}
+
+// signInput adds the signature of the public key to the input if the key
+// store has its key, returning 1 if it does and 0 if it doesn't.
+func (p *PartialTx) signInput(s *KeyStore, i int, subscript, pubKey []byte) (int, error) {
+	id := hex.EncodeToString(pubKey)
+	input := p.Inputs[i]
+	if input.Signatures[id] != nil {
+		return 0, nil
+	}
+	wif := s.keyFor(pubKey)
+	if wif == nil {
+		return 0, nil
+	}
+	script, err := btcscript.SignatureScript(p.Tx, i, subscript,
+		btcscript.SigHashAll, wif.PrivKey, wif.CompressPubKey)
+	if err != nil {
+		str := fmt.Sprintf("failed to sign input %d", i)
+		return 0, MakeError(ErrSign, str, err)
+	}
+	pushes, err := btcscript.PushedData(script)
+	if err != nil || len(pushes) == 0 {
+		str := fmt.Sprintf("failed to sign input %d", i)
+		return 0, MakeError(ErrSign, str, err)
+	}
+	if input.Signatures == nil {
+		input.Signatures = make(map[string][]byte)
+	}
+	input.Signatures[id] = pushes[0]
+	return 1, nil
+}
+
+// Finalize builds the signature script of every input with enough
+// signatures and checks them. It's an ErrSign error if some input doesn't
+// have enough yet; the inputs that do are final all the same.
+func (p *PartialTx) Finalize() error {
+	missing := 0
+	for i, input := range p.Inputs {
+		if input.FinalScript != nil {
+			continue
+		}
+		script, err := input.finalScript()
+		if err != nil {
+			return err
+		}
+		if script == nil {
+			missing++
+			continue
+		}
+		tx := p.Tx.Copy()
+		tx.TxIn[i].SignatureScript = script
+		engine, err := btcscript.NewScript(script, input.PrevOut.PkScript, i, tx, VerifyFlags)
+		if err == nil {
+			err = engine.Execute()
+		}
+		if err != nil {
+			str := fmt.Sprintf("input %d does not verify", i)
+			return MakeError(ErrBadSignature, str, err)
+		}
+		input.FinalScript = script
+	}
+	if missing > 0 {
+		str := fmt.Sprintf("%d inputs do not have enough signatures", missing)
+		return MakeError(ErrSign, str, nil)
+	}
+	return nil
+}
+
+// finalScript returns the signature script of the input, or nil if it
+// doesn't have enough signatures for one.
+func (input *PartialInput) finalScript() ([]byte, error) {
+	switch btcscript.GetScriptClass(input.PrevOut.PkScript) {
+	case btcscript.PubKeyHashTy:
+		// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+		hash := input.PrevOut.PkScript[3:23]
+		for id, sig := range input.Signatures {
+			pubKey, err := hex.DecodeString(id)
+			if err != nil {
+				return nil, badPartialTx("public key %v is not hex", id)
+			}
+			if bytes.Equal(btcutil.Hash160(pubKey), hash) {
+				return append(pushData(sig), pushData(pubKey)...), nil
+			}
+		}
+		return nil, nil
+	case btcscript.ScriptHashTy:
+		if input.RedeemScript == nil {
+			return nil, nil
+		}
+		required, pubKeys, err := multisigKeys(input.RedeemScript)
+		if err != nil {
+			return nil, err
+		}
+		// OP_0 for the extra item OP_CHECKMULTISIG pops, then the
+		// signatures in the order of the keys
+		script := []byte{0x00}
+		count := 0
+		for _, pubKey := range pubKeys {
+			sig, ok := input.Signatures[hex.EncodeToString(pubKey)]
+			if ok && count < required {
+				script = append(script, pushData(sig)...)
+				count++
+			}
+		}
+		if count < required {
+			return nil, nil
+		}
+		return append(script, pushData(input.RedeemScript)...), nil
+	}
+	return nil, MakeError(ErrSign, "input spends a script that can't be signed", nil)
+}
+
+// Extract returns the signed tx, ready to publish, once every input is
+// final.
+func (p *PartialTx) Extract() (*btcwire.MsgTx, error) {
+	tx := p.Tx.Copy()
+	prevOuts := make([]*btcwire.TxOut, len(p.Inputs))
+	for i, input := range p.Inputs {
+		if input.FinalScript == nil {
+			str := fmt.Sprintf("input %d is not final", i)
+			return nil, MakeError(ErrSign, str, nil)
+		}
+		tx.TxIn[i].SignatureScript = input.FinalScript
+		prevOuts[i] = input.PrevOut
+	}
+	err := verifyScripts(tx, prevOuts)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// CombinePartialTxs merges the signatures of copies of the same PartialTx
+// signed by different parties. The copies have to agree on everything
+// but the signatures.
+func CombinePartialTxs(parts ...*PartialTx) (*PartialTx, error) {
+	if len(parts) == 0 {
+		return nil, badPartialTx("nothing to combine")
+	}
+	first := parts[0]
+	shaHash, err := first.Tx.TxSha()
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	combined := &PartialTx{
+		Tx:     first.Tx.Copy(),
+		Inputs: make([]*PartialInput, len(first.Inputs)),
+		Flows:  first.Flows,
+	}
+	for i, input := range first.Inputs {
+		combined.Inputs[i] = &PartialInput{
+			PrevOut:    input.PrevOut,
+			Signatures: make(map[string][]byte),
+		}
+	}
+	for _, part := range parts {
+		partHash, err := part.Tx.TxSha()
+		if err != nil {
+			return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+		}
+		if !partHash.IsEqual(&shaHash) || len(part.Inputs) != len(first.Inputs) {
+			return nil, badPartialTx("tx %v is not tx %v", partHash, shaHash)
+		}
+		agree := len(part.Flows) == len(first.Flows)
+		for i := 0; agree && i < len(part.Flows); i++ {
+			agree = flowsEqual(part.Flows[i], first.Flows[i])
+		}
+		if !agree {
+			return nil, badPartialTx("color values of tx %v do not agree", shaHash)
+		}
+		for i, input := range part.Inputs {
+			into := combined.Inputs[i]
+			if !reflect.DeepEqual(input.PrevOut, into.PrevOut) {
+				return nil, badPartialTx("input %d spends different outputs", i)
+			}
+			if input.RedeemScript != nil {
+				if into.RedeemScript != nil && !bytes.Equal(input.RedeemScript, into.RedeemScript) {
+					return nil, badPartialTx("input %d has different redeem scripts", i)
+				}
+				into.RedeemScript = input.RedeemScript
+			}
+			for id, sig := range input.Signatures {
+				into.Signatures[id] = sig
+			}
+			if input.FinalScript != nil {
+				into.FinalScript = input.FinalScript
+			}
+		}
+	}
+	return combined, nil
+}
+
+// A PartialTx goes between the parties as JSON, with the tx, scripts and
+// signatures as hex and color definitions in their string form.
+
+type jsonPartialInput struct {
+	Value        int64             `json:"value"`
+	PkScript     string            `json:"pkScript"`
+	RedeemScript string            `json:"redeemScript,omitempty"`
+	Signatures   map[string]string `json:"signatures,omitempty"`
+	FinalScript  string            `json:"finalScript,omitempty"`
+}
+
+type jsonColorFlow struct {
+	Definition string       `json:"definition"`
+	Inputs     []ColorValue `json:"inputs"`
+	Outputs    []ColorValue `json:"outputs"`
+	Burned     ColorValue   `json:"burned,omitempty"`
+	Issuance   bool         `json:"issuance,omitempty"`
+}
+
+type jsonPartialTx struct {
+	Tx     string             `json:"tx"`
+	Inputs []jsonPartialInput `json:"inputs"`
+	Flows  []jsonColorFlow    `json:"flows"`
+}
+
+// MarshalJSON encodes the PartialTx to pass to the next party.
+func (p *PartialTx) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := p.Tx.Serialize(&buf)
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "failed to serialize tx", err)
+	}
+	j := jsonPartialTx{
+		Tx:     hex.EncodeToString(buf.Bytes()),
+		Inputs: make([]jsonPartialInput, len(p.Inputs)),
+		Flows:  make([]jsonColorFlow, len(p.Flows)),
+	}
+	for i, input := range p.Inputs {
+		j.Inputs[i] = jsonPartialInput{
+			Value:        input.PrevOut.Value,
+			PkScript:     hex.EncodeToString(input.PrevOut.PkScript),
+			RedeemScript: hex.EncodeToString(input.RedeemScript),
+			FinalScript:  hex.EncodeToString(input.FinalScript),
+		}
+		if len(input.Signatures) > 0 {
+			j.Inputs[i].Signatures = make(map[string]string)
+		}
+		for id, sig := range input.Signatures {
+			j.Inputs[i].Signatures[id] = hex.EncodeToString(sig)
+		}
+	}
+	for i, flow := range p.Flows {
+		j.Flows[i] = jsonColorFlow{
+			Definition: flow.Definition.String(),
+			Inputs:     flow.Inputs,
+			Outputs:    flow.Outputs,
+			Burned:     flow.Burned,
+			Issuance:   flow.Issuance,
+		}
+	}
+	return json.Marshal(j)
+}
+
+func decodePartialHex(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, MakeError(ErrBadPartialTx, "hex is invalid", err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON decodes a PartialTx, looking up the kernels of the color
+// definitions in DefaultKernelRegistry. Nothing is checked beyond the
+// encoding; use Validate for that.
+func (p *PartialTx) UnmarshalJSON(data []byte) error {
+	decoded, err := DefaultKernelRegistry.UnmarshalPartialTx(data)
+	if err != nil {
+		return err
+	}
+	*p = *decoded
+	return nil
+}
+
+// UnmarshalPartialTx decodes a PartialTx encoded with MarshalJSON, looking
+// up the kernels of the color definitions in this registry.
+func (r *KernelRegistry) UnmarshalPartialTx(data []byte) (*PartialTx, error) {
+	var j jsonPartialTx
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return nil, MakeError(ErrBadPartialTx, "partially signed tx is unparseable", err)
+	}
+	raw, err := decodePartialHex(j.Tx)
+	if err != nil {
+		return nil, err
+	}
+	tx := btcwire.NewMsgTx()
+	err = tx.Deserialize(bytes.NewReader(raw))
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "failed to deserialize tx", err)
+	}
+	decoded := &PartialTx{
+		Tx:     tx,
+		Inputs: make([]*PartialInput, len(j.Inputs)),
+		Flows:  make([]*ColorFlow, len(j.Flows)),
+	}
+	for i, input := range j.Inputs {
+		pkScript, err := decodePartialHex(input.PkScript)
+		if err != nil {
+			return nil, err
+		}
+		decoded.Inputs[i] = &PartialInput{
+			PrevOut:    btcwire.NewTxOut(input.Value, pkScript),
+			Signatures: make(map[string][]byte),
+		}
+		decoded.Inputs[i].RedeemScript, err = decodePartialHex(input.RedeemScript)
+		if err != nil {
+			return nil, err
+		}
+		decoded.Inputs[i].FinalScript, err = decodePartialHex(input.FinalScript)
+		if err != nil {
+			return nil, err
+		}
+		for id, sig := range input.Signatures {
+			decoded.Inputs[i].Signatures[id], err = decodePartialHex(sig)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, flow := range j.Flows {
+		cd, err := r.NewColorDefinitionFromStr(flow.Definition)
+		if err != nil {
+			return nil, err
+		}
+		decoded.Flows[i] = &ColorFlow{
+			Definition: cd,
+			Inputs:     flow.Inputs,
+			Outputs:    flow.Outputs,
+			Burned:     flow.Burned,
+			Issuance:   flow.Issuance,
+		}
+		decoded.Flows[i].In, err = SumColorValues(flow.Inputs)
+		if err != nil {
+			return nil, err
+		}
+		decoded.Flows[i].Out, err = SumColorValues(flow.Outputs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
@@ -0,0 +1,195 @@
+package gochroma_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+// tstPartial sets up a tx moving color value from a 2 of 3 multisig
+// output, funded by a pay-to-pubkey-hash output, to be signed with the
+// keys
+func tstPartial(t *testing.T) (*kerneltest.MemChain, *gochroma.PartialTx, []*btcutil.WIF, []byte) {
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	wifs := []*btcutil.WIF{tstWIF(t, 1), tstWIF(t, 2), tstWIF(t, 3), tstWIF(t, 4)}
+	redeemScript := tstMultisig(t, 2, wifs[1:]...)
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+
+	issuing := chain.Fund(epobc.IssuingSatoshiNeeded(100)+1000, tstScript(0))
+	funding := chain.Fund(100000, tstP2PKH(t, wifs[0]))
+	chain.Mine()
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstP2SH(t, redeemScript), 100}}
+	tx, err := epobc.IssuingTx(b, []*btcwire.OutPoint{issuing}, outputs, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make issuing tx: %v", err)
+	}
+	shaHash := tstPublish(t, chain, tx)
+	height, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(shaHash, 0), height)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+
+	group := &gochroma.ColorGroup{
+		Definition: cd,
+		Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}},
+		Outputs:    []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 100}},
+	}
+	tx, err = epobc.(gochroma.MultiColorKernel).MultiColorTx(b,
+		[]*gochroma.ColorGroup{group}, []*btcwire.OutPoint{funding}, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	p, err := gochroma.NewPartialTx(b, []*gochroma.ColorDefinition{cd}, tx)
+	if err != nil {
+		t.Fatalf("failed to make partial tx: %v", err)
+	}
+	return chain, p, wifs, redeemScript
+}
+
+// tstPartialCopy passes the partial tx through JSON
+func tstPartialCopy(t *testing.T, p *gochroma.PartialTx) *gochroma.PartialTx {
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var copied gochroma.PartialTx
+	err = json.Unmarshal(data, &copied)
+	if err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	return &copied
+}
+
+// tstKeyStore returns a key store with the keys and the redeem script
+func tstKeyStore(t *testing.T, redeemScript []byte, wifs ...*btcutil.WIF) *gochroma.KeyStore {
+	store := gochroma.NewKeyStore(&btcnet.TestNet3Params)
+	for _, wif := range wifs {
+		err := store.AddKey(wif)
+		if err != nil {
+			t.Fatalf("failed to add key: %v", err)
+		}
+	}
+	_, err := store.AddScript(redeemScript)
+	if err != nil {
+		t.Fatalf("failed to add script: %v", err)
+	}
+	return store
+}
+
+func TestPartialTx(t *testing.T) {
+	// Setup
+	chain, p, wifs, redeemScript := tstPartial(t)
+	b := chain.NewBlockExplorer()
+	mine := tstPartialCopy(t, p)
+	theirs := tstPartialCopy(t, p)
+
+	// Execute
+	err := mine.Validate(b)
+	if err != nil {
+		t.Fatalf("copy does not validate: %v", err)
+	}
+	added, err := mine.Sign(tstKeyStore(t, redeemScript, wifs[0], wifs[1]))
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("added %d signatures, want 2", added)
+	}
+	err = mine.Finalize()
+	if err == nil {
+		t.Errorf("finalized with one signature of two")
+	}
+	added, err = theirs.Sign(tstKeyStore(t, redeemScript, wifs[3]))
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if added != 1 {
+		t.Errorf("added %d signatures, want 1", added)
+	}
+	combined, err := gochroma.CombinePartialTxs(tstPartialCopy(t, mine), tstPartialCopy(t, theirs))
+	if err != nil {
+		t.Fatalf("failed to combine: %v", err)
+	}
+	err = combined.Finalize()
+	if err != nil {
+		t.Fatalf("failed to finalize: %v", err)
+	}
+	tx, err := tstPartialCopy(t, combined).Extract()
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	err = gochroma.VerifyTxScripts(b, tx)
+	if err != nil {
+		t.Errorf("extracted tx does not verify: %v", err)
+	}
+	flow := combined.Flows[0]
+	if flow.In != 100 || flow.Outputs[0] != 100 {
+		t.Errorf("wrong color values: in %d, out %v", flow.In, flow.Outputs)
+	}
+	report, err := gochroma.ValidateColorTx(b, []*gochroma.ColorDefinition{flow.Definition}, tx, gochroma.DefaultDustPolicy)
+	if err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("extracted tx is invalid: %v", report.Err())
+	}
+}
+
+func TestPartialTxError(t *testing.T) {
+	// Setup
+	chain, p, _, _ := tstPartial(t)
+	b := chain.NewBlockExplorer()
+	colorValue := tstPartialCopy(t, p)
+	colorValue.Flows[0].Outputs[0] = 99
+	prevOut := tstPartialCopy(t, p)
+	prevOut.Inputs[1].PrevOut.Value++
+	other := tstPartialCopy(t, p)
+	other.Tx.TxOut[0].Value++
+
+	tests := []struct {
+		desc string
+		err  error
+		code int
+	}{
+		{"color value", colorValue.Validate(b), gochroma.ErrBadPartialTx},
+		{"prevout", prevOut.Validate(b), gochroma.ErrBadPartialTx},
+		{"combine", func() error {
+			_, err := gochroma.CombinePartialTxs(p, other)
+			return err
+		}(), gochroma.ErrBadPartialTx},
+		{"extract", func() error {
+			_, err := p.Extract()
+			return err
+		}(), gochroma.ErrSign},
+		{"unmarshal", json.Unmarshal([]byte(`{"tx": 1}`), &gochroma.PartialTx{}),
+			gochroma.ErrBadPartialTx},
+	}
+
+	for _, test := range tests {
+		// Verify
+		if test.err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := test.err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(test.code)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
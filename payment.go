@@ -0,0 +1,183 @@
+package gochroma
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// PaymentURIScheme is the scheme of payment request URIs, as in BIP 21.
+// The color goes in a req-color parameter so that wallets that don't know
+// about colors refuse the request instead of paying bitcoin.
+const PaymentURIScheme = "bitcoin"
+
+// PaymentRequest asks for color value of a color to be paid to an
+// address.
+type PaymentRequest struct {
+	Address    btcutil.Address
+	Definition *ColorDefinition
+	ColorValue ColorValue
+	Label      string
+	Message    string
+	// when the request stops being good, zero if it never does
+	Expires time.Time
+}
+
+// URI encodes the request like
+// bitcoin:ADDRESS?req-color=DEFINITION&amount=12.5&req-decimals=2&label=...
+// with the amount in units of the asset of the definition. The decimal
+// places of the asset go along with the amount, so that a payer who
+// doesn't know the asset reads the same color value, and are left out
+// when the amount is a raw color value.
+func (r *PaymentRequest) URI() string {
+	params := url.Values{}
+	params.Set("req-color", r.Definition.String())
+	if r.ColorValue > 0 {
+		// the amount is only the number, the color says what it's in
+		asset := &Asset{Decimals: r.Definition.asset().Decimals}
+		params.Set("amount", asset.Format(r.ColorValue))
+		if asset.Decimals > 0 {
+			params.Set("req-decimals", strconv.Itoa(asset.Decimals))
+		}
+	}
+	if r.Label != "" {
+		params.Set("label", r.Label)
+	}
+	if r.Message != "" {
+		params.Set("message", r.Message)
+	}
+	if !r.Expires.IsZero() {
+		params.Set("exp", strconv.FormatInt(r.Expires.Unix(), 10))
+	}
+	// BIP 21 wants spaces as %20
+	query := strings.Replace(params.Encode(), "+", "%20", -1)
+	return PaymentURIScheme + ":" + r.Address.EncodeAddress() + "?" + query
+}
+
+// ColorOut returns the output paying the request.
+func (r *PaymentRequest) ColorOut() (*ColorOut, error) {
+	script, err := btcscript.PayToAddrScript(r.Address)
+	if err != nil {
+		return nil, MakeError(ErrBadPaymentURI, "can't pay to the address", err)
+	}
+	return &ColorOut{Script: script, ColorValue: r.ColorValue}, nil
+}
+
+// Expired returns whether the request is no longer good at the time.
+func (r *PaymentRequest) Expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// ParsePaymentURI decodes a payment request URI for an address on the
+// network, looking up the kernel of the color in DefaultKernelRegistry.
+func ParsePaymentURI(uri string, net *btcnet.Params, known []*ColorDefinition) (*PaymentRequest, error) {
+	return DefaultKernelRegistry.ParsePaymentURI(uri, net, known)
+}
+
+// ParsePaymentURI decodes a payment request URI for an address on the
+// network. The color definition is parsed with NewColorDefinitionFromStr
+// of this registry, and its asset is taken from the known definition of
+// the same color if there is one. The amount has the decimal places of
+// req-decimals, and is a raw color value without it, whatever the asset
+// is known to be. Like BIP 21, a req- parameter that isn't understood
+// makes the request invalid.
+func (r *KernelRegistry) ParsePaymentURI(uri string, net *btcnet.Params, known []*ColorDefinition) (*PaymentRequest, error) {
+	scheme := PaymentURIScheme + ":"
+	if len(uri) < len(scheme) || !strings.EqualFold(uri[:len(scheme)], scheme) {
+		str := fmt.Sprintf("uri does not start with %v", scheme)
+		return nil, MakeError(ErrBadPaymentURI, str, nil)
+	}
+	rest := uri[len(scheme):]
+	query := ""
+	if i := strings.Index(rest, "?"); i != -1 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+
+	address, err := btcutil.DecodeAddress(rest, net)
+	if err != nil {
+		return nil, MakeError(ErrBadPaymentURI, "address is invalid", err)
+	}
+	if !address.IsForNet(net) {
+		str := fmt.Sprintf("address is not for %v", net.Name)
+		return nil, MakeError(ErrBadPaymentURI, str, nil)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, MakeError(ErrBadPaymentURI, "parameters are invalid", err)
+	}
+	// checked in order of their keys, so that a uri with several bad
+	// parameters always gets the same error
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	req := &PaymentRequest{Address: address}
+	for _, key := range keys {
+		values := params[key]
+		if len(values) != 1 {
+			str := fmt.Sprintf("%v is given %d times", key, len(values))
+			return nil, MakeError(ErrBadPaymentURI, str, nil)
+		}
+		value := values[0]
+		switch key {
+		case "req-color":
+			req.Definition, err = r.NewColorDefinitionFromStr(value)
+			if err != nil {
+				return nil, err
+			}
+		case "label":
+			req.Label = value
+		case "message":
+			req.Message = value
+		case "exp":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, MakeError(ErrBadPaymentURI, "expiry is invalid", err)
+			}
+			req.Expires = time.Unix(seconds, 0)
+		case "amount", "req-decimals":
+			// parsed once the color is known
+		default:
+			if strings.HasPrefix(key, "req-") {
+				str := fmt.Sprintf("required parameter %v is not understood", key)
+				return nil, MakeError(ErrBadPaymentURI, str, nil)
+			}
+		}
+	}
+	if req.Definition == nil {
+		return nil, MakeError(ErrBadPaymentURI, "uri has no color", nil)
+	}
+	for _, cd := range known {
+		if cd.String() == req.Definition.String() {
+			req.Definition = cd
+			break
+		}
+	}
+	amount := params.Get("amount")
+	if amount != "" {
+		asset := &Asset{}
+		decimals := params.Get("req-decimals")
+		if decimals != "" {
+			asset.Decimals, err = strconv.Atoi(decimals)
+			if err == nil {
+				err = asset.validate()
+			}
+			if err != nil {
+				return nil, MakeError(ErrBadPaymentURI, "decimals are invalid", err)
+			}
+		}
+		req.ColorValue, err = asset.Parse(amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,155 @@
+package gochroma_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+// tstPaymentRequest returns a request for 12.50 GLD to a testnet address
+func tstPaymentRequest(t *testing.T) *gochroma.PaymentRequest {
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(epobc,
+		btcwire.NewOutPoint(&btcwire.ShaHash{1}, 0), 100)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	cd.Asset = &gochroma.Asset{Ticker: "GLD", Decimals: 2}
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	return &gochroma.PaymentRequest{
+		Address:    addr,
+		Definition: cd,
+		ColorValue: 1250,
+		Label:      "Gold Shop",
+		Message:    "order 7",
+		Expires:    time.Unix(1400000000, 0),
+	}
+}
+
+func TestPaymentURI(t *testing.T) {
+	// Setup
+	r := tstPaymentRequest(t)
+	want := "bitcoin:" + r.Address.EncodeAddress() + "?amount=12.50&exp=1400000000" +
+		"&label=Gold%20Shop&message=order%207&req-color=EPOBC%3A" +
+		r.Definition.Genesis.Hash.String() + "%3A0%3A100&req-decimals=2"
+
+	// Execute
+	uri := r.URI()
+	parsed, err := gochroma.ParsePaymentURI(uri, &btcnet.TestNet3Params,
+		[]*gochroma.ColorDefinition{r.Definition})
+
+	// Verify
+	if uri != want {
+		t.Errorf("got uri %v, want %v", uri, want)
+	}
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, r) {
+		t.Errorf("got %v, want %v", parsed, r)
+	}
+	out, err := parsed.ColorOut()
+	if err != nil {
+		t.Fatalf("failed to make output: %v", err)
+	}
+	if out.ColorValue != 1250 || len(out.Script) != 25 {
+		t.Errorf("wrong output: %v", out)
+	}
+	if parsed.Expired(time.Unix(1399999999, 0)) || !parsed.Expired(time.Unix(1400000000, 0)) {
+		t.Errorf("expires at the wrong time")
+	}
+}
+
+func TestParsePaymentURIUnknownColor(t *testing.T) {
+	// Setup
+	withAsset := tstPaymentRequest(t)
+	withoutAsset := tstPaymentRequest(t)
+	withoutAsset.Definition.Asset = nil
+	known := tstPaymentRequest(t).Definition
+	known.Asset.Decimals = 4
+
+	tests := []struct {
+		desc  string
+		r     *gochroma.PaymentRequest
+		known []*gochroma.ColorDefinition
+	}{
+		{"payee has the asset, payer doesn't", withAsset, nil},
+		{"neither has the asset", withoutAsset, nil},
+		{"payer has the asset, payee doesn't", withoutAsset, []*gochroma.ColorDefinition{known}},
+		{"payer has other decimals", withAsset, []*gochroma.ColorDefinition{known}},
+	}
+
+	for _, test := range tests {
+		// Execute
+		parsed, err := gochroma.ParsePaymentURI(test.r.URI(), &btcnet.TestNet3Params, test.known)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: failed to parse: %v", test.desc, err)
+			continue
+		}
+		if parsed.ColorValue != 1250 {
+			t.Errorf("%v: got color value %d, want 1250", test.desc, parsed.ColorValue)
+		}
+		if parsed.Definition.String() != test.r.Definition.String() {
+			t.Errorf("%v: got color %v, want %v", test.desc, parsed.Definition, test.r.Definition)
+		}
+	}
+}
+
+func TestParsePaymentURIError(t *testing.T) {
+	// Setup
+	r := tstPaymentRequest(t)
+	addr := r.Address.EncodeAddress()
+	color := "req-color=" + r.Definition.String()
+	known := []*gochroma.ColorDefinition{r.Definition}
+
+	tests := []struct {
+		desc string
+		uri  string
+		net  *btcnet.Params
+		err  int
+	}{
+		{"scheme", "litecoin:" + addr + "?" + color, &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"address", "bitcoin:1234?" + color, &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"network", "bitcoin:" + addr + "?" + color, &btcnet.MainNetParams, gochroma.ErrBadPaymentURI},
+		{"no color", "bitcoin:" + addr + "?amount=1", &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"bad color", "bitcoin:" + addr + "?req-color=EPOBC:1", &btcnet.TestNet3Params, gochroma.ErrBadColorDefinition},
+		{"unknown kernel", "bitcoin:" + addr + "?req-color=NOPE:1:0:0", &btcnet.TestNet3Params, gochroma.ErrNonExistentKernel},
+		{"required", "bitcoin:" + addr + "?" + color + "&req-other=1", &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"twice", "bitcoin:" + addr + "?" + color + "&label=a&label=b", &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"amount", "bitcoin:" + addr + "?" + color + "&amount=1.234&req-decimals=2", &btcnet.TestNet3Params, gochroma.ErrInvalidColorValue},
+		{"raw amount", "bitcoin:" + addr + "?" + color + "&amount=12.50", &btcnet.TestNet3Params, gochroma.ErrInvalidColorValue},
+		{"decimals", "bitcoin:" + addr + "?" + color + "&amount=1&req-decimals=two", &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"too many decimals", "bitcoin:" + addr + "?" + color + "&amount=1&req-decimals=30", &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"expiry", "bitcoin:" + addr + "?" + color + "&exp=soon", &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+		{"expiry before color", "bitcoin:" + addr + "?req-color=NOPE:1:0:0&exp=soon", &btcnet.TestNet3Params, gochroma.ErrBadPaymentURI},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := gochroma.ParsePaymentURI(test.uri, test.net, known)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
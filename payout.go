@@ -0,0 +1,356 @@
+package gochroma
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// MaxStandardTxSize is the biggest tx nodes relay.
+const MaxStandardTxSize = 100000
+
+// Payout is color value going to one recipient.
+type Payout struct {
+	// plain or colored address, see AddressPolicy
+	Address    string
+	ColorValue ColorValue
+}
+
+// BatchPayout pays color value of one color to many recipients, in as
+// many txs as it takes to keep each under the size limit.
+type BatchPayout struct {
+	Definition *ColorDefinition
+	Recipients []*Payout
+	// reads the addresses of the recipients, Plan fails without one
+	Addresses *AddressPolicy
+	// outputs that can be spent, colored or not, as for CoinRequest
+	Candidates []*Utxo
+	// scripts getting the color value and the satoshi left over
+	ColorChange []byte
+	Change      []byte
+	Fee         FeePolicy
+	Selector    CoinSelector
+	// biggest a signed tx can be, MaxStandardTxSize if 0. Inputs are
+	// taken to spend pay-to-pubkey-hash outputs.
+	MaxTxSize int
+}
+
+// PayoutTx is one tx of a payout plan and the recipients it pays.
+type PayoutTx struct {
+	Tx         *btcwire.MsgTx
+	Selection  *CoinSelection
+	Recipients []*Payout
+	// what the tx pays, more than the fee of the selection when dust
+	// change went to the fee
+	Fee int64
+}
+
+// PayoutPlan is the unsigned txs paying every recipient of a batch.
+type PayoutPlan struct {
+	Txs        []*PayoutTx
+	Fee        int64
+	ColorValue ColorValue
+}
+
+// Plan builds the txs of the payout without publishing them. Recipients
+// are paid in order, each tx taking as many as fit. The colored change
+// and change of each tx are candidates for the txs after it, so a single
+// colored output can pay any number of recipients, but the txs have to be
+// signed and published in order, see Signed.
+func (p *BatchPayout) Plan(b *BlockExplorer) (*PayoutPlan, error) {
+	if len(p.Recipients) == 0 {
+		return nil, MakeError(ErrInvalidTx, "no recipients to pay", nil)
+	}
+	if p.Addresses == nil {
+		str := "no address policy to read the addresses of the recipients"
+		return nil, MakeError(ErrBadColoredAddress, str, nil)
+	}
+	maxSize := p.MaxTxSize
+	if maxSize == 0 {
+		maxSize = MaxStandardTxSize
+	}
+	outputs := make([]*ColorOut, len(p.Recipients))
+	for i, payout := range p.Recipients {
+		var err error
+		outputs[i], err = p.Addresses.ColorOut(payout.Address, p.Definition, payout.ColorValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &PayoutPlan{}
+	candidates := p.Candidates
+	planned := &plannedTxs{
+		BlockReaderWriter: b.BlockReaderWriter,
+		txs:               make(map[btcwire.ShaHash]*btcwire.MsgTx),
+		spent:             make(map[btcwire.OutPoint]bool),
+	}
+	b = &BlockExplorer{planned}
+	for start := 0; start < len(outputs); {
+		n := len(outputs) - start
+		for {
+			r := &CoinRequest{
+				Candidates:  candidates,
+				Outputs:     outputs[start : start+n],
+				ColorChange: p.ColorChange,
+				Change:      p.Change,
+				Fee:         p.Fee,
+				Selector:    p.Selector,
+			}
+			tx, sel, err := r.TransferringTx(b, p.Definition)
+			if err != nil {
+				return nil, err
+			}
+			size := SignedTxSize(tx, nil)
+			if size > maxSize {
+				if n == 1 {
+					str := fmt.Sprintf("paying recipient %d takes a tx of %d bytes, limit is %d",
+						start, size, maxSize)
+					return nil, MakeError(ErrTooManyOutputs, str, nil)
+				}
+				// shrink in proportion, but at least by one
+				next := n * maxSize / size
+				if next >= n {
+					next = n - 1
+				}
+				if next < 1 {
+					next = 1
+				}
+				n = next
+				continue
+			}
+
+			fee, err := txFee(b, tx)
+			if err != nil {
+				return nil, err
+			}
+			plan.Txs = append(plan.Txs, &PayoutTx{
+				Tx:         tx,
+				Selection:  sel,
+				Recipients: p.Recipients[start : start+n],
+				Fee:        fee,
+			})
+			plan.Fee, err = AddSatoshi(plan.Fee, fee)
+			if err != nil {
+				return nil, err
+			}
+			for _, output := range outputs[start : start+n] {
+				plan.ColorValue, err = plan.ColorValue.Add(output.ColorValue)
+				if err != nil {
+					return nil, err
+				}
+			}
+			shaHash, err := planned.add(tx)
+			if err != nil {
+				return nil, err
+			}
+			candidates = unspentCandidates(candidates, tx)
+			candidates = append(candidates, p.changeCandidates(tx, shaHash, sel, n)...)
+			break
+		}
+		start += n
+	}
+	return plan, nil
+}
+
+// unspentCandidates returns the candidates the tx doesn't spend.
+func unspentCandidates(candidates []*Utxo, tx *btcwire.MsgTx) []*Utxo {
+	spent := make(map[btcwire.OutPoint]bool, len(tx.TxIn))
+	for _, txIn := range tx.TxIn {
+		spent[txIn.PreviousOutPoint] = true
+	}
+	var left []*Utxo
+	for _, utxo := range candidates {
+		if !spent[*utxo.OutPoint] {
+			left = append(left, utxo)
+		}
+	}
+	return left
+}
+
+// changeCandidates returns the colored change and change of the tx paying
+// n recipients, for the txs after it to spend.
+func (p *BatchPayout) changeCandidates(tx *btcwire.MsgTx, shaHash *btcwire.ShaHash, sel *CoinSelection, n int) []*Utxo {
+	var change []*Utxo
+	for i := n; i < len(tx.TxOut); i++ {
+		utxo := &Utxo{
+			OutPoint: btcwire.NewOutPoint(shaHash, uint32(i)),
+			PkScript: tx.TxOut[i].PkScript,
+			Value:    tx.TxOut[i].Value,
+		}
+		switch {
+		case i < len(sel.Outputs):
+			utxo.Definition = p.Definition
+			utxo.ColorValue = sel.Outputs[i].ColorValue
+		case !bytes.Equal(utxo.PkScript, p.Change):
+			continue
+		}
+		change = append(change, utxo)
+	}
+	return change
+}
+
+// Signed puts the signed tx in place of tx i of the plan and points the
+// later txs spending its outputs at it, as signing changes the hash they
+// were chained by. That changes the hashes of those txs in turn, so the
+// txs spending them follow as well. The signed tx has to spend and pay
+// what was planned.
+func (p *PayoutPlan) Signed(i int, signed *btcwire.MsgTx) error {
+	if i < 0 || i >= len(p.Txs) {
+		str := fmt.Sprintf("plan has no tx %d", i)
+		return MakeError(ErrInvalidTx, str, nil)
+	}
+	tx := p.Txs[i].Tx
+	if len(signed.TxIn) != len(tx.TxIn) || len(signed.TxOut) != len(tx.TxOut) {
+		str := fmt.Sprintf("tx %d of the plan has %d inputs and %d outputs, "+
+			"the signed one %d and %d", i, len(tx.TxIn), len(tx.TxOut),
+			len(signed.TxIn), len(signed.TxOut))
+		return MakeError(ErrInvalidTx, str, nil)
+	}
+	for j, txIn := range signed.TxIn {
+		if txIn.PreviousOutPoint != tx.TxIn[j].PreviousOutPoint {
+			str := fmt.Sprintf("input %d of the signed tx spends %v, not %v", j,
+				outPointString(&txIn.PreviousOutPoint),
+				outPointString(&tx.TxIn[j].PreviousOutPoint))
+			return MakeError(ErrInvalidTx, str, nil)
+		}
+	}
+	for j, txOut := range signed.TxOut {
+		if txOut.Value != tx.TxOut[j].Value ||
+			!bytes.Equal(txOut.PkScript, tx.TxOut[j].PkScript) {
+			str := fmt.Sprintf("output %d of the signed tx isn't the one planned", j)
+			return MakeError(ErrInvalidTx, str, nil)
+		}
+	}
+	oldHash, err := tx.TxSha()
+	if err != nil {
+		return MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	newHash, err := signed.TxSha()
+	if err != nil {
+		return MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	p.Txs[i].Tx = signed
+
+	// re-pointing a later tx changes its hash too, so what spends it has
+	// to follow
+	moved := map[btcwire.ShaHash]btcwire.ShaHash{oldHash: newHash}
+	for _, later := range p.Txs[i+1:] {
+		laterOld, err := later.Tx.TxSha()
+		if err != nil {
+			return MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+		}
+		for _, txIn := range later.Tx.TxIn {
+			hash, ok := moved[txIn.PreviousOutPoint.Hash]
+			if ok {
+				txIn.PreviousOutPoint.Hash = hash
+			}
+		}
+		for _, colorIn := range later.Selection.ColorIns {
+			hash, ok := moved[colorIn.OutPoint.Hash]
+			if ok {
+				colorIn.OutPoint = btcwire.NewOutPoint(&hash, colorIn.OutPoint.Index)
+			}
+		}
+		for j, funding := range later.Selection.Funding {
+			hash, ok := moved[funding.Hash]
+			if ok {
+				later.Selection.Funding[j] = btcwire.NewOutPoint(&hash, funding.Index)
+			}
+		}
+		laterNew, err := later.Tx.TxSha()
+		if err != nil {
+			return MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+		}
+		if laterNew != laterOld {
+			moved[laterOld] = laterNew
+		}
+	}
+	return nil
+}
+
+// plannedTxs puts the txs of a plan in front of the explorer as if they
+// were in the mempool, so that later txs of the plan can spend their
+// outputs.
+type plannedTxs struct {
+	BlockReaderWriter
+	txs map[btcwire.ShaHash]*btcwire.MsgTx
+	// big-endian hashes of the txs, in order
+	hashes [][]byte
+	spent  map[btcwire.OutPoint]bool
+}
+
+func (p *plannedTxs) add(tx *btcwire.MsgTx) (*btcwire.ShaHash, error) {
+	shaHash, err := tx.TxSha()
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	p.txs[shaHash] = tx
+	p.hashes = append(p.hashes, BigEndianBytes(&shaHash))
+	for _, txIn := range tx.TxIn {
+		p.spent[txIn.PreviousOutPoint] = true
+	}
+	return &shaHash, nil
+}
+
+// find returns the planned tx with the big-endian hash, or nil.
+func (p *plannedTxs) find(hash []byte) (*btcwire.ShaHash, *btcwire.MsgTx) {
+	shaHash, err := NewShaHash(hash)
+	if err != nil {
+		return nil, nil
+	}
+	return shaHash, p.txs[*shaHash]
+}
+
+func (p *plannedTxs) RawTx(hash []byte) ([]byte, error) {
+	_, tx := p.find(hash)
+	if tx == nil {
+		return p.BlockReaderWriter.RawTx(hash)
+	}
+	var buffer bytes.Buffer
+	err := tx.Serialize(&buffer)
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "unable to serialize", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func (p *plannedTxs) MempoolTxs() ([][]byte, error) {
+	hashes, err := p.BlockReaderWriter.MempoolTxs()
+	if err != nil {
+		return nil, err
+	}
+	return append(hashes, p.hashes...), nil
+}
+
+func (p *plannedTxs) TxBlockHash(txHash []byte) ([]byte, error) {
+	shaHash, tx := p.find(txHash)
+	if tx != nil {
+		str := fmt.Sprintf("tx %v is only planned", shaHash)
+		return nil, MakeError(ErrBlockRead, str, nil)
+	}
+	return p.BlockReaderWriter.TxBlockHash(txHash)
+}
+
+// TxOutSpent counts the outputs the planned txs spend as spent when the
+// mempool is, and the outputs of the planned txs as unconfirmed.
+func (p *plannedTxs) TxOutSpent(txHash []byte, index uint32, mempool bool) (*bool, error) {
+	shaHash, tx := p.find(txHash)
+	spent := true
+	switch {
+	case mempool && shaHash != nil && p.spent[*btcwire.NewOutPoint(shaHash, index)]:
+	case tx == nil:
+		return p.BlockReaderWriter.TxOutSpent(txHash, index, mempool)
+	case !mempool:
+	// like btcd, outputs that don't exist are spent
+	case int(index) >= len(tx.TxOut):
+	default:
+		spent = false
+	}
+	return &spent, nil
+}
+
+func (p *plannedTxs) PublishRawTx(rawTx []byte) ([]byte, error) {
+	return nil, MakeError(ErrBlockWrite, "planned txs can't be published", nil)
+}
@@ -0,0 +1,321 @@
+package gochroma_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+// tstBatchPayout sets up paying 30 color value to each of the number of
+// recipients out of colored outputs of the color values given and three
+// plain ones
+func tstBatchPayout(t *testing.T, recipients int, colored ...gochroma.ColorValue) (*kerneltest.MemChain, *gochroma.BatchPayout) {
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	issuing := chain.Fund(100000, tstScript(0))
+	var candidates []*gochroma.Utxo
+	for i := 0; i < 3; i++ {
+		funding := chain.Fund(100000, tstScript(0))
+		candidates = append(candidates, &gochroma.Utxo{
+			OutPoint: funding,
+			PkScript: tstScript(0),
+			Value:    100000,
+		})
+	}
+	chain.Mine()
+	outputs := make([]*gochroma.ColorOut, len(colored))
+	for i, cv := range colored {
+		outputs[i] = &gochroma.ColorOut{tstScript(1), cv}
+	}
+	tx, err := epobc.IssuingTx(b, []*btcwire.OutPoint{issuing}, outputs, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make issuing tx: %v", err)
+	}
+	shaHash := tstPublish(t, chain, tx)
+	height, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(shaHash, 0), height)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	for i := range outputs {
+		candidates = append(candidates, &gochroma.Utxo{
+			OutPoint:   btcwire.NewOutPoint(shaHash, uint32(i)),
+			PkScript:   tstScript(1),
+			Value:      tx.TxOut[i].Value,
+			Definition: cd,
+			ColorValue: colored[i],
+		})
+	}
+
+	p := &gochroma.BatchPayout{
+		Definition:  cd,
+		Addresses:   &gochroma.AddressPolicy{Net: &btcnet.TestNet3Params},
+		Candidates:  candidates,
+		ColorChange: tstScript(1),
+		Change:      tstScript(0),
+		Fee:         gochroma.FlatFee(1000),
+		Selector:    gochroma.LargestFirst{},
+	}
+	for i := 0; i < recipients; i++ {
+		addr, err := btcutil.NewAddressPubKeyHash(
+			btcutil.Hash160(tstWIF(t, byte(i+1)).SerializePubKey()), &btcnet.TestNet3Params)
+		if err != nil {
+			t.Fatalf("failed to make address: %v", err)
+		}
+		p.Recipients = append(p.Recipients, &gochroma.Payout{addr.EncodeAddress(), 30})
+	}
+	return chain, p
+}
+
+func TestBatchPayoutPlan(t *testing.T) {
+	// Setup
+	chain, p := tstBatchPayout(t, 10, 200, 200, 200)
+	b := chain.NewBlockExplorer()
+	// room for a colored and a plain input and six outputs
+	p.MaxTxSize = 10 + 2*149 + 6*34
+
+	// Execute
+	plan, err := p.Plan(b)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	want := []int{4, 4, 2}
+	if len(plan.Txs) != len(want) {
+		t.Fatalf("got %d txs, want %d", len(plan.Txs), len(want))
+	}
+	if plan.ColorValue != 300 {
+		t.Errorf("plan pays %d color value, want 300", plan.ColorValue)
+	}
+	fee := int64(0)
+	spent := make(map[btcwire.OutPoint]bool)
+	for i, payoutTx := range plan.Txs {
+		if len(payoutTx.Recipients) != want[i] {
+			t.Errorf("tx %d pays %d recipients, want %d", i, len(payoutTx.Recipients), want[i])
+		}
+		size := gochroma.SignedTxSize(payoutTx.Tx, nil)
+		if size > p.MaxTxSize {
+			t.Errorf("tx %d is %d bytes, limit is %d", i, size, p.MaxTxSize)
+		}
+		for _, txIn := range payoutTx.Tx.TxIn {
+			if spent[txIn.PreviousOutPoint] {
+				t.Errorf("tx %d spends %v again", i, txIn.PreviousOutPoint)
+			}
+			spent[txIn.PreviousOutPoint] = true
+		}
+		report, err := gochroma.ValidateColorTx(b, []*gochroma.ColorDefinition{p.Definition}, payoutTx.Tx, gochroma.DefaultDustPolicy)
+		if err != nil {
+			t.Fatalf("failed to validate: %v", err)
+		}
+		if !report.OK() {
+			t.Errorf("tx %d is invalid: %v", i, report.Err())
+		}
+		fee += payoutTx.Fee
+		// the next tx may spend the change of this one
+		tstPublish(t, chain, payoutTx.Tx)
+	}
+	if plan.Fee != fee || fee < 3000 {
+		t.Errorf("plan fee is %d, txs pay %d", plan.Fee, fee)
+	}
+}
+
+func TestBatchPayoutPlanChained(t *testing.T) {
+	// Setup
+	chain, p := tstBatchPayout(t, 10, 1000)
+	b := chain.NewBlockExplorer()
+	// room for a colored and a plain input and four outputs
+	p.MaxTxSize = 10 + 2*149 + 4*34
+
+	// Execute
+	plan, err := p.Plan(b)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if len(plan.Txs) < 2 {
+		t.Fatalf("got %d txs, want more than one", len(plan.Txs))
+	}
+	if plan.ColorValue != 300 {
+		t.Errorf("plan pays %d color value, want 300", plan.ColorValue)
+	}
+	paid := 0
+	for i, payoutTx := range plan.Txs {
+		paid += len(payoutTx.Recipients)
+		if i > 0 {
+			// the only colored output is spent by the first tx, so every
+			// later one spends the colored change of the one before
+			prev, err := plan.Txs[i-1].Tx.TxSha()
+			if err != nil {
+				t.Fatalf("failed to hash: %v", err)
+			}
+			colorChange := btcwire.NewOutPoint(&prev, uint32(len(plan.Txs[i-1].Recipients)))
+			if payoutTx.Tx.TxIn[0].PreviousOutPoint != *colorChange {
+				t.Errorf("tx %d spends %v first, want %v", i,
+					payoutTx.Tx.TxIn[0].PreviousOutPoint, colorChange)
+			}
+		}
+		report, err := gochroma.ValidateColorTx(b, []*gochroma.ColorDefinition{p.Definition}, payoutTx.Tx, gochroma.DefaultDustPolicy)
+		if err != nil {
+			t.Fatalf("failed to validate: %v", err)
+		}
+		if !report.OK() {
+			t.Errorf("tx %d is invalid: %v", i, report.Err())
+		}
+		tstPublish(t, chain, payoutTx.Tx)
+	}
+	if paid != 10 {
+		t.Errorf("plan pays %d recipients, want 10", paid)
+	}
+}
+
+func TestPayoutPlanSigned(t *testing.T) {
+	// Setup
+	chain, p := tstBatchPayout(t, 10, 1000)
+	p.MaxTxSize = 10 + 2*149 + 4*34
+	plan, err := p.Plan(chain.NewBlockExplorer())
+	if err != nil {
+		t.Fatalf("failed to plan: %v", err)
+	}
+	if len(plan.Txs) < 3 {
+		t.Fatalf("got %d txs, want at least 3", len(plan.Txs))
+	}
+
+	for i := range plan.Txs {
+		// Execute
+		signed := plan.Txs[i].Tx.Copy()
+		signed.TxIn[0].SignatureScript = []byte{0x51}
+		err := plan.Signed(i, signed)
+
+		// Verify
+		if err != nil {
+			t.Fatalf("failed to put signed tx %d in the plan: %v", i, err)
+		}
+		if plan.Txs[i].Tx != signed {
+			t.Errorf("plan still has unsigned tx %d", i)
+		}
+		if i == len(plan.Txs)-1 {
+			break
+		}
+		shaHash, err := signed.TxSha()
+		if err != nil {
+			t.Fatalf("failed to hash: %v", err)
+		}
+		next := plan.Txs[i+1]
+		if !next.Tx.TxIn[0].PreviousOutPoint.Hash.IsEqual(&shaHash) {
+			t.Errorf("tx %d spends %v, want %v", i+1, next.Tx.TxIn[0].PreviousOutPoint, shaHash)
+		}
+		if !next.Selection.ColorIns[0].OutPoint.Hash.IsEqual(&shaHash) {
+			t.Errorf("selection of tx %d spends %v, want %v", i+1,
+				next.Selection.ColorIns[0].OutPoint, shaHash)
+		}
+	}
+	// the whole chain goes out in order
+	for i, payoutTx := range plan.Txs {
+		_, err := chain.NewBlockExplorer().PublishTx(payoutTx.Tx)
+		if err != nil {
+			t.Errorf("failed to publish tx %d: %v", i, err)
+		}
+	}
+}
+
+func TestPayoutPlanSignedError(t *testing.T) {
+	tests := []struct {
+		desc   string
+		index  int
+		tamper func(tx *btcwire.MsgTx)
+	}{
+		{"no such tx", 10, func(tx *btcwire.MsgTx) {}},
+		{"input", 0, func(tx *btcwire.MsgTx) {
+			tx.TxIn[0].PreviousOutPoint.Index++
+		}},
+		{"output value", 0, func(tx *btcwire.MsgTx) {
+			tx.TxOut[0].Value--
+		}},
+		{"output script", 0, func(tx *btcwire.MsgTx) {
+			tx.TxOut[0].PkScript = tstScript(9)
+		}},
+		{"extra output", 0, func(tx *btcwire.MsgTx) {
+			tx.AddTxOut(btcwire.NewTxOut(1000, tstScript(9)))
+		}},
+	}
+
+	for _, test := range tests {
+		// Setup
+		chain, p := tstBatchPayout(t, 10, 1000)
+		p.MaxTxSize = 10 + 2*149 + 4*34
+		plan, err := p.Plan(chain.NewBlockExplorer())
+		if err != nil {
+			t.Fatalf("%v: failed to plan: %v", test.desc, err)
+		}
+		signed := plan.Txs[0].Tx.Copy()
+		test.tamper(signed)
+
+		// Execute
+		err = plan.Signed(test.index, signed)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(gochroma.ErrInvalidTx)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
+
+func TestBatchPayoutPlanError(t *testing.T) {
+	tests := []struct {
+		desc       string
+		recipients int
+		setup      func(p *gochroma.BatchPayout)
+		err        int
+	}{
+		{"too small", 2, func(p *gochroma.BatchPayout) {
+			p.MaxTxSize = 100
+		}, gochroma.ErrTooManyOutputs},
+		{"plain address", 2, func(p *gochroma.BatchPayout) {
+			p.Addresses.RequireColored = true
+		}, gochroma.ErrPlainAddress},
+		{"too much color value", 21, func(p *gochroma.BatchPayout) {}, gochroma.ErrInsufficientColorValue},
+		{"no recipients", 0, func(p *gochroma.BatchPayout) {}, gochroma.ErrInvalidTx},
+		{"no address policy", 2, func(p *gochroma.BatchPayout) {
+			p.Addresses = nil
+		}, gochroma.ErrBadColoredAddress},
+	}
+
+	for _, test := range tests {
+		// Setup
+		chain, p := tstBatchPayout(t, test.recipients, 200, 200, 200)
+		test.setup(p)
+
+		// Execute
+		_, err := p.Plan(chain.NewBlockExplorer())
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		want := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != want {
+			t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+		}
+	}
+}
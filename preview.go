@@ -0,0 +1,130 @@
+package gochroma
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+)
+
+// PreviewColor is the color value of one color in an input or output.
+type PreviewColor struct {
+	Definition *ColorDefinition
+	ColorValue ColorValue
+}
+
+// PreviewIO is an input or output of a previewed tx.
+type PreviewIO struct {
+	Index   int
+	Satoshi int64
+	Script  []byte
+	// colors with color value here, in the order of the definitions
+	Colors []*PreviewColor
+}
+
+// TxPreview is what a tx would do to the colors of the definitions if it
+// were published.
+type TxPreview struct {
+	Inputs  []*PreviewIO
+	Outputs []*PreviewIO
+	// flows of the colors the tx moves, in the order of the definitions
+	Flows []*ColorFlow
+	Fee   int64
+}
+
+// PreviewTx traces the color value of every input of the tx through the
+// explorer and runs the kernel of each definition over the tx, without
+// publishing or even signing it. Colors the tx doesn't move are left out.
+func PreviewTx(b *BlockExplorer, defs []*ColorDefinition, tx *btcwire.MsgTx) (*TxPreview, error) {
+	if len(tx.TxIn) == 0 {
+		return nil, MakeError(ErrInvalidTx, "transaction has no inputs", nil)
+	}
+	p := &TxPreview{}
+	inSatoshi := int64(0)
+	for i, txIn := range tx.TxIn {
+		txOut, err := b.OutPointTxOut(&txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		inSatoshi, err = AddSatoshi(inSatoshi, txOut.Value)
+		if err != nil {
+			return nil, err
+		}
+		p.Inputs = append(p.Inputs, &PreviewIO{
+			Index:   i,
+			Satoshi: txOut.Value,
+			Script:  txOut.PkScript,
+		})
+	}
+	outSatoshi := int64(0)
+	for i, txOut := range tx.TxOut {
+		var err error
+		outSatoshi, err = AddSatoshi(outSatoshi, txOut.Value)
+		if err != nil {
+			return nil, err
+		}
+		p.Outputs = append(p.Outputs, &PreviewIO{
+			Index:   i,
+			Satoshi: txOut.Value,
+			Script:  txOut.PkScript,
+		})
+	}
+	p.Fee = inSatoshi - outSatoshi
+
+	for _, cd := range defs {
+		flow, err := colorFlow(b, cd, tx)
+		if err != nil {
+			return nil, err
+		}
+		if flow.In == 0 && flow.Out == 0 {
+			continue
+		}
+		p.Flows = append(p.Flows, flow)
+		for i, cv := range flow.Inputs {
+			if cv > 0 {
+				p.Inputs[i].Colors = append(p.Inputs[i].Colors, &PreviewColor{cd, cv})
+			}
+		}
+		for i, cv := range flow.Outputs {
+			if cv > 0 {
+				p.Outputs[i].Colors = append(p.Outputs[i].Colors, &PreviewColor{cd, cv})
+			}
+		}
+	}
+	return p, nil
+}
+
+// String shows the colors and satoshi of the input or output, like
+// "30 GLD, 0.0000613 BTC".
+func (io *PreviewIO) String() string {
+	strs := make([]string, 0, len(io.Colors)+1)
+	for _, color := range io.Colors {
+		strs = append(strs, color.Definition.FormatColorValue(color.ColorValue))
+	}
+	strs = append(strs, btcutil.Amount(io.Satoshi).String())
+	return strings.Join(strs, ", ")
+}
+
+// String shows the preview for people, a line for every input and
+// output and one for the fee, along with any color value the tx
+// destroys.
+func (p *TxPreview) String() string {
+	var buf bytes.Buffer
+	for _, in := range p.Inputs {
+		fmt.Fprintf(&buf, "input %d: %v\n", in.Index, in)
+	}
+	for _, out := range p.Outputs {
+		fmt.Fprintf(&buf, "output %d: %v\n", out.Index, out)
+	}
+	fmt.Fprintf(&buf, "fee: %v\n", btcutil.Amount(p.Fee))
+	for _, flow := range p.Flows {
+		if flow.Issuance || flow.Out >= flow.In {
+			continue
+		}
+		fmt.Fprintf(&buf, "destroyed: %v of %v\n",
+			flow.Definition.FormatColorValue(flow.In-flow.Out), flow.Definition)
+	}
+	return buf.String()
+}
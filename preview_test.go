@@ -0,0 +1,100 @@
+package gochroma_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestPreviewTx(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	cd.Asset = &gochroma.Asset{Ticker: "GLD"}
+	other := tstIssue(t, chain, epobc, 100)
+	funding := btcwire.NewOutPoint(&cd.Genesis.Hash, 1)
+	group := &gochroma.ColorGroup{
+		Definition: cd,
+		Inputs:     []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}},
+		Outputs: []*gochroma.ColorOut{
+			&gochroma.ColorOut{tstScript(2), 60},
+			&gochroma.ColorOut{tstScript(3), 40},
+		},
+	}
+	tx, err := epobc.(gochroma.MultiColorKernel).MultiColorTx(b,
+		[]*gochroma.ColorGroup{group}, []*btcwire.OutPoint{funding}, tstScript(0), 10000)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+
+	// Execute
+	p, err := gochroma.PreviewTx(b, []*gochroma.ColorDefinition{cd, other}, tx)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to preview: %v", err)
+	}
+	if len(p.Flows) != 1 || p.Flows[0].Definition != cd {
+		t.Errorf("got %d flows, want only that of the color moved", len(p.Flows))
+	}
+	if p.Fee != 10000 {
+		t.Errorf("got fee %d, want 10000", p.Fee)
+	}
+	lines := strings.Split(p.String(), "\n")
+	want := []string{
+		fmt.Sprintf("input 0: 100 GLD, %v", btcutil.Amount(p.Inputs[0].Satoshi)),
+		fmt.Sprintf("input 1: %v", btcutil.Amount(p.Inputs[1].Satoshi)),
+		fmt.Sprintf("output 0: 60 GLD, %v", btcutil.Amount(tx.TxOut[0].Value)),
+		fmt.Sprintf("output 1: 40 GLD, %v", btcutil.Amount(tx.TxOut[1].Value)),
+		fmt.Sprintf("output 2: %v", btcutil.Amount(tx.TxOut[2].Value)),
+		"fee: 0.0001 BTC",
+		"",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%v", len(lines), len(want), p)
+	}
+	for i, line := range lines {
+		if line != want[i] {
+			t.Errorf("line %d: got %q, want %q", i, line, want[i])
+		}
+	}
+}
+
+func TestPreviewTxDestroy(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 60}}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, true)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+
+	// Execute
+	p, err := gochroma.PreviewTx(b, []*gochroma.ColorDefinition{cd}, tx)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to preview: %v", err)
+	}
+	want := fmt.Sprintf("destroyed: 40 of %v\n", cd)
+	if !strings.HasSuffix(p.String(), want) {
+		t.Errorf("preview doesn't end with %q:\n%v", want, p)
+	}
+}
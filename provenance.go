@@ -0,0 +1,301 @@
+package gochroma
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// ProvenanceTx is a transaction the color value passed through on its
+// way from the genesis to the outpoint.
+type ProvenanceTx struct {
+	Hash btcwire.ShaHash
+	// whether the tx issues the color, as the genesis or a later issuance
+	Genesis bool
+	// color values of the inputs, where inputs the kernel didn't find
+	// affecting the traced outputs count as uncolored
+	InColorValues []ColorValue
+	// color values of every output as calculated by the kernel from
+	// InColorValues. Only the traced outputs are sure to be right, the
+	// others are a lower bound: inputs left untraced count as uncolored
+	// even when they bring color value to them.
+	OutColorValues []ColorValue
+}
+
+// ProvenanceHop is color value moving from an output of one transaction
+// to an input of another.
+type ProvenanceHop struct {
+	From       btcwire.OutPoint
+	To         btcwire.ShaHash
+	ColorValue ColorValue
+}
+
+// Provenance is the DAG of transactions that a colored outpoint descends
+// from, as walked by the kernel of the color definition.
+type Provenance struct {
+	Definition *ColorDefinition
+	OutPoint   btcwire.OutPoint
+	ColorValue ColorValue
+	// every tx comes after the txs it spends from, so the genesis is first
+	Txs  []*ProvenanceTx
+	Hops []*ProvenanceHop
+}
+
+// provenanceWalk keeps the state of walking back from an outpoint.
+type provenanceWalk struct {
+	cd            *ColorDefinition
+	b             *BlockExplorer
+	genesisHeight int64
+	txs           map[btcwire.ShaHash]*btcwire.MsgTx
+	traced        map[btcwire.OutPoint]bool
+	// outpoints that each tx spends which affect the traced outputs
+	affecting map[btcwire.ShaHash]map[btcwire.OutPoint]bool
+	order     []btcwire.ShaHash
+	// txs in the mempool, looked up the first time a tx isn't in a block
+	mempool map[btcwire.ShaHash]bool
+}
+
+// Provenance walks back from the outpoint to the genesis with
+// FindAffectingInputs and then calculates the color value of every hop
+// with RunKernelOnChain. Unlike ColorValue, the outpoint and the
+// ones it descends from may already be spent. Txs still in the mempool
+// are walked like any other, as they come after the genesis.
+func (c *ColorDefinition) Provenance(b *BlockExplorer, outPoint *btcwire.OutPoint) (*Provenance, error) {
+	genesisHeight, err := b.OutPointHeight(c.Genesis)
+	if err != nil {
+		return nil, err
+	}
+	w := &provenanceWalk{
+		cd:            c,
+		b:             b,
+		genesisHeight: genesisHeight,
+		txs:           make(map[btcwire.ShaHash]*btcwire.MsgTx),
+		traced:        make(map[btcwire.OutPoint]bool),
+		affecting:     make(map[btcwire.ShaHash]map[btcwire.OutPoint]bool),
+	}
+	err = w.trace(outPoint)
+	if err != nil {
+		return nil, err
+	}
+	return w.provenance(outPoint)
+}
+
+// trace walks back from the outpoint, recording every tx on the way.
+func (w *provenanceWalk) trace(outPoint *btcwire.OutPoint) error {
+	if w.traced[*outPoint] {
+		return nil
+	}
+	w.traced[*outPoint] = true
+
+	// a coinbase doesn't spend anything
+	var zeroHash btcwire.ShaHash
+	if outPoint.Hash.IsEqual(&zeroHash) {
+		return nil
+	}
+
+	if !outPoint.Hash.IsEqual(&w.cd.Genesis.Hash) {
+		height, err := w.b.OutPointHeight(outPoint)
+		if err != nil {
+			inMempool, mempoolErr := w.inMempool(&outPoint.Hash)
+			if mempoolErr != nil || !inMempool {
+				return err
+			}
+		} else if height < w.genesisHeight {
+			return nil
+		}
+	}
+
+	tx, ok := w.txs[outPoint.Hash]
+	if !ok {
+		utilTx, err := w.b.OutPointTx(outPoint)
+		if err != nil {
+			return err
+		}
+		tx = utilTx.MsgTx()
+		w.txs[outPoint.Hash] = tx
+		w.affecting[outPoint.Hash] = make(map[btcwire.OutPoint]bool)
+	}
+	if int(outPoint.Index) >= len(tx.TxOut) {
+		str := fmt.Sprintf("tx %v has no output %d", outPoint.Hash, outPoint.Index)
+		return MakeError(ErrBadOutputIndex, str, nil)
+	}
+	inputs, err := w.cd.AffectingInputs(w.b, tx, []int{int(outPoint.Index)})
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		w.affecting[outPoint.Hash][*input] = true
+		err = w.trace(input)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inMempool returns whether the tx is waiting in the mempool.
+func (w *provenanceWalk) inMempool(shaHash *btcwire.ShaHash) (bool, error) {
+	if w.mempool == nil {
+		hashes, err := w.b.MempoolTxs()
+		if err != nil {
+			return false, err
+		}
+		w.mempool = make(map[btcwire.ShaHash]bool, len(hashes))
+		for _, hash := range hashes {
+			mempoolHash, err := NewShaHash(hash)
+			if err != nil {
+				return false, err
+			}
+			w.mempool[*mempoolHash] = true
+		}
+	}
+	return w.mempool[*shaHash], nil
+}
+
+// sort puts the tx after every tx it spends from into the order.
+func (w *provenanceWalk) sort(shaHash btcwire.ShaHash, done map[btcwire.ShaHash]bool) {
+	if done[shaHash] {
+		return
+	}
+	done[shaHash] = true
+	for _, txIn := range w.txs[shaHash].TxIn {
+		prev := txIn.PreviousOutPoint
+		_, ok := w.txs[prev.Hash]
+		if ok && w.affecting[shaHash][prev] {
+			w.sort(prev.Hash, done)
+		}
+	}
+	w.order = append(w.order, shaHash)
+}
+
+// provenance runs the kernel forward over the txs that were traced.
+func (w *provenanceWalk) provenance(outPoint *btcwire.OutPoint) (*Provenance, error) {
+	p := &Provenance{
+		Definition: w.cd,
+		OutPoint:   *outPoint,
+	}
+	_, ok := w.txs[outPoint.Hash]
+	if !ok {
+		// we never got to the tx, so it isn't colored
+		return p, nil
+	}
+	w.sort(outPoint.Hash, make(map[btcwire.ShaHash]bool))
+
+	outValues := make(map[btcwire.ShaHash][]ColorValue, len(w.order))
+	for _, shaHash := range w.order {
+		tx := w.txs[shaHash]
+		inValues := make([]ColorValue, len(tx.TxIn))
+		for i, txIn := range tx.TxIn {
+			prev := txIn.PreviousOutPoint
+			if !w.affecting[shaHash][prev] {
+				continue
+			}
+			prevValues, ok := outValues[prev.Hash]
+			if !ok {
+				continue
+			}
+			inValues[i] = prevValues[prev.Index]
+			p.Hops = append(p.Hops, &ProvenanceHop{
+				From:       prev,
+				To:         shaHash,
+				ColorValue: inValues[i],
+			})
+		}
+		values, err := w.cd.RunKernelOnChain(w.b, tx, inValues)
+		if err != nil {
+			return nil, err
+		}
+		genesis, err := w.cd.IsIssuance(w.b, tx)
+		if err != nil {
+			return nil, err
+		}
+		outValues[shaHash] = values
+		p.Txs = append(p.Txs, &ProvenanceTx{
+			Hash:           shaHash,
+			Genesis:        genesis,
+			InColorValues:  inValues,
+			OutColorValues: values,
+		})
+	}
+	p.ColorValue = outValues[outPoint.Hash][outPoint.Index]
+	return p, nil
+}
+
+func outPointString(outPoint *btcwire.OutPoint) string {
+	return fmt.Sprintf("%v:%d", outPoint.Hash, outPoint.Index)
+}
+
+// MarshalJSON encodes the provenance with hashes as hex strings and
+// outpoints as txhash:index.
+func (p *Provenance) MarshalJSON() ([]byte, error) {
+	type jsonTx struct {
+		Hash           string       `json:"hash"`
+		Genesis        bool         `json:"genesis"`
+		InColorValues  []ColorValue `json:"inColorValues"`
+		OutColorValues []ColorValue `json:"outColorValues"`
+	}
+	type jsonHop struct {
+		From       string     `json:"from"`
+		To         string     `json:"to"`
+		ColorValue ColorValue `json:"colorValue"`
+	}
+	txs := make([]jsonTx, len(p.Txs))
+	for i, tx := range p.Txs {
+		txs[i] = jsonTx{
+			Hash:           tx.Hash.String(),
+			Genesis:        tx.Genesis,
+			InColorValues:  tx.InColorValues,
+			OutColorValues: tx.OutColorValues,
+		}
+	}
+	hops := make([]jsonHop, len(p.Hops))
+	for i, hop := range p.Hops {
+		hops[i] = jsonHop{
+			From:       outPointString(&hop.From),
+			To:         hop.To.String(),
+			ColorValue: hop.ColorValue,
+		}
+	}
+	return json.Marshal(struct {
+		Definition string     `json:"definition"`
+		Asset      *Asset     `json:"asset,omitempty"`
+		OutPoint   string     `json:"outPoint"`
+		ColorValue ColorValue `json:"colorValue"`
+		Txs        []jsonTx   `json:"txs"`
+		Hops       []jsonHop  `json:"hops"`
+	}{
+		Definition: p.Definition.String(),
+		Asset:      p.Definition.Asset,
+		OutPoint:   outPointString(&p.OutPoint),
+		ColorValue: p.ColorValue,
+		Txs:        txs,
+		Hops:       hops,
+	})
+}
+
+// DOT returns the provenance as a Graphviz digraph with a node for every
+// tx, an edge for every hop and an edge to the outpoint itself.
+func (p *Provenance) DOT() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph provenance {\n")
+	fmt.Fprintf(&buf, "\tlabel=%q;\n", p.Definition.String())
+	for _, tx := range p.Txs {
+		shape := "box"
+		if tx.Genesis {
+			shape = "doubleoctagon"
+		}
+		fmt.Fprintf(&buf, "\t%q [shape=%v];\n", tx.Hash.String(), shape)
+	}
+	for _, hop := range p.Hops {
+		fmt.Fprintf(&buf, "\t%q -> %q [label=\"%d:%d\"];\n",
+			hop.From.Hash.String(), hop.To.String(), hop.From.Index, hop.ColorValue)
+	}
+	target := outPointString(&p.OutPoint)
+	fmt.Fprintf(&buf, "\t%q [shape=ellipse];\n", target)
+	fmt.Fprintf(&buf, "\t%q -> %q [label=\"%d:%d\"];\n",
+		p.OutPoint.Hash.String(), target, p.OutPoint.Index, p.ColorValue)
+	fmt.Fprintf(&buf, "}\n")
+	return buf.String()
+}
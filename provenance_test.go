@@ -0,0 +1,232 @@
+package gochroma_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestProvenance(t *testing.T) {
+	// Setup
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	cd := tstIssue(t, chain, spobc, 1)
+	hop1 := tstTransfer(t, chain, cd, cd.Genesis, 1)
+	hop2 := tstTransfer(t, chain, cd, hop1, 1)
+	b := chain.NewBlockExplorer()
+
+	// Execute
+	p, err := cd.Provenance(b, hop2)
+	if err != nil {
+		t.Fatalf("failed to get provenance: %v", err)
+	}
+
+	// Verify
+	if p.ColorValue != 1 {
+		t.Fatalf("wrong color value: got %d, want 1", p.ColorValue)
+	}
+	wantTxs := []*btcwire.ShaHash{&cd.Genesis.Hash, &hop1.Hash, &hop2.Hash}
+	if len(p.Txs) != len(wantTxs) {
+		t.Fatalf("wrong number of txs: got %d, want %d", len(p.Txs), len(wantTxs))
+	}
+	for i, want := range wantTxs {
+		if !p.Txs[i].Hash.IsEqual(want) {
+			t.Fatalf("wrong tx at %d: got %v, want %v", i, p.Txs[i].Hash, want)
+		}
+		if p.Txs[i].Genesis != (i == 0) {
+			t.Fatalf("wrong genesis flag at %d: got %v", i, p.Txs[i].Genesis)
+		}
+		if p.Txs[i].OutColorValues[0] != 1 {
+			t.Fatalf("wrong color value at %d: got %d, want 1", i, p.Txs[i].OutColorValues[0])
+		}
+	}
+	wantHops := []*btcwire.OutPoint{cd.Genesis, hop1}
+	if len(p.Hops) != len(wantHops) {
+		t.Fatalf("wrong number of hops: got %d, want %d", len(p.Hops), len(wantHops))
+	}
+	for i, want := range wantHops {
+		if p.Hops[i].From != *want || p.Hops[i].ColorValue != 1 {
+			t.Fatalf("wrong hop at %d: got %v", i, p.Hops[i])
+		}
+	}
+
+	// the spent outpoints along the way have no color value now
+	cv, err := cd.ColorValue(b, hop1)
+	if err != nil {
+		t.Fatalf("failed to get color value: %v", err)
+	}
+	if *cv != 0 {
+		t.Fatalf("spent outpoint has color value %d", *cv)
+	}
+}
+
+func TestProvenanceUntracedInputs(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+	genesis, err := epobc.IssuingTx(b, []*btcwire.OutPoint{funding},
+		[]*gochroma.ColorOut{
+			&gochroma.ColorOut{tstScript(1), 8000},
+			&gochroma.ColorOut{tstScript(1), 12000},
+		}, tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make issuing tx: %v", err)
+	}
+	genesisHash := tstPublish(t, chain, genesis)
+	cd, err := gochroma.NewColorDefinition(epobc, btcwire.NewOutPoint(genesisHash, 0), 0)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	// each output takes the color value of the input in the same place
+	inputs := []*gochroma.ColorIn{
+		&gochroma.ColorIn{btcwire.NewOutPoint(genesisHash, 0), 8000},
+		&gochroma.ColorIn{btcwire.NewOutPoint(genesisHash, 1), 12000},
+	}
+	outputs := []*gochroma.ColorOut{
+		&gochroma.ColorOut{tstScript(3), 8000},
+		&gochroma.ColorOut{tstScript(3), 12000},
+	}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, false)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	shaHash := tstPublish(t, chain, tx)
+
+	// Execute
+	p, err := cd.Provenance(b, btcwire.NewOutPoint(shaHash, 0))
+	if err != nil {
+		t.Fatalf("failed to get provenance: %v", err)
+	}
+
+	// Verify
+	if p.ColorValue != 8000 {
+		t.Fatalf("wrong color value: got %d, want 8000", p.ColorValue)
+	}
+	last := p.Txs[len(p.Txs)-1]
+	if !last.Hash.IsEqual(shaHash) {
+		t.Fatalf("wrong last tx: got %v, want %v", last.Hash, shaHash)
+	}
+	// input 1 doesn't affect output 0, so it isn't traced and output 1
+	// gets none of the color value it has
+	if last.InColorValues[1] != 0 {
+		t.Fatalf("untraced input has color value %d", last.InColorValues[1])
+	}
+	if last.OutColorValues[1] != 0 {
+		t.Fatalf("wrong color value of output 1: got %d, want the lower bound 0",
+			last.OutColorValues[1])
+	}
+	cv, err := cd.ColorValue(b, btcwire.NewOutPoint(shaHash, 1))
+	if err != nil {
+		t.Fatalf("failed to get color value: %v", err)
+	}
+	if *cv != 12000 {
+		t.Fatalf("wrong color value of output 1: got %d, want 12000", *cv)
+	}
+}
+
+func TestProvenanceExport(t *testing.T) {
+	// Setup
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	cd := tstIssue(t, chain, spobc, 1)
+	hop := tstTransfer(t, chain, cd, cd.Genesis, 1)
+	p, err := cd.Provenance(chain.NewBlockExplorer(), hop)
+	if err != nil {
+		t.Fatalf("failed to get provenance: %v", err)
+	}
+
+	// Execute
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	dot := p.DOT()
+
+	// Verify
+	var decoded struct {
+		Definition string
+		OutPoint   string
+		ColorValue uint64
+		Txs        []struct{ Hash string }
+		Hops       []struct{ From, To string }
+	}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", encoded, err)
+	}
+	if decoded.Definition != cd.String() {
+		t.Fatalf("wrong definition: got %v, want %v", decoded.Definition, cd.String())
+	}
+	if decoded.OutPoint != hop.Hash.String()+":0" || decoded.ColorValue != 1 {
+		t.Fatalf("wrong outpoint: got %v %d", decoded.OutPoint, decoded.ColorValue)
+	}
+	if len(decoded.Txs) != 2 || len(decoded.Hops) != 1 {
+		t.Fatalf("wrong dag: got %s", encoded)
+	}
+	if decoded.Hops[0].From != cd.Genesis.Hash.String()+":0" || decoded.Hops[0].To != hop.Hash.String() {
+		t.Fatalf("wrong hop: got %v", decoded.Hops[0])
+	}
+	wantEdge := "\"" + cd.Genesis.Hash.String() + "\" -> \"" + hop.Hash.String() + "\""
+	if !strings.HasPrefix(dot, "digraph provenance {") || !strings.Contains(dot, wantEdge) {
+		t.Fatalf("wrong dot output: %v", dot)
+	}
+}
+
+func TestProvenanceError(t *testing.T) {
+	// Setup
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	cd := tstIssue(t, chain, spobc, 1)
+	tests := []struct {
+		desc     string
+		outPoint *btcwire.OutPoint
+		err      int
+	}{
+		{
+			desc:     "bad index",
+			outPoint: btcwire.NewOutPoint(&cd.Genesis.Hash, 5),
+			err:      gochroma.ErrBadOutputIndex,
+		},
+		{
+			desc:     "unknown tx",
+			outPoint: btcwire.NewOutPoint(&btcwire.ShaHash{1}, 0),
+			err:      gochroma.ErrBlockRead,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		_, err := cd.Provenance(chain.NewBlockExplorer(), test.outPoint)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
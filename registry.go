@@ -0,0 +1,185 @@
+package gochroma
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcwire"
+)
+
+// DefaultMinimumSatoshi is the smallest output value the kernels in
+// DefaultKernelRegistry will create.
+const DefaultMinimumSatoshi = int64(5430)
+
+// KernelRegistry keeps the kernels that can be looked up by code. It is
+// safe for concurrent use. Networks with different dust levels should
+// each have their own registry, see NewStandardKernelRegistry and
+// NewNetKernelRegistry.
+type KernelRegistry struct {
+	mtx     sync.RWMutex
+	kernels map[string]ColorKernel
+}
+
+// NewKernelRegistry returns an empty registry.
+func NewKernelRegistry() *KernelRegistry {
+	return &KernelRegistry{
+		kernels: make(map[string]ColorKernel, 10),
+	}
+}
+
+// StandardKernels returns the kernels this package implements, never
+// creating colored outputs smaller than minimumSatoshi or outputs that are
+// dust under DefaultDustPolicy.
+func StandardKernels(minimumSatoshi int64) []ColorKernel {
+	return dustKernels(minimumSatoshi, DefaultDustPolicy)
+}
+
+// dustKernels returns the kernels this package implements with the
+// minimum and the dust policy given.
+func dustKernels(minimumSatoshi int64, dust *DustPolicy) []ColorKernel {
+	return []ColorKernel{
+		&SPOBC{MinimumSatoshi: minimumSatoshi, Dust: dust},
+		&EPOBC{MinimumSatoshi: minimumSatoshi, Dust: dust},
+		&REPOBC{EPOBC{MinimumSatoshi: minimumSatoshi, Dust: dust}},
+	}
+}
+
+// NewStandardKernelRegistry returns a registry with the kernels this
+// package implements, never creating colored outputs smaller than
+// minimumSatoshi.
+func NewStandardKernelRegistry(minimumSatoshi int64) (*KernelRegistry, error) {
+	r := NewKernelRegistry()
+	for _, kernel := range StandardKernels(minimumSatoshi) {
+		err := r.Register(kernel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NewNetKernelRegistry returns a registry with the kernels this package
+// implements under the dust policy of the network, their colored outputs
+// being as small as the policy allows.
+func NewNetKernelRegistry(net *btcnet.Params) (*KernelRegistry, error) {
+	policy := NetDustPolicy(net)
+	r := NewKernelRegistry()
+	for _, kernel := range dustKernels(policy.MinimumSatoshi(), policy) {
+		err := r.Register(kernel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds the kernel to the registry. A kernel with the same code
+// has to be unregistered before it can be replaced.
+func (r *KernelRegistry) Register(kernel ColorKernel) error {
+	key := kernel.Code()
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, ok := r.kernels[key]
+	if ok {
+		// this is a duplicate
+		str := fmt.Sprintf("%v is already a registered kernel", key)
+		return MakeError(ErrDuplicateKernel, str, nil)
+	}
+	r.kernels[key] = kernel
+	return nil
+}
+
+// Unregister removes the kernel with the code given from the registry.
+func (r *KernelRegistry) Unregister(key string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, ok := r.kernels[key]
+	if !ok {
+		str := fmt.Sprintf("%v is not a registered kernel", key)
+		return MakeError(ErrNonExistentKernel, str, nil)
+	}
+	delete(r.kernels, key)
+	return nil
+}
+
+// Get returns the kernel with the code given.
+func (r *KernelRegistry) Get(key string) (ColorKernel, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	kernel, ok := r.kernels[key]
+	if !ok {
+		str := fmt.Sprintf("%v is not a registered kernel", key)
+		return nil, MakeError(ErrNonExistentKernel, str, nil)
+	}
+	return kernel, nil
+}
+
+// sortedCodes returns the registered codes in sorted order. The caller
+// has to hold the lock.
+func (r *KernelRegistry) sortedCodes() []string {
+	codes := make([]string, 0, len(r.kernels))
+	for key := range r.kernels {
+		codes = append(codes, key)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Codes returns the codes of every registered kernel in sorted order.
+func (r *KernelRegistry) Codes() []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.sortedCodes()
+}
+
+// Kernels returns every registered kernel, sorted by code.
+func (r *KernelRegistry) Kernels() []ColorKernel {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	codes := r.sortedCodes()
+	kernels := make([]ColorKernel, len(codes))
+	for i, key := range codes {
+		kernels[i] = r.kernels[key]
+	}
+	return kernels
+}
+
+// NewColorDefinitionFromStr parses a color definition of the form
+// KERNEL:txhash:index:height, looking up the kernel in this registry.
+func (r *KernelRegistry) NewColorDefinitionFromStr(cdString string) (*ColorDefinition, error) {
+	components := strings.Split(cdString, ":")
+	if len(components) != 4 {
+		return nil, MakeError(ErrBadColorDefinition, "color definition should have 4 components", nil)
+	}
+	kernel, err := r.Get(components[0])
+	if err != nil {
+		return nil, err
+	}
+	shaHash, err := btcwire.NewShaHashFromStr(components[1])
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "hash is invalid", err)
+	}
+	index, err := strconv.Atoi(components[2])
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "index is invalid", err)
+	}
+	genesis := btcwire.NewOutPoint(shaHash, uint32(index))
+
+	height, err := strconv.Atoi(components[3])
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "height is invalid", err)
+	}
+	if height < 0 {
+		return nil, MakeError(ErrInvalidTx, "height is negative", nil)
+	}
+
+	return &ColorDefinition{
+		ColorKernel: kernel,
+		Genesis:     genesis,
+		Height:      int64(height),
+	}, nil
+}
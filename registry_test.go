@@ -0,0 +1,262 @@
+package gochroma_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+)
+
+// tstKernel is an SPOBC kernel with a different code
+type tstKernel struct {
+	gochroma.SPOBC
+	code string
+}
+
+func (k *tstKernel) Code() string {
+	return k.code
+}
+
+func TestKernelRegistry(t *testing.T) {
+	// Setup
+	r := gochroma.NewKernelRegistry()
+	kernel := &tstKernel{code: "TEST"}
+
+	// Execute
+	err := r.Register(kernel)
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	// Verify
+	got, err := r.Get("TEST")
+	if err != nil {
+		t.Fatalf("failed to get kernel: %v", err)
+	}
+	if got != kernel {
+		t.Fatalf("wrong kernel: got %v, want %v", got, kernel)
+	}
+	codes := r.Codes()
+	if len(codes) != 1 || codes[0] != "TEST" {
+		t.Fatalf("wrong codes: got %v, want [TEST]", codes)
+	}
+	err = r.Unregister("TEST")
+	if err != nil {
+		t.Fatalf("failed to unregister: %v", err)
+	}
+	_, err = r.Get("TEST")
+	if err == nil {
+		t.Fatalf("expected an error, got nil")
+	}
+	if len(r.Kernels()) != 0 {
+		t.Fatalf("unregistered kernel is still listed")
+	}
+}
+
+func TestKernelRegistryError(t *testing.T) {
+	// Setup
+	r := gochroma.NewKernelRegistry()
+	err := r.Register(&tstKernel{code: "TEST"})
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		run  func() error
+		err  int
+	}{
+		{
+			desc: "duplicate",
+			run: func() error {
+				return r.Register(&tstKernel{code: "TEST"})
+			},
+			err: gochroma.ErrDuplicateKernel,
+		},
+		{
+			desc: "unregister non existent",
+			run: func() error {
+				return r.Unregister("NONSENSE")
+			},
+			err: gochroma.ErrNonExistentKernel,
+		},
+		{
+			desc: "get non existent",
+			run: func() error {
+				_, err := r.Get("NONSENSE")
+				return err
+			},
+			err: gochroma.ErrNonExistentKernel,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		err := test.run()
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
+func TestKernelRegistryConcurrent(t *testing.T) {
+	// Setup
+	r := gochroma.NewKernelRegistry()
+	var wg sync.WaitGroup
+
+	// Execute
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code := fmt.Sprintf("K%02d", i)
+			r.Register(&tstKernel{code: code})
+			r.Get(code)
+			r.Codes()
+			if i%2 == 1 {
+				r.Unregister(code)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Verify
+	codes := r.Codes()
+	if len(codes) != 10 {
+		t.Fatalf("wrong number of kernels: got %d, want 10", len(codes))
+	}
+	for i, code := range codes {
+		want := fmt.Sprintf("K%02d", i*2)
+		if code != want {
+			t.Fatalf("wrong code at %d: got %v, want %v", i, code, want)
+		}
+	}
+}
+
+func TestStandardKernelRegistry(t *testing.T) {
+	// Setup
+	r, err := gochroma.NewStandardKernelRegistry(546)
+	if err != nil {
+		t.Fatalf("failed to make registry: %v", err)
+	}
+	cdStr := "EPOBC:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef:0:1"
+
+	// Execute
+	cd, err := r.NewColorDefinitionFromStr(cdStr)
+	if err != nil {
+		t.Fatalf("err on color definition creation: %v", err)
+	}
+
+	// Verify
+	epobc := cd.ColorKernel.(*gochroma.EPOBC)
+	if epobc.MinimumSatoshi != 546 {
+		t.Fatalf("wrong minimum satoshi: got %d, want 546", epobc.MinimumSatoshi)
+	}
+	defaultKernel, err := gochroma.GetColorKernel("EPOBC")
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	if defaultKernel.(*gochroma.EPOBC).MinimumSatoshi != gochroma.DefaultMinimumSatoshi {
+		t.Fatalf("default registry kernel changed")
+	}
+	codes := r.Codes()
+	if len(codes) != 3 || codes[0] != "EPOBC" || codes[1] != "REPOBC" || codes[2] != "SPOBC" {
+		t.Fatalf("wrong codes: got %v, want [EPOBC REPOBC SPOBC]", codes)
+	}
+}
+
+func TestKernelRegistryDecode(t *testing.T) {
+	// Setup
+	r := gochroma.NewKernelRegistry()
+	kernel := &tstKernel{code: "TEST"}
+	err := r.Register(kernel)
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	cd, err := gochroma.NewColorDefinition(kernel,
+		btcwire.NewOutPoint(&btcwire.ShaHash{1}, 0), 100)
+	if err != nil {
+		t.Fatalf("failed to make color definition: %v", err)
+	}
+	cdData, err := json.Marshal(cd)
+	if err != nil {
+		t.Fatalf("failed to encode definition: %v", err)
+	}
+	tx := btcwire.NewMsgTx()
+	tx.AddTxIn(btcwire.NewTxIn(cd.Genesis, nil))
+	tx.AddTxOut(btcwire.NewTxOut(10000, tstScript(1)))
+	partialData, err := json.Marshal(&gochroma.PartialTx{
+		Tx: tx,
+		Inputs: []*gochroma.PartialInput{
+			&gochroma.PartialInput{PrevOut: btcwire.NewTxOut(10000, tstScript(0))},
+		},
+		Flows: []*gochroma.ColorFlow{&gochroma.ColorFlow{
+			Definition: cd,
+			Inputs:     []gochroma.ColorValue{5},
+			Outputs:    []gochroma.ColorValue{5},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode partial tx: %v", err)
+	}
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	uri := (&gochroma.PaymentRequest{Address: addr, Definition: cd, ColorValue: 5}).URI()
+
+	// Execute
+	gotCd, err := r.UnmarshalColorDefinition(cdData)
+	if err != nil {
+		t.Fatalf("failed to decode definition: %v", err)
+	}
+	gotPartial, err := r.UnmarshalPartialTx(partialData)
+	if err != nil {
+		t.Fatalf("failed to decode partial tx: %v", err)
+	}
+	gotRequest, err := r.ParsePaymentURI(uri, &btcnet.TestNet3Params, nil)
+	if err != nil {
+		t.Fatalf("failed to parse uri: %v", err)
+	}
+
+	// Verify
+	for desc, got := range map[string]*gochroma.ColorDefinition{
+		"definition":  gotCd,
+		"partial tx":  gotPartial.Flows[0].Definition,
+		"payment uri": gotRequest.Definition,
+	} {
+		if got.ColorKernel != kernel {
+			t.Errorf("%v: kernel not from the registry: got %v", desc, got.ColorKernel)
+		}
+	}
+	// the default registry doesn't know the kernel
+	for desc, err := range map[string]error{
+		"definition": json.Unmarshal(cdData, new(gochroma.ColorDefinition)),
+		"partial tx": json.Unmarshal(partialData, new(gochroma.PartialTx)),
+	} {
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(gochroma.ErrNonExistentKernel)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
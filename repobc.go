@@ -0,0 +1,291 @@
+package gochroma
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcwire"
+)
+
+var (
+	// first 6 bits are 100110, then as for EPOBCMultiGenesisMarker
+	REPOBCGenesisMarker = NewBitList(25, 6)
+	// first 6 bits are 110101
+	REPOBCTransferMarker = NewBitList(43, 6)
+)
+
+func init() {
+	RegisterColorKernel(&REPOBC{EPOBC{MinimumSatoshi: DefaultMinimumSatoshi, Dust: DefaultDustPolicy}})
+}
+
+// REPOBC is EPOBC with colors that can be issued more than once. Every
+// issuance has an authority output right after the outputs it issues to,
+// and a genesis tx whose first input spends the authority is another
+// issuance of the same color, with an authority of its own. Spending the
+// authority any other way means the color can't be issued again.
+//
+// The markers are laid out like those of EPOBC but have bits of their
+// own, so REPOBC txs aren't taken for EPOBC ones. The genesis marker
+// always counts the outputs issued to, like EPOBCMultiGenesisMarker, and
+// output 0 is the genesis of the color. Every issuance has the genesis
+// marker, and a tx can be told apart as another issuance of the color
+// only by following the authority back to the genesis, which
+// CalculateOutColorValuesOnChain does. CalculateOutColorValues only knows
+// about the first issuance.
+type REPOBC struct {
+	EPOBC
+}
+
+func (k REPOBC) Code() string {
+	return "REPOBC"
+}
+
+// epobc returns the EPOBC the kernel is built on, tagging txs with the
+// REPOBC markers.
+func (k REPOBC) epobc() EPOBC {
+	e := k.EPOBC
+	e.markers = &epobcMarkers{
+		code:         k.Code(),
+		multiGenesis: REPOBCGenesisMarker,
+		transfer:     REPOBCTransferMarker,
+	}
+	return e
+}
+
+func (k REPOBC) DetectMarker(sequence BitList) *TxMarker {
+	return k.epobc().DetectMarker(sequence)
+}
+
+// IssuingSatoshiNeeded includes the authority output.
+func (k REPOBC) IssuingSatoshiNeeded(cv ColorValue) int64 {
+	needed, err := AddSatoshi(k.EPOBC.IssuingSatoshiNeeded(cv), k.MinimumSatoshi)
+	if err != nil {
+		return math.MaxInt64
+	}
+	return needed
+}
+
+// issuingExtraSatoshi is the satoshi of the authority output.
+func (k REPOBC) issuingExtraSatoshi() int64 {
+	return k.MinimumSatoshi
+}
+
+// authorityIndex is the index of the authority output of an issuance,
+// right after the outputs it issues to.
+func (k REPOBC) authorityIndex(marker *TxMarker) int {
+	return marker.Outputs
+}
+
+// IsIssuance returns whether the tx issues the color, either as the
+// genesis or by spending the authority in its first input.
+func (k REPOBC) IsIssuance(b *BlockExplorer, genesis *btcwire.OutPoint, tx *btcwire.MsgTx) (bool, error) {
+	marker := k.epobc().txMarker(tx)
+	if marker == nil || marker.Kind != TxKindGenesis {
+		return false, nil
+	}
+	txShaHash, err := tx.TxSha()
+	if err != nil {
+		return false, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	if genesis.Hash.IsEqual(&txShaHash) {
+		return true, nil
+	}
+	return k.IsAuthority(b, genesis, &tx.TxIn[0].PreviousOutPoint)
+}
+
+// IsAuthority returns whether the outpoint is the authority output of an
+// issuance of the color, spent or not.
+func (k REPOBC) IsAuthority(b *BlockExplorer, genesis, outPoint *btcwire.OutPoint) (bool, error) {
+	var zeroHash btcwire.ShaHash
+	if outPoint.Hash.IsEqual(&zeroHash) {
+		return false, nil
+	}
+	utilTx, err := b.OutPointTx(outPoint)
+	if err != nil {
+		return false, err
+	}
+	tx := utilTx.MsgTx()
+	ok, err := k.IsIssuance(b, genesis, tx)
+	if err != nil || !ok {
+		return false, err
+	}
+	index := k.authorityIndex(k.epobc().txMarker(tx))
+	return int(outPoint.Index) == index, nil
+}
+
+func (k REPOBC) OutPointToColorIn(b *BlockExplorer,
+	genesis, outPoint *btcwire.OutPoint) (*ColorIn, error) {
+	return k.epobc().outPointToColorIn(b, k, genesis, outPoint)
+}
+
+func (k REPOBC) ColorInsValid(b *BlockExplorer, genesis *btcwire.OutPoint,
+	colorIns []*ColorIn) (bool, error) {
+	return k.epobc().colorInsValid(b, k, genesis, colorIns)
+}
+
+// IssuingTx returns the unsigned genesis tx issuing the color values of
+// the outputs. The authority to issue more goes to the change script,
+// in an output of MinimumSatoshi right after the issued outputs.
+func (k REPOBC) IssuingTx(b *BlockExplorer, inputs []*btcwire.OutPoint,
+	outputs []*ColorOut, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
+	authority := btcwire.NewTxOut(k.MinimumSatoshi, changeScript)
+	return k.epobc().issuingTx(b, inputs, outputs, []*btcwire.TxOut{authority},
+		changeScript, fee)
+}
+
+// ReissuingTx returns the unsigned tx issuing more of the color with the
+// authority, which goes first. The authority passes on to the authority
+// script, and the inputs pay for the rest.
+func (k REPOBC) ReissuingTx(b *BlockExplorer, genesis, authority *btcwire.OutPoint,
+	inputs []*btcwire.OutPoint, outputs []*ColorOut,
+	authorityScript, changeScript []byte, fee int64) (*btcwire.MsgTx, error) {
+
+	ok, err := k.IsAuthority(b, genesis, authority)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		str := fmt.Sprintf("outpoint %v:%d is not an issuance authority",
+			authority.Hash, authority.Index)
+		return nil, MakeError(ErrNotAuthority, str, nil)
+	}
+	inputs = append([]*btcwire.OutPoint{authority}, inputs...)
+	next := btcwire.NewTxOut(k.MinimumSatoshi, authorityScript)
+	return k.epobc().issuingTx(b, inputs, outputs, []*btcwire.TxOut{next},
+		changeScript, fee)
+}
+
+// CalculateOutColorValuesOnChain is that of EPOBC, except that every
+// issuance issues to its outputs like the genesis does.
+func (k REPOBC) CalculateOutColorValuesOnChain(b *BlockExplorer, genesis *btcwire.OutPoint, tx *btcwire.MsgTx, inputs []ColorValue) ([]ColorValue, error) {
+	txShaHash, err := tx.TxSha()
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	marker := k.epobc().txMarker(tx)
+	if marker == nil || marker.Kind != TxKindGenesis || genesis.Hash.IsEqual(&txShaHash) {
+		return k.epobc().CalculateOutColorValuesOnChain(b, genesis, tx, inputs)
+	}
+	outputs := make([]ColorValue, len(tx.TxOut))
+	ok, err := k.IsIssuance(b, genesis, tx)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		k.issue(tx, marker, outputs)
+	}
+	return outputs, nil
+}
+
+func (k REPOBC) MultiColorTx(b *BlockExplorer, groups []*ColorGroup,
+	funding []*btcwire.OutPoint, changeScript []byte,
+	fee int64) (*btcwire.MsgTx, error) {
+	return k.epobc().multiColorTx(b, k.Code(), groups, funding, changeScript, fee)
+}
+
+func (k REPOBC) TransferringTx(b *BlockExplorer, inputs []*ColorIn,
+	outputs []*ColorOut, changeScript []byte,
+	fee int64, destroy bool) (*btcwire.MsgTx, error) {
+	return k.epobc().TransferringTx(b, inputs, outputs, changeScript, fee, destroy)
+}
+
+func (k REPOBC) CalculateOutColorValues(genesis *btcwire.OutPoint, tx *btcwire.MsgTx, inputs []ColorValue) ([]ColorValue, error) {
+	return k.epobc().CalculateOutColorValues(genesis, tx, inputs)
+}
+
+func (k REPOBC) FindAffectingInputs(b *BlockExplorer, genesis *btcwire.OutPoint, tx *btcwire.MsgTx, outputIndexes []int) ([]*btcwire.OutPoint, error) {
+	return k.epobc().FindAffectingInputs(b, genesis, tx, outputIndexes)
+}
+
+// Issuances returns every mined issuance of the color in order, reading
+// each block from the height of the genesis on, along with the authority
+// to issue more, which is nil once it's been spent on anything but an
+// issuance.
+func (k REPOBC) Issuances(b *BlockExplorer, genesis *btcwire.OutPoint, height int64) ([]*Issuance, *btcwire.OutPoint, error) {
+	utilTx, err := b.OutPointTx(genesis)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := utilTx.MsgTx()
+	marker := k.epobc().txMarker(tx)
+	if marker == nil || marker.Kind != TxKindGenesis {
+		str := fmt.Sprintf("tx %v is not a genesis", genesis.Hash)
+		return nil, nil, MakeError(ErrInvalidTx, str, nil)
+	}
+	err = k.checkGenesis(genesis)
+	if err != nil {
+		return nil, nil, err
+	}
+	issuance, err := k.issuance(tx, marker, genesis.Hash, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	issuances := []*Issuance{issuance}
+	authority := issuance.Authority
+
+	count, err := b.BlockCount()
+	if err != nil {
+		return nil, nil, err
+	}
+	for h := height; h <= count && authority != nil; h++ {
+		block, err := b.BlockAtHeight(h)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, tx := range block.MsgBlock().Transactions {
+			spends := -1
+			for i, txIn := range tx.TxIn {
+				if txIn.PreviousOutPoint == *authority {
+					spends = i
+				}
+			}
+			if spends == -1 {
+				continue
+			}
+			marker := k.epobc().txMarker(tx)
+			if spends != 0 || marker == nil || marker.Kind != TxKindGenesis {
+				// spent on something else, so no more can be issued
+				authority = nil
+				break
+			}
+			txShaHash, err := tx.TxSha()
+			if err != nil {
+				return nil, nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+			}
+			issuance, err = k.issuance(tx, marker, txShaHash, h)
+			if err != nil {
+				return nil, nil, err
+			}
+			issuances = append(issuances, issuance)
+			authority = issuance.Authority
+			if authority == nil {
+				break
+			}
+		}
+	}
+	return issuances, authority, nil
+}
+
+// issuance describes the issuance tx and the outputs it issues to.
+func (k REPOBC) issuance(tx *btcwire.MsgTx, marker *TxMarker, shaHash btcwire.ShaHash, height int64) (*Issuance, error) {
+	outputs := make([]ColorValue, len(tx.TxOut))
+	k.issue(tx, marker, outputs)
+	issuance := &Issuance{
+		Hash:   shaHash,
+		Height: height,
+	}
+	for i := 0; i < marker.Outputs && i < len(outputs); i++ {
+		issuance.Outputs = append(issuance.Outputs, outputs[i])
+	}
+	var err error
+	issuance.ColorValue, err = SumColorValues(issuance.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	index := k.authorityIndex(marker)
+	if index < len(tx.TxOut) {
+		issuance.Authority = btcwire.NewOutPoint(&shaHash, uint32(index))
+	}
+	return issuance, nil
+}
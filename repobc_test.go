@@ -0,0 +1,220 @@
+package gochroma_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+var (
+	REPOBCKey = "REPOBC"
+)
+
+// tstReissue issues more of the color with the authority and returns the
+// reissuing tx
+func tstReissue(t *testing.T, chain *kerneltest.MemChain, cd *gochroma.ColorDefinition, authority *btcwire.OutPoint, cv gochroma.ColorValue) *btcwire.MsgTx {
+	b := chain.NewBlockExplorer()
+	kernel := cd.ColorKernel.(*gochroma.REPOBC)
+	funding := chain.Fund(kernel.IssuingSatoshiNeeded(cv)+100000, tstScript(0))
+	chain.Mine()
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(3), cv}}
+	tx, err := kernel.ReissuingTx(b, cd.Genesis, authority,
+		[]*btcwire.OutPoint{funding}, outputs, tstScript(0), tstScript(0), 1000)
+	if err != nil {
+		t.Fatalf("failed to make reissuing tx: %v", err)
+	}
+	tstPublish(t, chain, tx)
+	return tx
+}
+
+func TestREPOBCCode(t *testing.T) {
+	// Setup
+	repobc, err := gochroma.GetColorKernel(REPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting repobc kernel: %v", err)
+	}
+
+	// Execute
+	str := repobc.Code()
+
+	// Verify
+	if str != REPOBCKey {
+		t.Fatalf("wrong KernelCode, got: %v, want %v", str, REPOBCKey)
+	}
+}
+
+func TestREPOBCIssuingSatoshiNeeded(t *testing.T) {
+	// Setup
+	repobc, err := gochroma.GetColorKernel(REPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting repobc kernel: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		cv   gochroma.ColorValue
+		want int64
+	}{
+		{
+			desc: "100",
+			cv:   100,
+			want: 8192 + 100 + gochroma.DefaultMinimumSatoshi,
+		},
+		{
+			desc: "authority doesn't fit",
+			cv:   math.MaxInt64 - 5000,
+			want: math.MaxInt64,
+		},
+		{
+			desc: "too big to issue",
+			cv:   math.MaxUint64,
+			want: math.MaxInt64,
+		},
+	}
+
+	for _, test := range tests {
+		// Execute
+		amount := repobc.IssuingSatoshiNeeded(test.cv)
+
+		// Verify
+		if amount != test.want {
+			t.Errorf("%v: wrong amount, got: %v, want %v", test.desc, amount, test.want)
+		}
+	}
+}
+
+func TestREPOBCConformance(t *testing.T) {
+	repobc := &gochroma.REPOBC{gochroma.EPOBC{MinimumSatoshi: gochroma.DefaultMinimumSatoshi}}
+	kerneltest.Run(t, repobc, kerneltest.NewMemChain(), 10000)
+}
+
+func TestREPOBCReissue(t *testing.T) {
+	// Setup
+	repobc, err := gochroma.GetColorKernel(REPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting repobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, repobc, 100)
+
+	// Execute
+	first := tstReissue(t, chain, cd, btcwire.NewOutPoint(&cd.Genesis.Hash, 1), 50)
+	firstHash, _ := first.TxSha()
+	second := tstReissue(t, chain, cd, btcwire.NewOutPoint(&firstHash, 1), 25)
+	secondHash, _ := second.TxSha()
+
+	// a new color of the same kernel is not an issuance of this one
+	other := tstIssue(t, chain, repobc, 10)
+
+	// all three issuances can be sent on together
+	inputs := []*gochroma.ColorIn{
+		&gochroma.ColorIn{cd.Genesis, 100},
+		&gochroma.ColorIn{btcwire.NewOutPoint(&firstHash, 0), 50},
+		&gochroma.ColorIn{btcwire.NewOutPoint(&secondHash, 0), 25},
+	}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 175}}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, false)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	merged := btcwire.NewOutPoint(tstPublish(t, chain, tx), 0)
+
+	// Verify
+	tests := []struct {
+		desc     string
+		outPoint *btcwire.OutPoint
+		cv       gochroma.ColorValue
+	}{
+		{"first authority", btcwire.NewOutPoint(&firstHash, 1), 0},
+		{"second issuance", btcwire.NewOutPoint(&secondHash, 0), 0},
+		{"other color", other.Genesis, 0},
+		{"merged", merged, 175},
+	}
+	for _, test := range tests {
+		cv, err := cd.ColorValue(b, test.outPoint)
+		if err != nil {
+			t.Errorf("%v: failed to get color value: %v", test.desc, err)
+			continue
+		}
+		if *cv != test.cv {
+			t.Errorf("%v: wrong color value: got %d, want %d", test.desc, *cv, test.cv)
+		}
+	}
+	p, err := cd.Provenance(b, merged)
+	if err != nil {
+		t.Fatalf("failed to get provenance: %v", err)
+	}
+	issuances := 0
+	for _, ptx := range p.Txs {
+		if ptx.Genesis {
+			issuances++
+		}
+	}
+	if issuances != 3 {
+		t.Errorf("wrong number of issuances in provenance: got %d, want 3", issuances)
+	}
+}
+
+func TestREPOBCReissuingTxError(t *testing.T) {
+	// Setup
+	repobc, err := gochroma.GetColorKernel(REPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting repobc kernel: %v", err)
+	}
+	kernel := repobc.(*gochroma.REPOBC)
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, repobc, 100)
+	other := tstIssue(t, chain, repobc, 100)
+	authority := btcwire.NewOutPoint(&cd.Genesis.Hash, 1)
+	funding := chain.Fund(100000, tstScript(0))
+	chain.Mine()
+
+	// spend the authority of another color outside of an issuance
+	spend := btcwire.NewMsgTx()
+	spend.AddTxIn(btcwire.NewTxIn(btcwire.NewOutPoint(&other.Genesis.Hash, 1), nil))
+	spend.AddTxOut(btcwire.NewTxOut(1000, tstScript(0)))
+	tstPublish(t, chain, spend)
+
+	tests := []struct {
+		desc      string
+		authority *btcwire.OutPoint
+		err       int
+	}{
+		{"colored output", cd.Genesis, gochroma.ErrNotAuthority},
+		{"change output", btcwire.NewOutPoint(&cd.Genesis.Hash, 2), gochroma.ErrNotAuthority},
+		{"other color", btcwire.NewOutPoint(&other.Genesis.Hash, 1), gochroma.ErrNotAuthority},
+		{"funding", funding, gochroma.ErrNotAuthority},
+		{"spent", authority, gochroma.ErrOutPointSpent},
+	}
+
+	// the authority is fine for the right color, but spent by the time
+	// the last case tries it
+	reissue := tstReissue(t, chain, cd, authority, 10)
+	if reissue == nil {
+		t.Fatalf("failed to reissue")
+	}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(3), 10}}
+
+	for _, test := range tests {
+		// Execute
+		_, err := kernel.ReissuingTx(b, cd.Genesis, test.authority,
+			[]*btcwire.OutPoint{funding}, outputs, tstScript(0), tstScript(0), 1000)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
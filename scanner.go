@@ -0,0 +1,99 @@
+package gochroma
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// ScanGenesis scans for genesis transactions with the kernels in
+// DefaultKernelRegistry.
+func ScanGenesis(b *BlockExplorer, startHeight, endHeight int64,
+	found func(*ColorDefinition) error) error {
+	return DefaultKernelRegistry.ScanGenesis(b, startHeight, endHeight, found)
+}
+
+// FindGenesis finds genesis transactions with the kernels in
+// DefaultKernelRegistry.
+func FindGenesis(b *BlockExplorer, startHeight, endHeight int64) ([]*ColorDefinition, error) {
+	return DefaultKernelRegistry.FindGenesis(b, startHeight, endHeight)
+}
+
+// ScanGenesis goes through every block from startHeight to endHeight
+// (inclusive) and calls found with a color definition for each
+// transaction that a kernel in the registry tagged as a genesis.
+// Scanning stops at the first error, including any returned by found.
+func (r *KernelRegistry) ScanGenesis(b *BlockExplorer, startHeight, endHeight int64,
+	found func(*ColorDefinition) error) error {
+
+	if startHeight < 0 || endHeight < startHeight {
+		str := fmt.Sprintf("can't scan from %d to %d", startHeight, endHeight)
+		return MakeError(ErrBadHeight, str, nil)
+	}
+
+	for height := startHeight; height <= endHeight; height++ {
+		block, err := b.BlockAtHeight(height)
+		if err != nil {
+			return err
+		}
+		for i, tx := range block.Transactions() {
+			// the coinbase sequence is set by the miner, so it's
+			// never a genesis
+			if i == 0 {
+				continue
+			}
+			cd, err := r.genesisDefinition(tx.MsgTx(), height)
+			if err != nil {
+				return err
+			}
+			if cd == nil {
+				continue
+			}
+			err = found(cd)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindGenesis returns the color definitions of every genesis transaction
+// from startHeight to endHeight (inclusive).
+func (r *KernelRegistry) FindGenesis(b *BlockExplorer, startHeight, endHeight int64) ([]*ColorDefinition, error) {
+	var cds []*ColorDefinition
+	err := r.ScanGenesis(b, startHeight, endHeight, func(cd *ColorDefinition) error {
+		cds = append(cds, cd)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cds, nil
+}
+
+// genesisDefinition returns the color definition that tx is the genesis
+// of, or nil if it isn't a genesis transaction.
+func (r *KernelRegistry) genesisDefinition(tx *btcwire.MsgTx, height int64) (*ColorDefinition, error) {
+	if len(tx.TxIn) == 0 || len(tx.TxOut) == 0 {
+		return nil, nil
+	}
+	marker, err := r.ClassifyTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	if marker.Kind != TxKindGenesis {
+		return nil, nil
+	}
+	kernel, err := r.Get(marker.Code)
+	if err != nil {
+		return nil, err
+	}
+	shaHash, err := tx.TxSha()
+	if err != nil {
+		return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	// the issuing txs of every kernel put the colored output first
+	genesis := btcwire.NewOutPoint(&shaHash, 0)
+	return NewColorDefinition(kernel, genesis, height)
+}
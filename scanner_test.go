@@ -0,0 +1,229 @@
+package gochroma_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+// tstSequenceTx makes a tx with a random input having the sequence given
+func tstSequenceTx(sequence uint32) *btcwire.MsgTx {
+	msgTx := btcwire.NewMsgTx()
+	hashBytes := make([]byte, 32)
+	rand.Read(hashBytes)
+	shaHash, _ := btcwire.NewShaHash(hashBytes)
+	txIn := btcwire.NewTxIn(btcwire.NewOutPoint(shaHash, 0), nil)
+	txIn.Sequence = sequence
+	msgTx.AddTxIn(txIn)
+	msgTx.AddTxOut(btcwire.NewTxOut(10000, nil))
+	return msgTx
+}
+
+// tstRawBlock serializes a block with a coinbase followed by the txs given
+func tstRawBlock(txs ...*btcwire.MsgTx) []byte {
+	coinbase := btcwire.NewMsgTx()
+	coinbase.AddTxIn(btcwire.NewTxIn(
+		btcwire.NewOutPoint(&btcwire.ShaHash{}, 0xffffffff), nil))
+	// a marker on the coinbase should be ignored
+	coinbase.TxIn[0].Sequence = gochroma.SPOBCSequenceMarker
+	coinbase.AddTxOut(btcwire.NewTxOut(2500000000, nil))
+	msgBlock := btcwire.MsgBlock{
+		Transactions: append([]*btcwire.MsgTx{coinbase}, txs...),
+	}
+	var buf bytes.Buffer
+	msgBlock.Serialize(&buf)
+	return buf.Bytes()
+}
+
+func TestFindGenesis(t *testing.T) {
+	// Setup
+	spobcTx := tstSequenceTx(gochroma.SPOBCSequenceMarker)
+	epobcTx := tstSequenceTx(
+		gochroma.EPOBCGenesisMarker.Combine(gochroma.NewBitList(13, 26)).Uint32())
+	transferTx := tstSequenceTx(
+		gochroma.EPOBCTransferMarker.Combine(gochroma.NewBitList(13, 26)).Uint32())
+	plainTx := tstSequenceTx(btcwire.MaxTxInSequenceNum)
+	blockReaderWriter := &TstBlockReaderWriter{
+		blockHash: [][]byte{blockHash, blockHash, blockHash},
+		block: [][]byte{
+			tstRawBlock(plainTx, spobcTx),
+			tstRawBlock(),
+			tstRawBlock(transferTx, epobcTx),
+		},
+	}
+	b := &gochroma.BlockExplorer{blockReaderWriter}
+
+	// Execute
+	cds, err := gochroma.FindGenesis(b, 10, 12)
+	if err != nil {
+		t.Fatalf("failed to find genesis: %v", err)
+	}
+
+	// Verify
+	tests := []struct {
+		tx     *btcwire.MsgTx
+		code   string
+		height int64
+	}{
+		{spobcTx, "SPOBC", 10},
+		{epobcTx, "EPOBC", 12},
+	}
+	if len(cds) != len(tests) {
+		t.Fatalf("wrong number of definitions: got %d, want %d", len(cds), len(tests))
+	}
+	for i, test := range tests {
+		shaHash, err := test.tx.TxSha()
+		if err != nil {
+			t.Fatalf("err on shahash creation: %v", err)
+		}
+		cd := cds[i]
+		if cd.Code() != test.code {
+			t.Errorf("%d: wrong kernel: got %v, want %v", i, cd.Code(), test.code)
+		}
+		if !cd.Genesis.Hash.IsEqual(&shaHash) || cd.Genesis.Index != 0 {
+			t.Errorf("%d: wrong genesis: got %v, want %v:0", i, cd.Genesis, shaHash)
+		}
+		if cd.Height != test.height {
+			t.Errorf("%d: wrong height: got %d, want %d", i, cd.Height, test.height)
+		}
+	}
+}
+
+func TestScanGenesisStop(t *testing.T) {
+	// Setup
+	blockReaderWriter := &TstBlockReaderWriter{
+		blockHash: [][]byte{blockHash, blockHash},
+		block: [][]byte{
+			tstRawBlock(tstSequenceTx(gochroma.SPOBCSequenceMarker)),
+			tstRawBlock(tstSequenceTx(gochroma.SPOBCSequenceMarker)),
+		},
+	}
+	b := &gochroma.BlockExplorer{blockReaderWriter}
+	stop := errors.New("stop")
+	count := 0
+
+	// Execute
+	err := gochroma.ScanGenesis(b, 0, 1, func(cd *gochroma.ColorDefinition) error {
+		count++
+		return stop
+	})
+
+	// Verify
+	if err != stop {
+		t.Fatalf("wrong error: got %v, want %v", err, stop)
+	}
+	if count != 1 {
+		t.Fatalf("scanning didn't stop: got %d calls, want 1", count)
+	}
+}
+
+func TestScanGenesisError(t *testing.T) {
+	tests := []struct {
+		desc  string
+		start int64
+		end   int64
+		err   int
+	}{
+		{
+			desc:  "negative start",
+			start: -1,
+			end:   5,
+			err:   gochroma.ErrBadHeight,
+		},
+		{
+			desc:  "end before start",
+			start: 5,
+			end:   4,
+			err:   gochroma.ErrBadHeight,
+		},
+		{
+			desc:  "block read error",
+			start: 5,
+			end:   5,
+			err:   gochroma.ErrBlockRead,
+		},
+	}
+
+	for _, test := range tests {
+		b := &gochroma.BlockExplorer{&TstBlockReaderWriter{}}
+
+		// Execute
+		_, err := gochroma.FindGenesis(b, test.start, test.end)
+
+		// Verify
+		if err == nil {
+			t.Errorf("%v: expected error, got nil", test.desc)
+			continue
+		}
+		rerr := err.(gochroma.ChromaError)
+		wantErr := gochroma.ErrorCode(test.err)
+		if rerr.ErrorCode != wantErr {
+			t.Errorf("%v: wrong error passed back: got %v, want %v",
+				test.desc, rerr.ErrorCode, wantErr)
+		}
+	}
+}
+
+func TestFindGenesisREPOBC(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	repobc, err := gochroma.GetColorKernel(REPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting repobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	epobcCD := tstIssue(t, chain, epobc, 100)
+	repobcCD := tstIssue(t, chain, repobc, 100)
+	reissue := tstReissue(t, chain, repobcCD, btcwire.NewOutPoint(&repobcCD.Genesis.Hash, 1), 50)
+	reissueHash, _ := reissue.TxSha()
+	tstTransfer(t, chain, repobcCD, repobcCD.Genesis, 100)
+	count, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+
+	// Execute
+	marker, err := gochroma.ClassifyTx(reissue)
+	if err != nil {
+		t.Fatalf("failed to classify reissuance: %v", err)
+	}
+	cds, err := gochroma.FindGenesis(b, 0, count)
+	if err != nil {
+		t.Fatalf("failed to find genesis: %v", err)
+	}
+
+	// Verify
+	if marker.Code != REPOBCKey || marker.Kind != gochroma.TxKindGenesis {
+		t.Errorf("wrong marker for reissuance: got %v %v, want %v %v",
+			marker.Code, marker.Kind, REPOBCKey, gochroma.TxKindGenesis)
+	}
+	tests := []struct {
+		hash btcwire.ShaHash
+		code string
+	}{
+		{epobcCD.Genesis.Hash, EPOBCKey},
+		{repobcCD.Genesis.Hash, REPOBCKey},
+		{reissueHash, REPOBCKey},
+	}
+	if len(cds) != len(tests) {
+		t.Fatalf("wrong number of definitions: got %d, want %d", len(cds), len(tests))
+	}
+	for i, test := range tests {
+		cd := cds[i]
+		if !cd.Genesis.Hash.IsEqual(&test.hash) {
+			t.Errorf("%d: wrong genesis: got %v, want %v", i, cd.Genesis.Hash, test.hash)
+		}
+		if cd.Code() != test.code {
+			t.Errorf("%d: wrong kernel: got %v, want %v", i, cd.Code(), test.code)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package gochroma
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcec"
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+)
+
+// VerifyFlags are the script checks a signed tx has to pass.
+const VerifyFlags = btcscript.ScriptBip16 | btcscript.ScriptCanonicalSignatures |
+	btcscript.ScriptStrictMultiSig
+
+// Signer signs colored transactions.
+type Signer interface {
+	// Returns a copy of the tx with every input signed, ready to publish
+	SignTx(b *BlockExplorer, tx *btcwire.MsgTx) (*btcwire.MsgTx, error)
+}
+
+// KeyStore is a Signer with the private keys and the redeem scripts it
+// can spend pay-to-pubkey-hash and pay-to-script-hash multisig outputs
+// with.
+type KeyStore struct {
+	Net     *btcnet.Params
+	keys    map[string]*btcutil.WIF
+	scripts map[string][]byte
+}
+
+// NewKeyStore returns an empty KeyStore for the network.
+func NewKeyStore(net *btcnet.Params) *KeyStore {
+	return &KeyStore{
+		Net:     net,
+		keys:    make(map[string]*btcutil.WIF),
+		scripts: make(map[string][]byte),
+	}
+}
+
+// AddKey adds the private key, which spends outputs paying to the hash of
+// its public key, serialized compressed or not as the WIF says.
+func (s *KeyStore) AddKey(wif *btcutil.WIF) error {
+	if !wif.IsForNet(s.Net) {
+		str := fmt.Sprintf("key is not for %v", s.Net.Name)
+		return MakeError(ErrSign, str, nil)
+	}
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(wif.SerializePubKey()), s.Net)
+	if err != nil {
+		return MakeError(ErrSign, "cannot make address of key", err)
+	}
+	s.keys[addr.EncodeAddress()] = wif
+	return nil
+}
+
+// AddScript adds the redeem script of outputs paying to its hash.
+func (s *KeyStore) AddScript(script []byte) (*btcutil.AddressScriptHash, error) {
+	addr, err := btcutil.NewAddressScriptHash(script, s.Net)
+	if err != nil {
+		return nil, MakeError(ErrSign, "cannot make address of script", err)
+	}
+	s.scripts[addr.EncodeAddress()] = script
+	return addr, nil
+}
+
+// GetKey returns the private key of the address, which is that of a
+// public key or its hash, and whether the public key is compressed.
+func (s *KeyStore) GetKey(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+	wif, ok := s.keys[addr.EncodeAddress()]
+	if !ok {
+		str := fmt.Sprintf("no key for address %v", addr.EncodeAddress())
+		return nil, false, MakeError(ErrSign, str, nil)
+	}
+	return wif.PrivKey, wif.CompressPubKey, nil
+}
+
+// keyFor returns the private key of the serialized public key, or nil if
+// the store doesn't have it.
+func (s *KeyStore) keyFor(pubKey []byte) *btcutil.WIF {
+	for _, wif := range s.keys {
+		if bytes.Equal(wif.SerializePubKey(), pubKey) {
+			return wif
+		}
+	}
+	return nil
+}
+
+// GetScript returns the redeem script of the pay-to-script-hash address.
+func (s *KeyStore) GetScript(addr btcutil.Address) ([]byte, error) {
+	script, ok := s.scripts[addr.EncodeAddress()]
+	if !ok {
+		str := fmt.Sprintf("no script for address %v", addr.EncodeAddress())
+		return nil, MakeError(ErrSign, str, nil)
+	}
+	return script, nil
+}
+
+// SignTx signs every input with SIGHASH_ALL, merging in the signatures the
+// input has already so multisig inputs can be signed by several stores
+// in turn, then verifies the scripts. Multisig inputs still short of
+// signatures are left out of the check, so the tx only passes
+// VerifyTxScripts once the last store has signed it.
+func (s *KeyStore) SignTx(b *BlockExplorer, tx *btcwire.MsgTx) (*btcwire.MsgTx, error) {
+	signed := tx.Copy()
+	prevOuts := make([]*btcwire.TxOut, len(signed.TxIn))
+	for i, txIn := range signed.TxIn {
+		var err error
+		prevOuts[i], err = b.OutPointTxOut(&txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		sigScript, err := btcscript.SignTxOutput(s.Net, signed, i,
+			prevOuts[i].PkScript, btcscript.SigHashAll, s, s, txIn.SignatureScript)
+		if err != nil {
+			rerr, ok := err.(ChromaError)
+			if ok {
+				return nil, rerr
+			}
+			str := fmt.Sprintf("failed to sign input %d", i)
+			return nil, MakeError(ErrSign, str, err)
+		}
+		txIn.SignatureScript = sigScript
+	}
+	for i, txIn := range signed.TxIn {
+		if multisigShort(txIn.SignatureScript, prevOuts[i].PkScript) {
+			continue
+		}
+		err := verifyScript(signed, i, prevOuts[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return signed, nil
+}
+
+// multisigShort returns whether the signature script spends a
+// pay-to-script-hash multisig output with fewer signatures than the
+// redeem script needs.
+func multisigShort(sigScript, pkScript []byte) bool {
+	if btcscript.GetScriptClass(pkScript) != btcscript.ScriptHashTy {
+		return false
+	}
+	pushes, err := btcscript.PushedData(sigScript)
+	if err != nil || len(pushes) == 0 {
+		return false
+	}
+	// the redeem script goes last
+	required, _, err := multisigKeys(pushes[len(pushes)-1])
+	if err != nil {
+		return false
+	}
+	sigs := 0
+	for _, push := range pushes[:len(pushes)-1] {
+		// missing signatures are empty pushes
+		if len(push) > 0 {
+			sigs++
+		}
+	}
+	return sigs < required
+}
+
+// VerifyTxScripts runs the signature script of every input against the
+// output it spends.
+func VerifyTxScripts(b *BlockExplorer, tx *btcwire.MsgTx) error {
+	prevOuts := make([]*btcwire.TxOut, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		var err error
+		prevOuts[i], err = b.OutPointTxOut(&txIn.PreviousOutPoint)
+		if err != nil {
+			return err
+		}
+	}
+	return verifyScripts(tx, prevOuts)
+}
+
+// verifyScripts runs the signature script of every input against the
+// output given for it.
+func verifyScripts(tx *btcwire.MsgTx, prevOuts []*btcwire.TxOut) error {
+	for i := range tx.TxIn {
+		err := verifyScript(tx, i, prevOuts[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyScript runs the signature script of the input at index i
+// against the output it spends.
+func verifyScript(tx *btcwire.MsgTx, i int, prevOut *btcwire.TxOut) error {
+	engine, err := btcscript.NewScript(tx.TxIn[i].SignatureScript,
+		prevOut.PkScript, i, tx, VerifyFlags)
+	if err == nil {
+		err = engine.Execute()
+	}
+	if err != nil {
+		str := fmt.Sprintf("input %d does not verify", i)
+		return MakeError(ErrBadSignature, str, err)
+	}
+	return nil
+}
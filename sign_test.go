@@ -0,0 +1,254 @@
+package gochroma_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcec"
+	"github.com/btcsuite/btcnet"
+	"github.com/btcsuite/btcscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+// tstWIF returns a made-up compressed private key for the number
+func tstWIF(t *testing.T, n byte) *btcutil.WIF {
+	secret := make([]byte, 32)
+	secret[31] = n
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), secret)
+	wif, err := btcutil.NewWIF(priv, &btcnet.TestNet3Params, true)
+	if err != nil {
+		t.Fatalf("failed to make key: %v", err)
+	}
+	return wif
+}
+
+// tstP2PKH returns the pay-to-pubkey-hash script of the key
+func tstP2PKH(t *testing.T, wif *btcutil.WIF) []byte {
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(wif.SerializePubKey()), &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	script, err := btcscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("failed to make script: %v", err)
+	}
+	return script
+}
+
+// tstMultisig returns the m of n redeem script of the keys
+func tstMultisig(t *testing.T, m int, wifs ...*btcutil.WIF) []byte {
+	var pubKeys []*btcutil.AddressPubKey
+	for _, wif := range wifs {
+		pubKey, err := btcutil.NewAddressPubKey(wif.SerializePubKey(), &btcnet.TestNet3Params)
+		if err != nil {
+			t.Fatalf("failed to make pubkey: %v", err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	script, err := btcscript.MultiSigScript(pubKeys, m)
+	if err != nil {
+		t.Fatalf("failed to make multisig script: %v", err)
+	}
+	return script
+}
+
+// tstP2SH returns the pay-to-script-hash script of the redeem script
+func tstP2SH(t *testing.T, redeemScript []byte) []byte {
+	addr, err := btcutil.NewAddressScriptHash(redeemScript, &btcnet.TestNet3Params)
+	if err != nil {
+		t.Fatalf("failed to make address: %v", err)
+	}
+	script, err := btcscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("failed to make script: %v", err)
+	}
+	return script
+}
+
+func TestKeyStoreSignTx(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	wifs := []*btcutil.WIF{tstWIF(t, 1), tstWIF(t, 2), tstWIF(t, 3)}
+	redeemScript := tstMultisig(t, 2, wifs...)
+
+	tests := []struct {
+		desc   string
+		script []byte
+		keys   []int
+		err    int
+	}{
+		{"p2pkh", tstP2PKH(t, wifs[0]), []int{0}, -1},
+		{"multisig", tstP2SH(t, redeemScript), []int{0, 2}, -1},
+		{"no key", tstP2PKH(t, wifs[0]), []int{1}, gochroma.ErrSign},
+	}
+
+	for _, test := range tests {
+		chain := kerneltest.NewMemChain()
+		b := chain.NewBlockExplorer()
+		funding := chain.Fund(100000, test.script)
+		chain.Mine()
+		outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), 100}}
+		tx, err := epobc.IssuingTx(b, []*btcwire.OutPoint{funding}, outputs, test.script, 1000)
+		if err != nil {
+			t.Fatalf("%v: failed to make issuing tx: %v", test.desc, err)
+		}
+		store := gochroma.NewKeyStore(&btcnet.TestNet3Params)
+		for _, key := range test.keys {
+			err = store.AddKey(wifs[key])
+			if err != nil {
+				t.Fatalf("%v: failed to add key: %v", test.desc, err)
+			}
+		}
+		_, err = store.AddScript(redeemScript)
+		if err != nil {
+			t.Fatalf("%v: failed to add script: %v", test.desc, err)
+		}
+
+		// Execute
+		signed, err := store.SignTx(b, tx)
+
+		// Verify
+		if test.err != -1 {
+			if err == nil {
+				t.Errorf("%v: expected error, got nil", test.desc)
+				continue
+			}
+			rerr := err.(gochroma.ChromaError)
+			want := gochroma.ErrorCode(test.err)
+			if rerr.ErrorCode != want {
+				t.Errorf("%v: wrong error, want %v, got %v", test.desc, want, rerr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: failed to sign: %v", test.desc, err)
+			continue
+		}
+		if len(tx.TxIn[0].SignatureScript) != 0 {
+			t.Errorf("%v: signing changed the unsigned tx", test.desc)
+		}
+		err = gochroma.VerifyTxScripts(b, signed)
+		if err != nil {
+			t.Errorf("%v: signed tx does not verify: %v", test.desc, err)
+		}
+		// signing keeps the marker
+		if signed.TxIn[0].Sequence != tx.TxIn[0].Sequence {
+			t.Errorf("%v: sequence changed", test.desc)
+		}
+	}
+}
+
+func TestKeyStoreSignTxInTurn(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	wifs := []*btcutil.WIF{tstWIF(t, 1), tstWIF(t, 2)}
+	redeemScript := tstMultisig(t, 2, wifs...)
+	script := tstP2SH(t, redeemScript)
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	funding := chain.Fund(100000, script)
+	chain.Mine()
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(1), 100}}
+	tx, err := epobc.IssuingTx(b, []*btcwire.OutPoint{funding}, outputs, script, 1000)
+	if err != nil {
+		t.Fatalf("failed to make issuing tx: %v", err)
+	}
+	// each store holds one of the keys
+	stores := make([]*gochroma.KeyStore, len(wifs))
+	for i, wif := range wifs {
+		stores[i] = gochroma.NewKeyStore(&btcnet.TestNet3Params)
+		err = stores[i].AddKey(wif)
+		if err != nil {
+			t.Fatalf("failed to add key: %v", err)
+		}
+		_, err = stores[i].AddScript(redeemScript)
+		if err != nil {
+			t.Fatalf("failed to add script: %v", err)
+		}
+	}
+
+	// Execute
+	half, err := stores[0].SignTx(b, tx)
+	if err != nil {
+		t.Fatalf("failed to sign with the first store: %v", err)
+	}
+	signed, err := stores[1].SignTx(b, half)
+	if err != nil {
+		t.Fatalf("failed to sign with the second store: %v", err)
+	}
+
+	// Verify
+	err = gochroma.VerifyTxScripts(b, half)
+	if err == nil {
+		t.Errorf("tx signed by one store verifies")
+	} else if rerr := err.(gochroma.ChromaError); rerr.ErrorCode != gochroma.ErrBadSignature {
+		t.Errorf("wrong error, want %v, got %v", gochroma.ErrorCode(gochroma.ErrBadSignature), rerr)
+	}
+	err = gochroma.VerifyTxScripts(b, signed)
+	if err != nil {
+		t.Errorf("signed tx does not verify: %v", err)
+	}
+}
+
+func TestVerifyTxScriptsError(t *testing.T) {
+	// Setup
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	wif := tstWIF(t, 1)
+	funding := chain.Fund(100000, tstP2PKH(t, wif))
+	chain.Mine()
+	tx := btcwire.NewMsgTx()
+	tx.AddTxIn(btcwire.NewTxIn(funding, nil))
+	tx.AddTxOut(btcwire.NewTxOut(90000, tstScript(0)))
+	store := gochroma.NewKeyStore(&btcnet.TestNet3Params)
+	err := store.AddKey(wif)
+	if err != nil {
+		t.Fatalf("failed to add key: %v", err)
+	}
+	signed, err := store.SignTx(b, tx)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	// changing an output after signing breaks the signature
+	signed.TxOut[0].Value = 95000
+
+	// Execute
+	err = gochroma.VerifyTxScripts(b, signed)
+
+	// Verify
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	want := gochroma.ErrorCode(gochroma.ErrBadSignature)
+	if rerr.ErrorCode != want {
+		t.Errorf("wrong error, want %v, got %v", want, rerr)
+	}
+}
+
+func TestKeyStoreAddKeyError(t *testing.T) {
+	// Setup
+	store := gochroma.NewKeyStore(&btcnet.MainNetParams)
+
+	// Execute
+	err := store.AddKey(tstWIF(t, 1))
+
+	// Verify
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	want := gochroma.ErrorCode(gochroma.ErrSign)
+	if rerr.ErrorCode != want {
+		t.Errorf("wrong error, want %v, got %v", want, rerr)
+	}
+}
@@ -7,27 +7,47 @@ import (
 )
 
 var (
-	// first 6 bits are 100000
+	// the whole nSequence is 1, nothing else marks an SPOBC genesis
 	SPOBCSequenceMarker uint32 = NewBitList(1, 32).Uint32()
 )
 
 func init() {
-	RegisterColorKernel(&SPOBC{MinimumSatoshi: int64(5430)})
+	RegisterColorKernel(&SPOBC{MinimumSatoshi: DefaultMinimumSatoshi, Dust: DefaultDustPolicy})
 }
 
 type SPOBC struct {
 	MinimumSatoshi int64
+	// outputs the builders make have to clear it, and change that
+	// doesn't goes to the fee
+	Dust *DustPolicy
 }
 
 func (k SPOBC) Code() string {
 	return "SPOBC"
 }
 
+// DetectMarker recognizes the nSequence of an SPOBC genesis transaction.
+// SPOBC transfers are not tagged so they can't be detected.
+func (k SPOBC) DetectMarker(sequence BitList) *TxMarker {
+	// compare all 32 bits, an nSequence that only starts like the
+	// marker isn't one
+	if !sequence.Equal(NewBitList(SPOBCSequenceMarker, 32)) {
+		return nil
+	}
+	return &TxMarker{
+		Code:    k.Code(),
+		Kind:    TxKindGenesis,
+		Outputs: 1,
+	}
+}
+
 func (k SPOBC) IssuingSatoshiNeeded(cv ColorValue) int64 {
 	return k.MinimumSatoshi
 }
 
-func (k SPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, fee int64) (*int64, error) {
+// getChange returns what's left of the inputs after the fee and the
+// outputs, each of which has MinimumSatoshi.
+func (k SPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, outputs int, fee int64) (*int64, error) {
 	sum := int64(0)
 	for _, input := range inputs {
 		// return an error if this input has been spent already
@@ -44,7 +64,10 @@ func (k SPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, fee int64
 		if err != nil {
 			return nil, err
 		}
-		sum += value
+		sum, err = AddSatoshi(sum, value)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if fee < 0 {
@@ -53,7 +76,14 @@ func (k SPOBC) getChange(b *BlockExplorer, inputs []*btcwire.OutPoint, fee int64
 	}
 
 	// add up all inputs in order and see if we have enough
-	amountNeeded := fee + k.MinimumSatoshi
+	outputSum, err := MulSatoshi(k.MinimumSatoshi, outputs)
+	if err != nil {
+		return nil, err
+	}
+	amountNeeded, err := AddSatoshi(fee, outputSum)
+	if err != nil {
+		return nil, err
+	}
 	if sum < amountNeeded {
 		str := fmt.Sprintf("have %d satoshi, need %d satoshi to issue", sum,
 			amountNeeded)
@@ -151,7 +181,7 @@ func (k SPOBC) IssuingTx(b *BlockExplorer, inputs []*btcwire.OutPoint,
 		return nil, MakeError(ErrInsufficientColorValue, "spobc only should ever issue 1 color value", nil)
 	}
 
-	change, err := k.getChange(b, inputs, fee)
+	change, err := k.getChange(b, inputs, 1, fee)
 	if err != nil {
 		return nil, err
 	}
@@ -167,8 +197,9 @@ func (k SPOBC) IssuingTx(b *BlockExplorer, inputs []*btcwire.OutPoint,
 		msgTx.AddTxIn(txIn)
 	}
 	msgTx.AddTxOut(btcwire.NewTxOut(k.MinimumSatoshi, outputs[0].Script))
-	if *change > 0 {
-		msgTx.AddTxOut(btcwire.NewTxOut(*change, changeScript))
+	err = k.Dust.finishTx(msgTx, *change, changeScript)
+	if err != nil {
+		return nil, err
 	}
 	return msgTx, nil
 }
@@ -180,22 +211,24 @@ func (k SPOBC) TransferringTx(b *BlockExplorer, inputs []*ColorIn,
 	sum := ColorValue(0)
 	inLength := len(inputs)
 	outLength := len(outputs)
-	for i := 0; i < inLength && i < outLength; i++ {
+	for i := 0; i < inLength || i < outLength; i++ {
 		var in *ColorIn
 		var out *ColorOut
 		if i < inLength {
 			in = inputs[i]
-			sum += in.ColorValue
+			var err error
+			sum, err = sum.Add(in.ColorValue)
+			if err != nil {
+				return nil, err
+			}
 		}
 		if i < outLength {
 			out = outputs[i]
 		}
-		if in != nil && out != nil {
-			if out.ColorValue > in.ColorValue {
-				return nil, MakeError(ErrInsufficientColorValue, "you cannot create color value in a transfer", nil)
-			}
+		if out != nil && out.ColorValue > 0 && (in == nil || out.ColorValue > in.ColorValue) {
+			return nil, MakeError(ErrInsufficientColorValue, "you cannot create color value in a transfer", nil)
 		}
-		if !destroy && in.ColorValue == ColorValue(1) && (out == nil || out.ColorValue == ColorValue(0)) {
+		if !destroy && in != nil && in.ColorValue == ColorValue(1) && (out == nil || out.ColorValue == ColorValue(0)) {
 			return nil, MakeError(ErrDestroyColorValue, "destroying color value unintentionally", nil)
 		}
 	}
@@ -206,25 +239,51 @@ func (k SPOBC) TransferringTx(b *BlockExplorer, inputs []*ColorIn,
 		return nil, MakeError(ErrInsufficientColorValue, "spobc has no color value in the inputs", nil)
 	}
 
-	change, err := k.getChange(b, OutPoints(inputs), fee)
+	change, err := k.getChange(b, OutPoints(inputs), len(outputs), fee)
 	if err != nil {
 		return nil, err
 	}
 
 	// create the transaction
 	msgTx := btcwire.NewMsgTx()
-	for _, input := range inputs {
+	colored := -1
+	for i, input := range inputs {
 		msgTx.AddTxIn(btcwire.NewTxIn(input.OutPoint, nil))
+		if input.ColorValue == ColorValue(1) {
+			colored = i
+		}
 	}
-	for _, output := range outputs {
+	// whatever output is in the place of the colored input takes the
+	// color, so destroying puts an empty OP_RETURN output there
+	burn := btcwire.NewTxOut(0, []byte{opReturn})
+	for i, output := range outputs {
+		if destroy && i == colored && output.ColorValue == ColorValue(0) {
+			msgTx.AddTxOut(burn)
+		}
 		msgTx.AddTxOut(btcwire.NewTxOut(k.MinimumSatoshi, output.Script))
 	}
-	if *change > 0 {
-		msgTx.AddTxOut(btcwire.NewTxOut(*change, changeScript))
+	if destroy && colored == len(msgTx.TxOut) {
+		// or the change would take it
+		msgTx.AddTxOut(burn)
+	}
+	err = k.Dust.finishTx(msgTx, *change, changeScript)
+	if err != nil {
+		return nil, err
 	}
 	return msgTx, nil
 }
 
+// colorChangeIndex is the index of the input with the color value, as
+// that's the output the color value goes to.
+func (k SPOBC) colorChangeIndex(inputs []*ColorIn) int {
+	for i, in := range inputs {
+		if in.ColorValue > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
 func (k SPOBC) CalculateOutColorValues(genesis *btcwire.OutPoint, tx *btcwire.MsgTx, inputs []ColorValue) ([]ColorValue, error) {
 	outputs := make([]ColorValue, len(tx.TxOut))
 
@@ -234,7 +293,9 @@ func (k SPOBC) CalculateOutColorValues(genesis *btcwire.OutPoint, tx *btcwire.Ms
 		return nil, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
 	}
 	if genesis.Hash.String() == txShaHash.String() {
-		outputs[genesis.Index] = ColorValue(1)
+		if int(genesis.Index) < len(outputs) {
+			outputs[genesis.Index] = ColorValue(1)
+		}
 		return outputs, nil
 	}
 
@@ -242,12 +303,12 @@ func (k SPOBC) CalculateOutColorValues(genesis *btcwire.OutPoint, tx *btcwire.Ms
 	sum := ColorValue(0)
 	txOutLength := len(tx.TxOut)
 	for i, value := range inputs {
-		sum += value
 		if value > ColorValue(1) {
 			err := fmt.Sprintf("too much color value, should be at most 1, got %d", value)
 			return nil, MakeError(ErrTooMuchColorValue, err, nil)
 		}
-		if txOutLength > i && tx.TxOut[i].Value != 0 && value == ColorValue(1) {
+		sum += value
+		if txOutLength > i && tx.TxOut[i].Value > 0 && value == ColorValue(1) {
 			outputs[i] = ColorValue(1)
 		}
 	}
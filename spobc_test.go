@@ -2,11 +2,13 @@ package gochroma_test
 
 import (
 	"crypto/rand"
+	"math"
 	"testing"
 
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcwire"
 	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
 )
 
 var (
@@ -1000,3 +1002,68 @@ func TestSPOBCColorInsValidError(t *testing.T) {
 			rerr.ErrorCode, wantErr)
 	}
 }
+
+func TestSPOBCConformance(t *testing.T) {
+	spobc, err := gochroma.GetColorKernel(SPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting spobc kernel: %v", err)
+	}
+	kerneltest.Run(t, spobc, kerneltest.NewMemChain(), gochroma.ColorValue(1))
+}
+
+// tstCheckSPOBCCalculate checks that whatever the tx, SPOBC never colors
+// more than one output
+func tstCheckSPOBCCalculate(t *testing.T, ins, outs []uint64) {
+	spobc := &gochroma.SPOBC{MinimumSatoshi: gochroma.DefaultMinimumSatoshi}
+	inputs := make([]gochroma.ColorValue, len(ins))
+	for i, cv := range ins {
+		inputs[i] = gochroma.ColorValue(cv)
+	}
+	tx := tstHostileTx(0, len(inputs), outs)
+	genesis := btcwire.NewOutPoint(&btcwire.ShaHash{2}, 0)
+
+	outputs, err := spobc.CalculateOutColorValues(genesis, tx, inputs)
+	if err != nil {
+		return
+	}
+
+	sum := gochroma.ColorValue(0)
+	for i, cv := range outputs {
+		if cv > 1 || (cv == 1 && tx.TxOut[i].Value <= 0) {
+			t.Errorf("inputs %v, outputs %v: output %d has %d color value but %d satoshi",
+				ins, outs, i, cv, tx.TxOut[i].Value)
+			return
+		}
+		sum += cv
+	}
+	if sum > 1 {
+		t.Errorf("inputs %v, outputs %v: created color value: %d out", ins, outs, sum)
+	}
+}
+
+func TestSPOBCCalculateProperties(t *testing.T) {
+	tests := []struct {
+		inputs  []uint64
+		outputs []uint64
+	}{
+		{[]uint64{1, 0}, []uint64{5430, 1}},
+		{[]uint64{math.MaxUint64, 2}, []uint64{5430, 5430}},
+		{[]uint64{1, 1}, []uint64{1 << 63, 5430}},
+	}
+	for _, test := range tests {
+		tstCheckSPOBCCalculate(t, test.inputs, test.outputs)
+	}
+
+	r := tstRand()
+	for i := 0; i < 500; i++ {
+		ins := tstRandUint64s(r, 16)
+		// SPOBC color values are 0 or 1 but the kernel has to cope
+		// with anything
+		for j := range ins {
+			if r.Intn(2) == 0 {
+				ins[j] %= 2
+			}
+		}
+		tstCheckSPOBCCalculate(t, ins, tstRandUint64s(r, 16))
+	}
+}
@@ -0,0 +1,97 @@
+package gochroma
+
+import (
+	"github.com/btcsuite/btcwire"
+)
+
+// Issuance is a tx creating color value, the genesis or a later one.
+type Issuance struct {
+	Hash   btcwire.ShaHash
+	Height int64
+	// color value of every output issued to, in order
+	Outputs    []ColorValue
+	ColorValue ColorValue
+	// output the issuance gave the authority to issue more, nil if none
+	Authority *btcwire.OutPoint
+}
+
+// ReissuableKernel is implemented by kernels whose colors can be issued
+// more than once.
+type ReissuableKernel interface {
+	// Returns whether the tx issues the color
+	IsIssuance(b *BlockExplorer, genesis *btcwire.OutPoint, tx *btcwire.MsgTx) (bool, error)
+	// Returns every issuance of the color starting with the genesis at
+	// the height given, and the authority to issue more if there still is
+	// one
+	Issuances(b *BlockExplorer, genesis *btcwire.OutPoint, height int64) ([]*Issuance, *btcwire.OutPoint, error)
+}
+
+// SupplyReport is how much of a color has been issued, and when.
+type SupplyReport struct {
+	Definition *ColorDefinition
+	Issuances  []*Issuance
+	// color value of every issuance together
+	Supply ColorValue
+	// output that can issue more, nil if the color can't be issued again
+	Authority *btcwire.OutPoint
+}
+
+// IsIssuance returns whether the tx issues the color. That's only the
+// genesis unless the kernel is a ReissuableKernel.
+func (c *ColorDefinition) IsIssuance(b *BlockExplorer, tx *btcwire.MsgTx) (bool, error) {
+	kernel, ok := c.ColorKernel.(ReissuableKernel)
+	if ok {
+		return kernel.IsIssuance(b, c.Genesis, tx)
+	}
+	txShaHash, err := tx.TxSha()
+	if err != nil {
+		return false, MakeError(ErrInvalidTx, "transaction does not have a hash", err)
+	}
+	return c.Genesis.Hash.IsEqual(&txShaHash), nil
+}
+
+// SupplyReport lists every issuance of the color. For a kernel that
+// isn't a ReissuableKernel that's only the genesis.
+func (c *ColorDefinition) SupplyReport(b *BlockExplorer) (*SupplyReport, error) {
+	report := &SupplyReport{Definition: c}
+	kernel, ok := c.ColorKernel.(ReissuableKernel)
+	if ok {
+		issuances, authority, err := kernel.Issuances(b, c.Genesis, c.Height)
+		if err != nil {
+			return nil, err
+		}
+		report.Issuances, report.Authority = issuances, authority
+	} else {
+		utilTx, err := b.OutPointTx(c.Genesis)
+		if err != nil {
+			return nil, err
+		}
+		tx := utilTx.MsgTx()
+		values, err := c.RunKernelOnChain(b, tx, make([]ColorValue, len(tx.TxIn)))
+		if err != nil {
+			return nil, err
+		}
+		issuance := &Issuance{
+			Hash:   c.Genesis.Hash,
+			Height: c.Height,
+		}
+		for _, cv := range values {
+			if cv > 0 {
+				issuance.Outputs = append(issuance.Outputs, cv)
+			}
+		}
+		issuance.ColorValue, err = SumColorValues(issuance.Outputs)
+		if err != nil {
+			return nil, err
+		}
+		report.Issuances = []*Issuance{issuance}
+	}
+	for _, issuance := range report.Issuances {
+		var err error
+		report.Supply, err = report.Supply.Add(issuance.ColorValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
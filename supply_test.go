@@ -0,0 +1,105 @@
+package gochroma_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestSupplyReport(t *testing.T) {
+	// Setup
+	repobc, err := gochroma.GetColorKernel(REPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting repobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, repobc, 100)
+	first := tstReissue(t, chain, cd, btcwire.NewOutPoint(&cd.Genesis.Hash, 1), 50)
+	firstHash, _ := first.TxSha()
+	firstHeight, err := b.BlockCount()
+	if err != nil {
+		t.Fatalf("failed to get block count: %v", err)
+	}
+	authority := btcwire.NewOutPoint(&firstHash, 1)
+
+	// Execute
+	report, err := cd.SupplyReport(b)
+	if err != nil {
+		t.Fatalf("failed to get supply report: %v", err)
+	}
+
+	// Verify
+	if report.Supply != 150 {
+		t.Errorf("wrong supply: got %d, want 150", report.Supply)
+	}
+	if report.Authority == nil || *report.Authority != *authority {
+		t.Errorf("wrong authority: got %v, want %v", report.Authority, authority)
+	}
+	want := []struct {
+		hash   btcwire.ShaHash
+		height int64
+		cv     gochroma.ColorValue
+	}{
+		{cd.Genesis.Hash, cd.Height, 100},
+		{firstHash, firstHeight, 50},
+	}
+	if len(report.Issuances) != len(want) {
+		t.Fatalf("wrong number of issuances: got %d, want %d",
+			len(report.Issuances), len(want))
+	}
+	for i, issuance := range report.Issuances {
+		if !issuance.Hash.IsEqual(&want[i].hash) {
+			t.Errorf("issuance %d: wrong hash: got %v, want %v", i, issuance.Hash, want[i].hash)
+		}
+		if issuance.Height != want[i].height {
+			t.Errorf("issuance %d: wrong height: got %d, want %d", i, issuance.Height, want[i].height)
+		}
+		if issuance.ColorValue != want[i].cv || len(issuance.Outputs) != 1 {
+			t.Errorf("issuance %d: wrong color value: got %d in %v, want %d",
+				i, issuance.ColorValue, issuance.Outputs, want[i].cv)
+		}
+	}
+
+	// spending the authority outside of an issuance ends the supply
+	spend := btcwire.NewMsgTx()
+	spend.AddTxIn(btcwire.NewTxIn(authority, nil))
+	spend.AddTxOut(btcwire.NewTxOut(1000, tstScript(0)))
+	tstPublish(t, chain, spend)
+	report, err = cd.SupplyReport(b)
+	if err != nil {
+		t.Fatalf("failed to get supply report: %v", err)
+	}
+	if report.Authority != nil || len(report.Issuances) != 2 || report.Supply != 150 {
+		t.Errorf("wrong report after the authority was spent: %v issuances, supply %d, authority %v",
+			len(report.Issuances), report.Supply, report.Authority)
+	}
+}
+
+func TestSupplyReportSingle(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+
+	// Execute
+	report, err := cd.SupplyReport(b)
+	if err != nil {
+		t.Fatalf("failed to get supply report: %v", err)
+	}
+
+	// Verify
+	if report.Supply != 100 || len(report.Issuances) != 1 || report.Authority != nil {
+		t.Fatalf("wrong report: %v issuances, supply %d, authority %v",
+			len(report.Issuances), report.Supply, report.Authority)
+	}
+	if report.Issuances[0].Height != cd.Height {
+		t.Errorf("wrong height: got %d, want %d", report.Issuances[0].Height, cd.Height)
+	}
+}
@@ -0,0 +1,246 @@
+package gochroma
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcwire"
+)
+
+// TxIssue is something wrong with a colored transaction.
+type TxIssue struct {
+	// ErrOutPointSpent, ErrBadMarker, ErrBadPadding, ErrDust, ErrBadBurn,
+	// ErrTooMuchColorValue or ErrDestroyColorValue
+	Code ErrorCode
+	// color the issue is about, nil if it's about the tx as a whole
+	Definition *ColorDefinition
+	// index of the input or output the issue is about, -1 if none
+	Input  int
+	Output int
+	// what's wrong, for people
+	Description string
+}
+
+func (i *TxIssue) String() string {
+	return fmt.Sprintf("%v: %v", i.Code, i.Description)
+}
+
+// ColorFlow is how much of a color goes into and out of a transaction.
+type ColorFlow struct {
+	Definition *ColorDefinition
+	// color value of every input and output
+	Inputs  []ColorValue
+	Outputs []ColorValue
+	In      ColorValue
+	Out     ColorValue
+	// color value the tx provably burns, see BurnScript
+	Burned ColorValue
+	// whether the tx issues the color
+	Issuance bool
+}
+
+// ColorTxReport is the result of validating a colored transaction.
+type ColorTxReport struct {
+	// flows of the colors the tx moves, in the order of the definitions
+	Flows  []*ColorFlow
+	Issues []*TxIssue
+}
+
+// OK returns whether nothing was found wrong.
+func (r *ColorTxReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Err returns an ErrInvalidColorTx error listing the issues, or nil if
+// there are none.
+func (r *ColorTxReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	strs := make([]string, len(r.Issues))
+	for i, issue := range r.Issues {
+		strs[i] = issue.String()
+	}
+	return MakeError(ErrInvalidColorTx, strings.Join(strs, "; "), nil)
+}
+
+func (r *ColorTxReport) add(code ErrorCode, cd *ColorDefinition, input, output int, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, &TxIssue{
+		Code:        code,
+		Definition:  cd,
+		Input:       input,
+		Output:      output,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidateColorTx checks the unpublished tx against the colors of the
+// definitions before it goes out. Every input has to be unspent, no
+// output can be dust under the policy, the kernel of each color has to
+// find the tx tagged right and the color value that goes in has to come
+// out, unless the one burn script a tx can have says where it went.
+// Whatever is wrong with the tx goes in the report, and the error is only
+// for failing to look things up.
+func ValidateColorTx(b *BlockExplorer, defs []*ColorDefinition, tx *btcwire.MsgTx, dust *DustPolicy) (*ColorTxReport, error) {
+	report := &ColorTxReport{}
+	if len(tx.TxIn) == 0 {
+		return nil, MakeError(ErrInvalidTx, "transaction has no inputs", nil)
+	}
+
+	for i, txIn := range tx.TxIn {
+		spent, err := b.OutPointSpent(&txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		if *spent {
+			report.add(ErrOutPointSpent, nil, i, -1, "input %d spends %v, which is spent already",
+				i, outPointString(&txIn.PreviousOutPoint))
+		}
+	}
+
+	burns := burnOutputs(tx)
+	for i := 1; i < len(burns); i++ {
+		report.add(ErrBadBurn, nil, -1, burns[i], "output %d is another burn script, a tx can only burn once",
+			burns[i])
+	}
+
+	for _, cd := range defs {
+		flow, err := colorFlow(b, cd, tx)
+		if err != nil {
+			return nil, err
+		}
+		if flow.In == 0 && flow.Out == 0 {
+			continue
+		}
+		report.Flows = append(report.Flows, flow)
+		report.checkFlow(cd, tx, flow)
+	}
+
+	for i, txOut := range tx.TxOut {
+		if !dust.IsDust(txOut) {
+			continue
+		}
+		colored := false
+		for _, flow := range report.Flows {
+			if flow.Outputs[i] > 0 {
+				colored = true
+				report.add(ErrBadPadding, flow.Definition, -1, i,
+					"output %d has %d color value of %v in only %d satoshi",
+					i, flow.Outputs[i], flow.Definition, txOut.Value)
+			}
+		}
+		if !colored {
+			report.add(ErrDust, nil, -1, i, "output %d has only %d satoshi, the dust limit is %d",
+				i, txOut.Value, dust.Threshold(txOut.PkScript))
+		}
+	}
+	return report, nil
+}
+
+// colorFlow runs the kernel of the color over the tx, tracing the color
+// value of every input.
+func colorFlow(b *BlockExplorer, cd *ColorDefinition, tx *btcwire.MsgTx) (*ColorFlow, error) {
+	flow := &ColorFlow{
+		Definition: cd,
+		Inputs:     make([]ColorValue, len(tx.TxIn)),
+	}
+	for i, txIn := range tx.TxIn {
+		// spent inputs are reported above, the provenance still has
+		// their color value
+		p, err := cd.Provenance(b, &txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		flow.Inputs[i] = p.ColorValue
+	}
+	var err error
+	flow.In, err = SumColorValues(flow.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	flow.Outputs, err = cd.RunKernelOnChain(b, tx, flow.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	flow.Out, err = SumColorValues(flow.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	flow.Issuance, err = cd.IsIssuance(b, tx)
+	if err != nil {
+		return nil, err
+	}
+	// only the first burn script counts, the others are reported
+	indexes := burnOutputs(tx)
+	if len(indexes) > 0 {
+		burnHash, cv := parseBurnScript(tx.TxOut[indexes[0]].PkScript)
+		if bytes.HasPrefix(cd.Hash(), burnHash) {
+			flow.Burned = cv
+		}
+	}
+	return flow, nil
+}
+
+// checkFlow reports what's wrong with how the color moves through the tx.
+func (r *ColorTxReport) checkFlow(cd *ColorDefinition, tx *btcwire.MsgTx, flow *ColorFlow) {
+	var marker *TxMarker
+	detector, ok := cd.ColorKernel.(MarkerDetector)
+	if ok {
+		marker = detector.DetectMarker(NewBitList(tx.TxIn[0].Sequence, 32))
+	}
+	if marker != nil && marker.Kind == TxKindGenesis {
+		switch {
+		case !flow.Issuance && flow.In > 0:
+			r.add(ErrBadMarker, cd, 0, -1,
+				"tx is tagged as a %v genesis but spends %d color value of %v",
+				cd.Code(), flow.In, cd)
+		case marker.Outputs > len(tx.TxOut):
+			r.add(ErrBadMarker, cd, 0, -1,
+				"tx is tagged as issuing to %d outputs but has %d",
+				marker.Outputs, len(tx.TxOut))
+		}
+	}
+	if ok && marker == nil && flow.In > 0 && flow.Out == 0 {
+		r.add(ErrBadMarker, cd, 0, -1,
+			"tx is not tagged by %v and none of the %d color value of %v comes out",
+			cd.Code(), flow.In, cd)
+	}
+
+	if flow.Issuance {
+		return
+	}
+	accounted, err := flow.Out.Add(flow.Burned)
+	switch {
+	case flow.Out > flow.In:
+		r.add(ErrTooMuchColorValue, cd, -1, -1,
+			"%d color value of %v comes out, only %d goes in",
+			flow.Out, cd, flow.In)
+	case err == nil && accounted < flow.In:
+		r.add(ErrDestroyColorValue, cd, -1, -1,
+			"%d color value of %v goes to the fee or change",
+			flow.In-accounted, cd)
+	case err != nil || accounted > flow.In:
+		r.add(ErrDestroyColorValue, cd, -1, -1,
+			"burn script claims %d color value of %v, only %d is destroyed",
+			flow.Burned, cd, flow.In-flow.Out)
+	}
+}
+
+// PublishColorTx validates the tx like ValidateColorTx and publishes it.
+// In strict mode a tx with any issue isn't published and the error is
+// that of the report.
+func (b *BlockExplorer) PublishColorTx(defs []*ColorDefinition, tx *btcwire.MsgTx, dust *DustPolicy, strict bool) (*btcwire.ShaHash, *ColorTxReport, error) {
+	report, err := ValidateColorTx(b, defs, tx, dust)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strict && !report.OK() {
+		return nil, report, report.Err()
+	}
+	shaHash, err := b.PublishTx(tx)
+	if err != nil {
+		return nil, report, err
+	}
+	return shaHash, report, nil
+}
@@ -0,0 +1,255 @@
+package gochroma_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcwire"
+	"github.com/jimmysong/gochroma"
+	"github.com/jimmysong/gochroma/kerneltest"
+)
+
+func TestValidateColorTx(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	low := tstIssue(t, chain, &gochroma.EPOBC{MinimumSatoshi: 1}, 100)
+	spent := tstIssue(t, chain, epobc, 100)
+	tstTransfer(t, chain, spent, spent.Genesis, 100)
+	defs := []*gochroma.ColorDefinition{cd, low, spent}
+
+	transfer := func(c *gochroma.ColorDefinition, out gochroma.ColorValue) *btcwire.MsgTx {
+		inputs := []*gochroma.ColorIn{&gochroma.ColorIn{c.Genesis, 100}}
+		outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), out}}
+		tx, err := c.TransferringTx(b, inputs, outputs, tstScript(0), 0, true)
+		if err != nil {
+			t.Fatalf("failed to make transferring tx: %v", err)
+		}
+		return tx
+	}
+	untagged := transfer(cd, 100)
+	untagged.TxIn[0].Sequence = math.MaxUint32
+	genesisTagged := transfer(cd, 100)
+	genesisTagged.TxIn[0].Sequence = gochroma.EPOBCGenesisMarker.Combine(
+		gochroma.NewBitList(0, 26)).Uint32()
+	dust := transfer(cd, 100)
+	dust.AddTxOut(btcwire.NewTxOut(100, tstScript(3)))
+	burn, err := cd.BurningTx(b, []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}},
+		nil, tstScript(0), 0)
+	if err != nil {
+		t.Fatalf("failed to make burning tx: %v", err)
+	}
+	twice, err := cd.BurningTx(b, []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}},
+		nil, tstScript(0), 0)
+	if err != nil {
+		t.Fatalf("failed to make burning tx: %v", err)
+	}
+	twice.AddTxOut(btcwire.NewTxOut(0, gochroma.BurnScript(cd, 100)))
+	// the same tx but spending a colored output that's spent already
+	spentTx := transfer(cd, 100)
+	spentTx.TxIn[0].PreviousOutPoint = *spent.Genesis
+	overclaim := transfer(cd, 60)
+	overclaim.AddTxOut(btcwire.NewTxOut(0, gochroma.BurnScript(cd, 50)))
+
+	tests := []struct {
+		desc  string
+		tx    *btcwire.MsgTx
+		codes []int
+		in    gochroma.ColorValue
+		out   gochroma.ColorValue
+	}{
+		{"transfer", transfer(cd, 100), nil, 100, 100},
+		{"burn", burn, nil, 100, 0},
+		{"two burn scripts", twice, []int{gochroma.ErrBadBurn}, 100, 0},
+		// what's destroyed is too little for change so it goes to the fee
+		{"destroy", transfer(cd, 60),
+			[]int{gochroma.ErrDestroyColorValue}, 100, 60},
+		{"overclaimed burn", overclaim,
+			[]int{gochroma.ErrDestroyColorValue}, 100, 60},
+		{"untagged", untagged,
+			[]int{gochroma.ErrBadMarker, gochroma.ErrDestroyColorValue}, 100, 0},
+		{"tagged as genesis", genesisTagged,
+			[]int{gochroma.ErrBadMarker, gochroma.ErrDestroyColorValue}, 100, 0},
+		{"dust", dust, []int{gochroma.ErrDust}, 100, 100},
+		{"padding", transfer(low, 100), []int{gochroma.ErrBadPadding}, 100, 100},
+		{"spent", spentTx, []int{gochroma.ErrOutPointSpent}, 100, 100},
+	}
+
+	for _, test := range tests {
+		// Execute
+		report, err := gochroma.ValidateColorTx(b, defs, test.tx, gochroma.DefaultDustPolicy)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: failed to validate: %v", test.desc, err)
+			continue
+		}
+		if len(report.Issues) != len(test.codes) {
+			t.Errorf("%v: wrong issues: got %v, want %v", test.desc, report.Issues, test.codes)
+			continue
+		}
+		for i, issue := range report.Issues {
+			if issue.Code != gochroma.ErrorCode(test.codes[i]) {
+				t.Errorf("%v: wrong issue %d: got %v, want %v", test.desc, i,
+					issue.Code, gochroma.ErrorCode(test.codes[i]))
+			}
+		}
+		if report.OK() != (report.Err() == nil) || report.OK() != (len(test.codes) == 0) {
+			t.Errorf("%v: OK is %v but error is %v", test.desc, report.OK(), report.Err())
+		}
+		if len(report.Flows) != 1 {
+			t.Errorf("%v: wrong number of flows: got %d, want 1", test.desc, len(report.Flows))
+			continue
+		}
+		flow := report.Flows[0]
+		if flow.In != test.in || flow.Out != test.out {
+			t.Errorf("%v: wrong flow: got %d to %d, want %d to %d", test.desc,
+				flow.In, flow.Out, test.in, test.out)
+		}
+	}
+}
+
+func TestValidateColorTxDustPolicy(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 100}}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, false)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	tx.AddTxOut(btcwire.NewTxOut(1000, tstScript(3)))
+
+	tests := []struct {
+		desc  string
+		dust  *gochroma.DustPolicy
+		codes []int
+	}{
+		{"no policy", nil, nil},
+		{"default", gochroma.DefaultDustPolicy, nil},
+		{"high relay fee", &gochroma.DustPolicy{RelayFee: 10000}, []int{gochroma.ErrDust}},
+	}
+
+	for _, test := range tests {
+		// Execute
+		report, err := gochroma.ValidateColorTx(b, []*gochroma.ColorDefinition{cd}, tx, test.dust)
+
+		// Verify
+		if err != nil {
+			t.Errorf("%v: failed to validate: %v", test.desc, err)
+			continue
+		}
+		if len(report.Issues) != len(test.codes) {
+			t.Errorf("%v: wrong issues: got %v, want %v", test.desc, report.Issues, test.codes)
+			continue
+		}
+		for i, issue := range report.Issues {
+			if issue.Code != gochroma.ErrorCode(test.codes[i]) {
+				t.Errorf("%v: wrong issue %d: got %v, want %v", test.desc, i,
+					issue.Code, gochroma.ErrorCode(test.codes[i]))
+			}
+		}
+	}
+}
+
+func TestValidateColorTxUnconfirmed(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 100}}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, false)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+	// still in the mempool
+	shaHash, err := b.PublishTx(tx)
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	inputs = []*gochroma.ColorIn{&gochroma.ColorIn{btcwire.NewOutPoint(shaHash, 0), 100}}
+	tx, err = cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, false)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+
+	// Execute
+	report, err := gochroma.ValidateColorTx(b, []*gochroma.ColorDefinition{cd}, tx, gochroma.DefaultDustPolicy)
+
+	// Verify
+	if err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("tx is invalid: %v", report.Err())
+	}
+	if len(report.Flows) != 1 || report.Flows[0].In != 100 || report.Flows[0].Out != 100 {
+		t.Errorf("wrong flows: %v", report.Flows)
+	}
+}
+
+func TestPublishColorTx(t *testing.T) {
+	// Setup
+	epobc, err := gochroma.GetColorKernel(EPOBCKey)
+	if err != nil {
+		t.Fatalf("error getting epobc kernel: %v", err)
+	}
+	chain := kerneltest.NewMemChain()
+	b := chain.NewBlockExplorer()
+	cd := tstIssue(t, chain, epobc, 100)
+	defs := []*gochroma.ColorDefinition{cd}
+	inputs := []*gochroma.ColorIn{&gochroma.ColorIn{cd.Genesis, 100}}
+	outputs := []*gochroma.ColorOut{&gochroma.ColorOut{tstScript(2), 60}}
+	tx, err := cd.TransferringTx(b, inputs, outputs, tstScript(0), 0, true)
+	if err != nil {
+		t.Fatalf("failed to make transferring tx: %v", err)
+	}
+
+	// Execute
+	_, report, err := b.PublishColorTx(defs, tx, gochroma.DefaultDustPolicy, true)
+
+	// Verify
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	rerr := err.(gochroma.ChromaError)
+	wantErr := gochroma.ErrorCode(gochroma.ErrInvalidColorTx)
+	if rerr.ErrorCode != wantErr {
+		t.Fatalf("wrong error passed back: got %v, want %v", rerr.ErrorCode, wantErr)
+	}
+	if report.OK() {
+		t.Fatalf("report has no issues")
+	}
+	spent, err := b.OutPointSpent(cd.Genesis)
+	if err != nil {
+		t.Fatalf("failed to check spent: %v", err)
+	}
+	if *spent {
+		t.Fatalf("strict mode published the tx")
+	}
+
+	// without strict mode it goes out with the report
+	shaHash, report, err := b.PublishColorTx(defs, tx, gochroma.DefaultDustPolicy, false)
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if shaHash == nil || report.OK() {
+		t.Fatalf("wrong result: hash %v, report %v", shaHash, report.Issues)
+	}
+}